@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+// APIKeyPrefix marks bookstore API keys so they are easy to recognize in
+// secret scanners and distinguish from JWTs in the Authorization header
+const APIKeyPrefix = "bks_"
+
+// NewAPIKey generates a key of the form bks_<prefix>_<secret>. The prefix is
+// stored in plain text for lookup, the full key only as a hash.
+func NewAPIKey() (key string, prefix string, hash string, err error) {
+	rawPrefix := make([]byte, 4)
+	if _, err := rand.Read(rawPrefix); err != nil {
+		return "", "", "", err
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", "", err
+	}
+
+	prefix = hex.EncodeToString(rawPrefix)
+	key = APIKeyPrefix + prefix + "_" + base64.RawURLEncoding.EncodeToString(secret)
+	return key, prefix, HashToken(key), nil
+}
+
+// IsAPIKey reports whether a credential looks like an API key rather than a JWT
+func IsAPIKey(credential string) bool {
+	return strings.HasPrefix(credential, APIKeyPrefix)
+}
+
+// APIKeyLookupPrefix extracts the lookup prefix from a key
+func APIKeyLookupPrefix(key string) (string, bool) {
+	rest, ok := strings.CutPrefix(key, APIKeyPrefix)
+	if !ok {
+		return "", false
+	}
+	prefix, secret, ok := strings.Cut(rest, "_")
+	if !ok || prefix == "" || secret == "" {
+		return "", false
+	}
+	return prefix, true
+}
@@ -0,0 +1,29 @@
+package auth
+
+import "testing"
+
+func TestNewAPIKey(t *testing.T) {
+	key, prefix, hash, err := NewAPIKey()
+	if err != nil {
+		t.Fatalf("NewAPIKey() failed: %v", err)
+	}
+
+	if !IsAPIKey(key) {
+		t.Errorf("Expected %s to be recognized as an API key", key)
+	}
+
+	lookup, ok := APIKeyLookupPrefix(key)
+	if !ok || lookup != prefix {
+		t.Errorf("Expected lookup prefix %s but got %s", prefix, lookup)
+	}
+
+	if hash != HashToken(key) {
+		t.Errorf("Expected stored hash to match the hash of the key")
+	}
+
+	for _, invalid := range []string{"bks_", "bks_abc", "bks__secret", "eyJhbGciOi.jwt.token"} {
+		if _, ok := APIKeyLookupPrefix(invalid); ok {
+			t.Errorf("Expected %q to be rejected", invalid)
+		}
+	}
+}
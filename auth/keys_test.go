@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func writePrivateKey(t *testing.T, dir, kid string, key interface{}) {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+	content := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, kid+".pem"), content, 0600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+}
+
+func writePublicKey(t *testing.T, dir, kid string, key interface{}) {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+	content := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, kid+".pem"), content, 0644); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+}
+
+func testClaims() jwt.MapClaims {
+	return jwt.MapClaims{"user_id": 1, "exp": time.Now().Add(time.Minute).Unix()}
+}
+
+func TestKeyRotationKeepsOldTokensValid(t *testing.T) {
+	dir := t.TempDir()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+	writePrivateKey(t, dir, "2026-01", rsaKey)
+
+	keys, err := LoadKeySet(dir, "")
+	if err != nil {
+		t.Fatalf("LoadKeySet() failed: %v", err)
+	}
+	manager := NewTokenManager(keys, "bookstore-api")
+
+	oldToken, err := manager.Sign(testClaims())
+	if err != nil {
+		t.Fatalf("Sign() failed: %v", err)
+	}
+
+	// Rotate: add a newer Ed25519 key and keep only the public half of the old one
+	newKey, err := GenerateKey("2026-02")
+	if err != nil {
+		t.Fatalf("GenerateKey() failed: %v", err)
+	}
+	writePrivateKey(t, dir, "2026-02", newKey.Private)
+	writePublicKey(t, dir, "2026-01", &rsaKey.PublicKey)
+
+	keys, err = LoadKeySet(dir, "")
+	if err != nil {
+		t.Fatalf("LoadKeySet() after rotation failed: %v", err)
+	}
+	manager.SetKeys(keys)
+
+	if _, err := manager.Parse(oldToken); err != nil {
+		t.Errorf("Expected token signed before rotation to stay valid, got: %v", err)
+	}
+
+	newToken, err := manager.Sign(testClaims())
+	if err != nil {
+		t.Fatalf("Sign() after rotation failed: %v", err)
+	}
+	parsed, _, err := jwt.NewParser().ParseUnverified(newToken, jwt.MapClaims{})
+	if err != nil {
+		t.Fatalf("Failed to decode new token: %v", err)
+	}
+	if parsed.Header["kid"] != "2026-02" || parsed.Method.Alg() != "EdDSA" {
+		t.Errorf("Expected new token signed by 2026-02 with EdDSA, got kid=%v alg=%s", parsed.Header["kid"], parsed.Method.Alg())
+	}
+
+	jwks := manager.JWKS()
+	if len(jwks.Keys) != 2 {
+		t.Fatalf("Expected 2 keys in JWKS but got %d", len(jwks.Keys))
+	}
+	if jwks.Keys[0].KeyType != "RSA" || jwks.Keys[0].N == "" || jwks.Keys[1].KeyType != "OKP" || jwks.Keys[1].X == "" {
+		t.Errorf("Unexpected JWKS content: %+v", jwks.Keys)
+	}
+}
+
+func TestParseRejectsUnknownKeyAndIssuer(t *testing.T) {
+	signer, _ := GenerateKey("signer")
+	other, _ := GenerateKey("other")
+
+	signerKeys, _ := NewKeySet([]*Key{signer}, "")
+	otherKeys, _ := NewKeySet([]*Key{other}, "")
+
+	token, err := NewTokenManager(signerKeys, "bookstore-api").Sign(testClaims())
+	if err != nil {
+		t.Fatalf("Sign() failed: %v", err)
+	}
+
+	if _, err := NewTokenManager(otherKeys, "bookstore-api").Parse(token); err != ErrInvalidToken {
+		t.Errorf("Expected ErrInvalidToken for unknown kid, got: %v", err)
+	}
+	if _, err := NewTokenManager(signerKeys, "someone-else").Parse(token); err != ErrInvalidToken {
+		t.Errorf("Expected ErrInvalidToken for wrong issuer, got: %v", err)
+	}
+}
+
+func TestNewKeySetRequiresSigningKey(t *testing.T) {
+	key, _ := GenerateKey("public-only")
+	key.Private = nil
+
+	if _, err := NewKeySet([]*Key{key}, ""); err != ErrNoSigningKey {
+		t.Errorf("Expected ErrNoSigningKey, got: %v", err)
+	}
+	if _, err := NewKeySet([]*Key{key}, "public-only"); err == nil {
+		t.Errorf("Expected error when the active key has no private part")
+	}
+}
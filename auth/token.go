@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+// TokenManager signs tokens with the active key and verifies them against every
+// key in the set. The key set can be swapped at runtime to rotate keys without
+// invalidating tokens signed by a key that is still present.
+type TokenManager struct {
+	mu     sync.RWMutex
+	keys   *KeySet
+	issuer string
+}
+
+func NewTokenManager(keys *KeySet, issuer string) *TokenManager {
+	return &TokenManager{keys: keys, issuer: issuer}
+}
+
+// SetKeys replaces the key set, typically after reloading the key directory
+func (m *TokenManager) SetKeys(keys *KeySet) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.keys = keys
+}
+
+func (m *TokenManager) keySet() *KeySet {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.keys
+}
+
+// Sign adds the issuer claim and signs the claims with the active key
+func (m *TokenManager) Sign(claims jwt.MapClaims) (string, error) {
+	key := m.keySet().Active()
+	if key == nil {
+		return "", ErrNoSigningKey
+	}
+
+	claims["iss"] = m.issuer
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.Private)
+}
+
+// Parse verifies the signature, issuer and expiry of a token and returns its claims
+func (m *TokenManager) Parse(tokenString string) (jwt.MapClaims, error) {
+	keys := m.keySet()
+	claims := jwt.MapClaims{}
+
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := keys.Get(kid)
+		if !ok {
+			return nil, ErrInvalidToken
+		}
+		// Never let the token header choose a different algorithm than the key was made for
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, ErrInvalidToken
+		}
+		return key.Public, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}),
+		jwt.WithIssuer(m.issuer),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+// JWKS returns the public keys downstream services use to verify tokens
+func (m *TokenManager) JWKS() JSONWebKeySet {
+	return m.keySet().JWKS()
+}
+
+// GenerateKey creates an in-memory Ed25519 key. It is meant for local
+// development and tests where no key directory is configured.
+func GenerateKey(kid string) (*Key, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return newKey(kid, private, public)
+}
@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// Secret "12345678901234567890" from the RFC 6238 appendix B test vectors
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCodeMatchesRFCVectors(t *testing.T) {
+	cases := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tc := range cases {
+		code, err := TOTPCode(rfcSecret, TOTPStep(time.Unix(tc.unix, 0)))
+		if err != nil {
+			t.Fatalf("TOTPCode() failed: %v", err)
+		}
+		if code != tc.code {
+			t.Errorf("At %d expected code %s but got %s", tc.unix, tc.code, code)
+		}
+	}
+}
+
+func TestValidateTOTPAcceptsSkew(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+
+	previous, _ := TOTPCode(rfcSecret, TOTPStep(now)-1)
+	step, ok := ValidateTOTP(rfcSecret, previous, now)
+	if !ok {
+		t.Fatalf("Expected code from previous period to be accepted")
+	}
+	if step != TOTPStep(now)-1 {
+		t.Errorf("Expected matched step %d but got %d", TOTPStep(now)-1, step)
+	}
+
+	tooOld, _ := TOTPCode(rfcSecret, TOTPStep(now)-3)
+	if _, ok := ValidateTOTP(rfcSecret, tooOld, now); ok {
+		t.Errorf("Expected code three periods old to be rejected")
+	}
+
+	if _, ok := ValidateTOTP(rfcSecret, "12345", now); ok {
+		t.Errorf("Expected code with wrong length to be rejected")
+	}
+}
+
+func TestGenerateTOTPSecretRoundTrip(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret() failed: %v", err)
+	}
+
+	now := time.Now()
+	code, err := TOTPCode(secret, TOTPStep(now))
+	if err != nil {
+		t.Fatalf("TOTPCode() failed: %v", err)
+	}
+	if _, ok := ValidateTOTP(secret, code, now); !ok {
+		t.Errorf("Expected freshly generated code to validate")
+	}
+
+	uri := TOTPURI("Bookstore", "staff@example.com", secret)
+	if !strings.HasPrefix(uri, "otpauth://totp/Bookstore:staff@example.com?") || !strings.Contains(uri, "secret="+secret) {
+		t.Errorf("Unexpected otpauth URI: %s", uri)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes()
+	if err != nil {
+		t.Fatalf("GenerateRecoveryCodes() failed: %v", err)
+	}
+	if len(codes) != recoveryCodeCount {
+		t.Fatalf("Expected %d recovery codes but got %d", recoveryCodeCount, len(codes))
+	}
+
+	seen := make(map[string]bool)
+	for _, code := range codes {
+		if seen[code] {
+			t.Errorf("Duplicate recovery code %s", code)
+		}
+		seen[code] = true
+	}
+
+	if HashRecoveryCode(codes[0]) != HashRecoveryCode(" "+strings.ToUpper(codes[0])+" ") {
+		t.Errorf("Expected recovery code hashing to ignore case and surrounding spaces")
+	}
+}
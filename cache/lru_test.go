@@ -0,0 +1,64 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLRUEvictsLeastRecentlyUsed(t *testing.T) {
+	c := New[int, string](2, time.Minute)
+	c.Add(1, "Dune")
+	c.Add(2, "Emma")
+	// Reading 1 makes 2 the least recently used entry
+	c.Get(1)
+	c.Add(3, "Ulysses")
+
+	if _, ok := c.Get(2); ok {
+		t.Error("Expected 2 to be evicted")
+	}
+	for key, expected := range map[int]string{1: "Dune", 3: "Ulysses"} {
+		if value, ok := c.Get(key); !ok || value != expected {
+			t.Errorf("Get(%d) = %q, %v, expected %q", key, value, ok, expected)
+		}
+	}
+	if c.Len() != 2 {
+		t.Errorf("Expected 2 entries but got %d", c.Len())
+	}
+}
+
+func TestLRUExpiresEntries(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	c := New[int, string](10, time.Minute)
+	c.now = func() time.Time { return now }
+	c.Add(1, "Dune")
+
+	now = now.Add(59 * time.Second)
+	if _, ok := c.Get(1); !ok {
+		t.Fatal("Expected the entry before its TTL")
+	}
+	now = now.Add(time.Second)
+	if _, ok := c.Get(1); ok {
+		t.Error("Expected the entry to expire after its TTL")
+	}
+	if c.Len() != 0 {
+		t.Errorf("Expected the expired entry to be dropped but got %d entries", c.Len())
+	}
+}
+
+func TestLRUAddIfGeneration(t *testing.T) {
+	c := New[int, string](10, time.Minute)
+	generation := c.Generation()
+	// An update invalidates the book while its old version is being loaded
+	c.Remove(1)
+	if c.AddIfGeneration(1, "stale", generation) {
+		t.Error("Expected a value loaded before an invalidation to be discarded")
+	}
+	if !c.AddIfGeneration(1, "fresh", c.Generation()) {
+		t.Error("Expected a value loaded after the invalidation to be cached")
+	}
+
+	c.Purge()
+	if _, ok := c.Get(1); ok || c.Len() != 0 {
+		t.Error("Expected Purge to drop every entry")
+	}
+}
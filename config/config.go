@@ -0,0 +1,558 @@
+// Package config loads the typed application configuration. Values come from
+// built-in defaults, an optional YAML or TOML file and environment variables,
+// in increasing order of precedence. A .env file is loaded into the environment first.
+package config
+
+import (
+	"bookstore-api/ratelimit"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Duration is a time.Duration read from strings such as "30s" or "24h"
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+type Config struct {
+	Server      Server      `yaml:"server" toml:"server"`
+	Database    Database    `yaml:"database" toml:"database"`
+	Auth        Auth        `yaml:"auth" toml:"auth"`
+	Password    Password    `yaml:"password" toml:"password"`
+	OIDC        OIDC        `yaml:"oidc" toml:"oidc"`
+	CORS        CORS        `yaml:"cors" toml:"cors"`
+	Idempotency Idempotency `yaml:"idempotency" toml:"idempotency"`
+	RateLimit   RateLimit   `yaml:"rate_limit" toml:"rate_limit"`
+	BookCache   BookCache   `yaml:"book_cache" toml:"book_cache"`
+	Outbox      Outbox      `yaml:"outbox" toml:"outbox"`
+	Log         Log         `yaml:"log" toml:"log"`
+	Tracing     Tracing     `yaml:"tracing" toml:"tracing"`
+}
+
+type Server struct {
+	Addr              string   `yaml:"addr" toml:"addr" env:"SERVER_ADDR"`
+	ReadHeaderTimeout Duration `yaml:"read_header_timeout" toml:"read_header_timeout" env:"SERVER_READ_HEADER_TIMEOUT"`
+	ReadTimeout       Duration `yaml:"read_timeout" toml:"read_timeout" env:"SERVER_READ_TIMEOUT"`
+	WriteTimeout      Duration `yaml:"write_timeout" toml:"write_timeout" env:"SERVER_WRITE_TIMEOUT"`
+	IdleTimeout       Duration `yaml:"idle_timeout" toml:"idle_timeout" env:"SERVER_IDLE_TIMEOUT"`
+	// ShutdownTimeout bounds how long in-flight requests and workers get to finish after SIGTERM
+	ShutdownTimeout Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout" env:"SERVER_SHUTDOWN_TIMEOUT"`
+	// DrainDelay is how long /readyz fails before the listener closes, giving
+	// load balancers time to stop sending new requests
+	DrainDelay Duration `yaml:"drain_delay" toml:"drain_delay" env:"SERVER_DRAIN_DELAY"`
+	// HealthCheckTimeout bounds the dependency checks of /readyz
+	HealthCheckTimeout Duration `yaml:"health_check_timeout" toml:"health_check_timeout" env:"HEALTH_CHECK_TIMEOUT"`
+	// MaxBodyBytes is the largest request body accepted, larger ones get 413
+	MaxBodyBytes int `yaml:"max_body_bytes" toml:"max_body_bytes" env:"SERVER_MAX_BODY_BYTES"`
+	// HSTSMaxAge is sent in Strict-Transport-Security, zero leaves the header out
+	HSTSMaxAge Duration `yaml:"hsts_max_age" toml:"hsts_max_age" env:"HSTS_MAX_AGE"`
+	// TrustedProxies are the addresses or CIDR ranges whose X-Forwarded-For
+	// header is believed. The client IP of other requests is their peer address.
+	TrustedProxies []string `yaml:"trusted_proxies" toml:"trusted_proxies" env:"TRUSTED_PROXIES"`
+}
+
+type Database struct {
+	URL             string   `yaml:"url" toml:"url" env:"DATABASE_URL"`
+	MaxOpenConns    int      `yaml:"max_open_conns" toml:"max_open_conns" env:"DB_MAX_OPEN_CONNS"`
+	MaxIdleConns    int      `yaml:"max_idle_conns" toml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS"`
+	ConnMaxLifetime Duration `yaml:"conn_max_lifetime" toml:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME"`
+	ConnMaxIdleTime Duration `yaml:"conn_max_idle_time" toml:"conn_max_idle_time" env:"DB_CONN_MAX_IDLE_TIME"`
+	// ConnectTimeout bounds the initial ping at startup
+	ConnectTimeout Duration `yaml:"connect_timeout" toml:"connect_timeout" env:"DB_CONNECT_TIMEOUT"`
+	// QueryTimeout bounds every repository call, including transactions
+	QueryTimeout Duration `yaml:"query_timeout" toml:"query_timeout" env:"DB_QUERY_TIMEOUT"`
+	// StatementCacheSize is the number of prepared statements kept per
+	// connection. 0 sends every query unprepared, as PgBouncer in transaction
+	// pooling mode requires.
+	StatementCacheSize int `yaml:"statement_cache_size" toml:"statement_cache_size" env:"DB_STATEMENT_CACHE_SIZE"`
+	// Driver serves books through database/sql (stdlib) or a native pgx pool
+	// (pgxpool). Every other repository uses database/sql.
+	Driver string `yaml:"driver" toml:"driver" env:"DB_DRIVER"`
+	// MinConns is kept open by the pgx pool even when idle
+	MinConns int `yaml:"min_conns" toml:"min_conns" env:"DB_MIN_CONNS"`
+	// HealthCheckPeriod is how often the pgx pool checks its idle connections
+	HealthCheckPeriod Duration `yaml:"health_check_period" toml:"health_check_period" env:"DB_HEALTH_CHECK_PERIOD"`
+	// ReplicaURLs are read-only copies of DATABASE_URL that serve book reads,
+	// comma separated in the environment. They use the pool settings above.
+	ReplicaURLs []string `yaml:"replica_urls" toml:"replica_urls" env:"DATABASE_REPLICA_URLS"`
+	// ReplicaMaxLag takes a replica out of rotation while it is further behind
+	// the primary. 0 ignores the lag.
+	ReplicaMaxLag Duration `yaml:"replica_max_lag" toml:"replica_max_lag" env:"DB_REPLICA_MAX_LAG"`
+	// ReplicaCheckInterval is how often the replicas' health and lag are checked
+	ReplicaCheckInterval Duration `yaml:"replica_check_interval" toml:"replica_check_interval" env:"DB_REPLICA_CHECK_INTERVAL"`
+	// ReadYourWritesWindow sends a client's reads to the primary for this long
+	// after it changed something. It must cover ReplicaMaxLag plus
+	// ReplicaCheckInterval, the longest a replica in rotation may be behind.
+	ReadYourWritesWindow Duration `yaml:"read_your_writes_window" toml:"read_your_writes_window" env:"DB_READ_YOUR_WRITES_WINDOW"`
+}
+
+// DatabaseDrivers are the accepted values of Database.Driver
+var DatabaseDrivers = []string{"stdlib", "pgxpool"}
+
+// Auth holds the signing key location and the lifetime of every token the API hands out
+type Auth struct {
+	KeysDir              string   `yaml:"keys_dir" toml:"keys_dir" env:"JWT_KEYS_DIR"`
+	ActiveKID            string   `yaml:"active_kid" toml:"active_kid" env:"JWT_ACTIVE_KID"`
+	AccessTokenTTL       Duration `yaml:"access_token_ttl" toml:"access_token_ttl" env:"ACCESS_TOKEN_TTL"`
+	MFAChallengeTTL      Duration `yaml:"mfa_challenge_ttl" toml:"mfa_challenge_ttl" env:"MFA_CHALLENGE_TTL"`
+	ImpersonationTTL     Duration `yaml:"impersonation_ttl" toml:"impersonation_ttl" env:"IMPERSONATION_TTL"`
+	EmailVerificationTTL Duration `yaml:"email_verification_ttl" toml:"email_verification_ttl" env:"EMAIL_VERIFICATION_TTL"`
+	PasswordResetTTL     Duration `yaml:"password_reset_ttl" toml:"password_reset_ttl" env:"PASSWORD_RESET_TTL"`
+	OIDCFlowTTL          Duration `yaml:"oidc_flow_ttl" toml:"oidc_flow_ttl" env:"OIDC_FLOW_TTL"`
+}
+
+type Password struct {
+	Algorithm         string `yaml:"algorithm" toml:"algorithm" env:"PASSWORD_HASH_ALGORITHM"`
+	BcryptCost        int    `yaml:"bcrypt_cost" toml:"bcrypt_cost" env:"BCRYPT_COST"`
+	Argon2MemoryKiB   int    `yaml:"argon2_memory_kib" toml:"argon2_memory_kib" env:"ARGON2_MEMORY_KIB"`
+	Argon2Iterations  int    `yaml:"argon2_iterations" toml:"argon2_iterations" env:"ARGON2_ITERATIONS"`
+	Argon2Parallelism int    `yaml:"argon2_parallelism" toml:"argon2_parallelism" env:"ARGON2_PARALLELISM"`
+	MinLength         int    `yaml:"min_length" toml:"min_length" env:"PASSWORD_MIN_LENGTH"`
+	MaxLength         int    `yaml:"max_length" toml:"max_length" env:"PASSWORD_MAX_LENGTH"`
+	BreachedList      string `yaml:"breached_list" toml:"breached_list" env:"PASSWORD_BREACHED_LIST"`
+}
+
+// OIDC configures single sign-on. It is disabled while Issuer is empty.
+type OIDC struct {
+	Issuer       string `yaml:"issuer" toml:"issuer" env:"OIDC_ISSUER"`
+	ClientID     string `yaml:"client_id" toml:"client_id" env:"OIDC_CLIENT_ID"`
+	ClientSecret string `yaml:"client_secret" toml:"client_secret" env:"OIDC_CLIENT_SECRET"`
+	RedirectURL  string `yaml:"redirect_url" toml:"redirect_url" env:"OIDC_REDIRECT_URL"`
+}
+
+func (o OIDC) Enabled() bool {
+	return o.Issuer != ""
+}
+
+type CORS struct {
+	// AllowedOrigins is a comma separated list in the environment
+	AllowedOrigins []string `yaml:"allowed_origins" toml:"allowed_origins" env:"CORS_ALLOWED_ORIGINS"`
+}
+
+// Idempotency configures how long the responses of requests sent with an
+// Idempotency-Key are kept for replay
+type Idempotency struct {
+	KeyTTL Duration `yaml:"key_ttl" toml:"key_ttl" env:"IDEMPOTENCY_KEY_TTL"`
+	// LockTimeout is how long a request in flight holds its key. A retry after
+	// that runs again, so it must outlast any request that is still running.
+	LockTimeout Duration `yaml:"lock_timeout" toml:"lock_timeout" env:"IDEMPOTENCY_LOCK_TIMEOUT"`
+}
+
+// RateLimit configures the per-client token buckets. Limits are written as
+// requests per period, e.g. "300/1m".
+type RateLimit struct {
+	// Store is memory, which limits every instance on its own, or postgres,
+	// which shares the buckets between instances
+	Store string `yaml:"store" toml:"store" env:"RATE_LIMIT_STORE"`
+	// Default applies to every API route without a rule of its own. Empty leaves them unlimited.
+	Default string `yaml:"default" toml:"default" env:"RATE_LIMIT_DEFAULT"`
+	// Routes are rules such as "POST /v1/login=10/1m", comma separated in the environment
+	Routes []string `yaml:"routes" toml:"routes" env:"RATE_LIMIT_ROUTES"`
+}
+
+// RateLimitStores are the accepted values of RateLimit.Store
+var RateLimitStores = []string{"memory", "postgres"}
+
+// BookCache configures the in-process cache of book lookups by ID
+type BookCache struct {
+	// Size is the number of books each instance keeps. 0 disables the cache.
+	Size int      `yaml:"size" toml:"size" env:"BOOK_CACHE_SIZE"`
+	TTL  Duration `yaml:"ttl" toml:"ttl" env:"BOOK_CACHE_TTL"`
+	// Notify drops books changed through other instances as soon as Postgres
+	// notifies about the change, instead of when their TTL runs out
+	Notify bool `yaml:"notify" toml:"notify" env:"BOOK_CACHE_NOTIFY"`
+}
+
+// Outbox configures the delivery of book change events recorded in the outbox
+type Outbox struct {
+	Sink          string `yaml:"sink" toml:"sink" env:"OUTBOX_SINK"`
+	WebhookURL    string `yaml:"webhook_url" toml:"webhook_url" env:"OUTBOX_WEBHOOK_URL"`
+	WebhookSecret string `yaml:"webhook_secret" toml:"webhook_secret" env:"OUTBOX_WEBHOOK_SECRET"`
+	// BatchSize is the number of events claimed per poll
+	BatchSize       int      `yaml:"batch_size" toml:"batch_size" env:"OUTBOX_BATCH_SIZE"`
+	PollInterval    Duration `yaml:"poll_interval" toml:"poll_interval" env:"OUTBOX_POLL_INTERVAL"`
+	DeliveryTimeout Duration `yaml:"delivery_timeout" toml:"delivery_timeout" env:"OUTBOX_DELIVERY_TIMEOUT"`
+	// MaxBackoff caps the doubling delay between attempts of a failing event
+	MaxBackoff Duration `yaml:"max_backoff" toml:"max_backoff" env:"OUTBOX_MAX_BACKOFF"`
+	// Retention is how long delivered events are kept before they are deleted
+	Retention Duration `yaml:"retention" toml:"retention" env:"OUTBOX_RETENTION"`
+}
+
+// OutboxSinks are the accepted values of Outbox.Sink
+var OutboxSinks = []string{"log", "webhook"}
+
+type Log struct {
+	Level string `yaml:"level" toml:"level" env:"LOG_LEVEL"`
+}
+
+// LogLevels are the accepted values of Log.Level
+var LogLevels = []string{"debug", "info", "warn", "error"}
+
+// Tracing selects where OpenTelemetry spans are sent. The OTLP exporter reads
+// its endpoint and headers from the standard OTEL_EXPORTER_OTLP_* variables.
+type Tracing struct {
+	Exporter    string  `yaml:"exporter" toml:"exporter" env:"TRACING_EXPORTER"`
+	ServiceName string  `yaml:"service_name" toml:"service_name" env:"OTEL_SERVICE_NAME"`
+	SampleRatio float64 `yaml:"sample_ratio" toml:"sample_ratio" env:"TRACING_SAMPLE_RATIO"`
+}
+
+// TracingExporters are the accepted values of Tracing.Exporter
+var TracingExporters = []string{"none", "stdout", "otlp"}
+
+// Default returns the configuration used for every value that is not set
+func Default() Config {
+	return Config{
+		Server: Server{
+			Addr:               ":8080",
+			ReadHeaderTimeout:  Duration{5 * time.Second},
+			ReadTimeout:        Duration{15 * time.Second},
+			WriteTimeout:       Duration{30 * time.Second},
+			IdleTimeout:        Duration{2 * time.Minute},
+			ShutdownTimeout:    Duration{10 * time.Second},
+			HealthCheckTimeout: Duration{2 * time.Second},
+			MaxBodyBytes:       1 << 20,
+			HSTSMaxAge:         Duration{365 * 24 * time.Hour},
+		},
+		Database: Database{
+			MaxOpenConns:         25,
+			MaxIdleConns:         25,
+			ConnMaxLifetime:      Duration{30 * time.Minute},
+			ConnMaxIdleTime:      Duration{5 * time.Minute},
+			ConnectTimeout:       Duration{10 * time.Second},
+			QueryTimeout:         Duration{5 * time.Second},
+			StatementCacheSize:   512,
+			Driver:               "stdlib",
+			HealthCheckPeriod:    Duration{time.Minute},
+			ReplicaMaxLag:        Duration{10 * time.Second},
+			ReplicaCheckInterval: Duration{5 * time.Second},
+			ReadYourWritesWindow: Duration{15 * time.Second},
+		},
+		Auth: Auth{
+			AccessTokenTTL:       Duration{24 * time.Hour},
+			MFAChallengeTTL:      Duration{5 * time.Minute},
+			ImpersonationTTL:     Duration{time.Hour},
+			EmailVerificationTTL: Duration{24 * time.Hour},
+			PasswordResetTTL:     Duration{72 * time.Hour},
+			OIDCFlowTTL:          Duration{10 * time.Minute},
+		},
+		Password: Password{
+			Algorithm:         "bcrypt",
+			BcryptCost:        10,
+			Argon2MemoryKiB:   64 * 1024,
+			Argon2Iterations:  3,
+			Argon2Parallelism: 4,
+			MinLength:         8,
+			MaxLength:         128,
+		},
+		Idempotency: Idempotency{KeyTTL: Duration{24 * time.Hour}, LockTimeout: Duration{time.Minute}},
+		RateLimit: RateLimit{
+			Store:   "memory",
+			Default: "300/1m",
+			Routes: []string{
+				"POST /v1/login=10/1m",
+				"POST /v1/login/mfa=10/1m",
+				"POST /v1/register=10/1h",
+				"POST /v1/verify-email=10/1h",
+				"POST /v1/reset-password=10/1h",
+			},
+		},
+		BookCache: BookCache{Size: 1000, TTL: Duration{time.Minute}},
+		Outbox: Outbox{
+			Sink:            "log",
+			BatchSize:       100,
+			PollInterval:    Duration{time.Second},
+			DeliveryTimeout: Duration{10 * time.Second},
+			MaxBackoff:      Duration{10 * time.Minute},
+			Retention:       Duration{7 * 24 * time.Hour},
+		},
+		Log: Log{Level: "info"},
+		Tracing: Tracing{
+			Exporter:    "none",
+			ServiceName: "bookstore-api",
+			SampleRatio: 1,
+		},
+	}
+}
+
+// Load reads .env into the environment and builds the configuration from the
+// file named by CONFIG_FILE, if any, and the environment
+func Load() (*Config, error) {
+	if err := godotenv.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf(".env: %w", err)
+	}
+	return LoadFile(os.Getenv("CONFIG_FILE"))
+}
+
+// LoadFile builds the configuration from defaults, the YAML (.yaml, .yml) or
+// TOML (.toml) file at path and the environment, then validates it. An empty
+// path skips the file.
+func LoadFile(path string) (*Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		if err := decodeFile(path, &cfg); err != nil {
+			return nil, fmt.Errorf("config file %s: %w", path, err)
+		}
+	}
+
+	if err := applyEnv(reflect.ValueOf(&cfg).Elem()); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+func decodeFile(path string, cfg *Config) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(content))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		return nil
+	case ".toml":
+		return toml.NewDecoder(bytes.NewReader(content)).DisallowUnknownFields().Decode(cfg)
+	default:
+		return fmt.Errorf("unsupported format %q, use .yaml, .yml or .toml", filepath.Ext(path))
+	}
+}
+
+// applyEnv overrides every field tagged with env whose variable is set
+func applyEnv(v reflect.Value) error {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		fieldType := v.Type().Field(i)
+
+		name, tagged := fieldType.Tag.Lookup("env")
+		if !tagged {
+			if field.Kind() == reflect.Struct && field.Type() != reflect.TypeOf(Duration{}) {
+				if err := applyEnv(field); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := setField(field, strings.TrimSpace(value)); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func setField(field reflect.Value, value string) error {
+	switch target := field.Addr().Interface().(type) {
+	case *string:
+		*target = value
+	case *int:
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", value)
+		}
+		*target = parsed
+	case *float64:
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", value)
+		}
+		*target = parsed
+	case *bool:
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", value)
+		}
+		*target = parsed
+	case *Duration:
+		if err := target.UnmarshalText([]byte(value)); err != nil {
+			return fmt.Errorf("%q is not a duration such as 30s or 24h", value)
+		}
+	case *[]string:
+		*target = nil
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				*target = append(*target, item)
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported config field type %s", field.Type())
+	}
+	return nil
+}
+
+// Validate reports every invalid value at once so a broken deployment can be fixed in one go
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Server.Addr != "", "SERVER_ADDR must not be empty")
+	check(c.Server.ReadHeaderTimeout.Duration > 0, "SERVER_READ_HEADER_TIMEOUT must be positive")
+	check(c.Server.ReadTimeout.Duration > 0, "SERVER_READ_TIMEOUT must be positive")
+	check(c.Server.WriteTimeout.Duration > 0, "SERVER_WRITE_TIMEOUT must be positive")
+	check(c.Server.IdleTimeout.Duration > 0, "SERVER_IDLE_TIMEOUT must be positive")
+	check(c.Server.ShutdownTimeout.Duration > 0, "SERVER_SHUTDOWN_TIMEOUT must be positive")
+	check(c.Server.DrainDelay.Duration >= 0, "SERVER_DRAIN_DELAY must not be negative")
+	check(c.Server.HealthCheckTimeout.Duration > 0, "HEALTH_CHECK_TIMEOUT must be positive")
+	check(c.Server.MaxBodyBytes > 0, "SERVER_MAX_BODY_BYTES must be positive")
+	check(c.Server.HSTSMaxAge.Duration >= 0, "HSTS_MAX_AGE must not be negative")
+	for _, proxy := range c.Server.TrustedProxies {
+		check(isIPOrCIDR(proxy), "TRUSTED_PROXIES entry %q must be an IP address or CIDR range", proxy)
+	}
+
+	check(c.Database.URL != "", "DATABASE_URL is required")
+	check(c.Database.MaxOpenConns > 0, "DB_MAX_OPEN_CONNS must be positive")
+	check(c.Database.MaxIdleConns >= 0 && c.Database.MaxIdleConns <= c.Database.MaxOpenConns,
+		"DB_MAX_IDLE_CONNS must be between 0 and DB_MAX_OPEN_CONNS (%d)", c.Database.MaxOpenConns)
+	check(c.Database.ConnMaxLifetime.Duration >= 0, "DB_CONN_MAX_LIFETIME must not be negative")
+	check(c.Database.ConnMaxIdleTime.Duration >= 0, "DB_CONN_MAX_IDLE_TIME must not be negative")
+	check(c.Database.ConnectTimeout.Duration > 0, "DB_CONNECT_TIMEOUT must be positive")
+	check(c.Database.QueryTimeout.Duration > 0, "DB_QUERY_TIMEOUT must be positive")
+	check(slices.Contains(DatabaseDrivers, c.Database.Driver), "DB_DRIVER must be one of %s, got %q", strings.Join(DatabaseDrivers, ", "), c.Database.Driver)
+	check(c.Database.MinConns >= 0 && c.Database.MinConns <= c.Database.MaxOpenConns,
+		"DB_MIN_CONNS must be between 0 and DB_MAX_OPEN_CONNS (%d)", c.Database.MaxOpenConns)
+	check(c.Database.HealthCheckPeriod.Duration > 0, "DB_HEALTH_CHECK_PERIOD must be positive")
+	check(c.Database.StatementCacheSize >= 0, "DB_STATEMENT_CACHE_SIZE must not be negative")
+	for _, url := range c.Database.ReplicaURLs {
+		check(url != "", "DATABASE_REPLICA_URLS must not contain empty entries")
+	}
+	check(c.Database.ReplicaMaxLag.Duration >= 0, "DB_REPLICA_MAX_LAG must not be negative")
+	check(c.Database.ReplicaCheckInterval.Duration > 0, "DB_REPLICA_CHECK_INTERVAL must be positive")
+	check(c.Database.ReadYourWritesWindow.Duration >= 0, "DB_READ_YOUR_WRITES_WINDOW must not be negative")
+	// A replica is only dropped at the next check once it falls behind, so
+	// until then it may serve reads up to this far behind
+	if staleness := c.Database.ReplicaMaxLag.Duration + c.Database.ReplicaCheckInterval.Duration; len(c.Database.ReplicaURLs) > 0 && c.Database.ReplicaMaxLag.Duration > 0 {
+		check(c.Database.ReadYourWritesWindow.Duration >= staleness,
+			"DB_READ_YOUR_WRITES_WINDOW must be at least DB_REPLICA_MAX_LAG plus DB_REPLICA_CHECK_INTERVAL (%s)", staleness)
+	}
+
+	for _, ttl := range []struct {
+		name  string
+		value Duration
+	}{
+		{"ACCESS_TOKEN_TTL", c.Auth.AccessTokenTTL},
+		{"MFA_CHALLENGE_TTL", c.Auth.MFAChallengeTTL},
+		{"IMPERSONATION_TTL", c.Auth.ImpersonationTTL},
+		{"EMAIL_VERIFICATION_TTL", c.Auth.EmailVerificationTTL},
+		{"PASSWORD_RESET_TTL", c.Auth.PasswordResetTTL},
+		{"OIDC_FLOW_TTL", c.Auth.OIDCFlowTTL},
+		{"IDEMPOTENCY_KEY_TTL", c.Idempotency.KeyTTL},
+	} {
+		check(ttl.value.Duration > 0, "%s must be positive", ttl.name)
+	}
+	check(c.Idempotency.LockTimeout.Duration >= c.Server.WriteTimeout.Duration,
+		"IDEMPOTENCY_LOCK_TIMEOUT must be at least SERVER_WRITE_TIMEOUT (%s)", c.Server.WriteTimeout.Duration)
+
+	check(c.Password.Algorithm == "bcrypt" || c.Password.Algorithm == "argon2id",
+		"PASSWORD_HASH_ALGORITHM must be bcrypt or argon2id, got %q", c.Password.Algorithm)
+	check(c.Password.BcryptCost >= 4 && c.Password.BcryptCost <= 31, "BCRYPT_COST must be between 4 and 31")
+	check(c.Password.Argon2Iterations > 0, "ARGON2_ITERATIONS must be positive")
+	check(c.Password.Argon2Parallelism > 0 && c.Password.Argon2Parallelism <= 255, "ARGON2_PARALLELISM must be between 1 and 255")
+	check(c.Password.Argon2MemoryKiB >= 8*c.Password.Argon2Parallelism, "ARGON2_MEMORY_KIB must be at least 8 times ARGON2_PARALLELISM")
+	check(c.Password.MinLength > 0, "PASSWORD_MIN_LENGTH must be positive")
+	check(c.Password.MaxLength >= c.Password.MinLength, "PASSWORD_MAX_LENGTH must not be below PASSWORD_MIN_LENGTH")
+
+	if c.OIDC.Enabled() {
+		check(c.OIDC.ClientID != "", "OIDC_CLIENT_ID is required when OIDC_ISSUER is set")
+		check(c.OIDC.ClientSecret != "", "OIDC_CLIENT_SECRET is required when OIDC_ISSUER is set")
+		check(isAbsoluteURL(c.OIDC.Issuer), "OIDC_ISSUER must be an absolute URL")
+		check(isAbsoluteURL(c.OIDC.RedirectURL), "OIDC_REDIRECT_URL must be an absolute URL")
+	}
+
+	for _, origin := range c.CORS.AllowedOrigins {
+		check(origin == "*" || isOrigin(origin), "CORS_ALLOWED_ORIGINS entry %q must be * or an origin such as https://shop.example.com", origin)
+	}
+
+	check(slices.Contains(RateLimitStores, c.RateLimit.Store), "RATE_LIMIT_STORE must be one of %s, got %q", strings.Join(RateLimitStores, ", "), c.RateLimit.Store)
+	if _, err := ratelimit.ParseRules(c.RateLimit.Default, c.RateLimit.Routes); err != nil {
+		check(false, "RATE_LIMIT_DEFAULT or RATE_LIMIT_ROUTES: %v", err)
+	}
+
+	check(c.BookCache.Size >= 0, "BOOK_CACHE_SIZE must not be negative")
+	check(c.BookCache.Size == 0 || c.BookCache.TTL.Duration > 0, "BOOK_CACHE_TTL must be positive")
+
+	check(slices.Contains(OutboxSinks, c.Outbox.Sink), "OUTBOX_SINK must be one of %s, got %q", strings.Join(OutboxSinks, ", "), c.Outbox.Sink)
+	if c.Outbox.Sink == "webhook" {
+		check(isAbsoluteURL(c.Outbox.WebhookURL), "OUTBOX_WEBHOOK_URL must be an absolute URL when OUTBOX_SINK is webhook")
+	}
+	check(c.Outbox.BatchSize > 0, "OUTBOX_BATCH_SIZE must be positive")
+	check(c.Outbox.PollInterval.Duration > 0, "OUTBOX_POLL_INTERVAL must be positive")
+	check(c.Outbox.DeliveryTimeout.Duration > 0, "OUTBOX_DELIVERY_TIMEOUT must be positive")
+	check(c.Outbox.MaxBackoff.Duration > 0, "OUTBOX_MAX_BACKOFF must be positive")
+	check(c.Outbox.Retention.Duration > 0, "OUTBOX_RETENTION must be positive")
+
+	check(slices.Contains(LogLevels, c.Log.Level), "LOG_LEVEL must be one of %s, got %q", strings.Join(LogLevels, ", "), c.Log.Level)
+
+	check(slices.Contains(TracingExporters, c.Tracing.Exporter), "TRACING_EXPORTER must be one of %s, got %q", strings.Join(TracingExporters, ", "), c.Tracing.Exporter)
+	check(c.Tracing.ServiceName != "", "OTEL_SERVICE_NAME must not be empty")
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "TRACING_SAMPLE_RATIO must be between 0 and 1")
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration:\n%w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// isOrigin reports whether value is a browser origin: a scheme and host with an optional port and nothing else
+func isOrigin(value string) bool {
+	parsed, err := url.Parse(value)
+	return err == nil && isAbsoluteURL(value) && (parsed.Path == "" || parsed.Path == "/") &&
+		parsed.User == nil && parsed.RawQuery == "" && parsed.Fragment == ""
+}
+
+func isIPOrCIDR(value string) bool {
+	if _, err := netip.ParsePrefix(value); err == nil {
+		return true
+	}
+	_, err := netip.ParseAddr(value)
+	return err == nil
+}
+
+func isAbsoluteURL(value string) bool {
+	parsed, err := url.Parse(value)
+	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
@@ -0,0 +1,235 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write %s: %v", name, err)
+	}
+	return path
+}
+
+func TestLoadFileDefaultsAndEnv(t *testing.T) {
+	t.Setenv("DATABASE_URL", "postgres://localhost/bookstore")
+	t.Setenv("DB_MAX_OPEN_CONNS", "40")
+	t.Setenv("ACCESS_TOKEN_TTL", "2h")
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://shop.example.com, https://admin.example.com")
+	t.Setenv("TRACING_SAMPLE_RATIO", "0.25")
+	t.Setenv("DATABASE_REPLICA_URLS", "postgres://replica-1/bookstore, postgres://replica-2/bookstore")
+
+	cfg, err := LoadFile("")
+	if err != nil {
+		t.Fatalf("LoadFile() failed: %v", err)
+	}
+
+	if cfg.Server.Addr != ":8080" {
+		t.Errorf("Expected default address :8080 but got %q", cfg.Server.Addr)
+	}
+	if cfg.Database.MaxOpenConns != 40 {
+		t.Errorf("Expected 40 open connections but got %d", cfg.Database.MaxOpenConns)
+	}
+	if len(cfg.Database.ReplicaURLs) != 2 || cfg.Database.ReplicaURLs[1] != "postgres://replica-2/bookstore" {
+		t.Errorf("Unexpected replica URLs: %v", cfg.Database.ReplicaURLs)
+	}
+	if cfg.Auth.AccessTokenTTL.Duration != 2*time.Hour {
+		t.Errorf("Expected access token TTL 2h but got %s", cfg.Auth.AccessTokenTTL)
+	}
+	if cfg.Auth.MFAChallengeTTL.Duration != 5*time.Minute {
+		t.Errorf("Expected default MFA challenge TTL 5m but got %s", cfg.Auth.MFAChallengeTTL)
+	}
+	if len(cfg.CORS.AllowedOrigins) != 2 || cfg.CORS.AllowedOrigins[1] != "https://admin.example.com" {
+		t.Errorf("Unexpected CORS origins: %v", cfg.CORS.AllowedOrigins)
+	}
+	if cfg.Tracing.SampleRatio != 0.25 || cfg.Tracing.Exporter != "none" {
+		t.Errorf("Unexpected tracing config %+v", cfg.Tracing)
+	}
+}
+
+func TestLoadFileFormats(t *testing.T) {
+	files := map[string]string{
+		"config.yaml": `
+database:
+  url: postgres://db/bookstore
+  max_idle_conns: 5
+auth:
+  impersonation_ttl: 30m
+log:
+  level: debug
+`,
+		"config.toml": `
+[database]
+url = "postgres://db/bookstore"
+max_idle_conns = 5
+
+[auth]
+impersonation_ttl = "30m"
+
+[log]
+level = "debug"
+`,
+	}
+
+	for name, content := range files {
+		cfg, err := LoadFile(writeFile(t, name, content))
+		if err != nil {
+			t.Errorf("%s: LoadFile() failed: %v", name, err)
+			continue
+		}
+		if cfg.Database.URL != "postgres://db/bookstore" || cfg.Database.MaxIdleConns != 5 {
+			t.Errorf("%s: unexpected database config %+v", name, cfg.Database)
+		}
+		if cfg.Auth.ImpersonationTTL.Duration != 30*time.Minute {
+			t.Errorf("%s: expected impersonation TTL 30m but got %s", name, cfg.Auth.ImpersonationTTL)
+		}
+		if cfg.Log.Level != "debug" {
+			t.Errorf("%s: expected log level debug but got %q", name, cfg.Log.Level)
+		}
+	}
+}
+
+func TestEnvOverridesFile(t *testing.T) {
+	path := writeFile(t, "config.yaml", "database:\n  url: postgres://file/bookstore\n")
+	t.Setenv("DATABASE_URL", "postgres://env/bookstore")
+
+	cfg, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile() failed: %v", err)
+	}
+	if cfg.Database.URL != "postgres://env/bookstore" {
+		t.Errorf("Expected the environment to win but got %q", cfg.Database.URL)
+	}
+}
+
+func TestLoadFileRejectsInvalidConfig(t *testing.T) {
+	cases := []struct {
+		name     string
+		env      map[string]string
+		expected []string
+	}{
+		{
+			name:     "missing database url",
+			env:      map[string]string{},
+			expected: []string{"DATABASE_URL is required"},
+		},
+		{
+			name: "several invalid values",
+			env: map[string]string{
+				"DATABASE_URL":      "postgres://localhost/bookstore",
+				"DB_MAX_IDLE_CONNS": "100",
+				"LOG_LEVEL":         "verbose",
+				"OIDC_ISSUER":       "https://login.example.com",
+			},
+			expected: []string{"DB_MAX_IDLE_CONNS", "LOG_LEVEL", "OIDC_CLIENT_ID is required"},
+		},
+		{
+			name:     "malformed duration",
+			env:      map[string]string{"DATABASE_URL": "postgres://localhost/bookstore", "ACCESS_TOKEN_TTL": "1 day"},
+			expected: []string{"ACCESS_TOKEN_TTL", "not a duration"},
+		},
+		{
+			name: "invalid rate limits",
+			env: map[string]string{
+				"DATABASE_URL":      "postgres://localhost/bookstore",
+				"RATE_LIMIT_STORE":  "redis",
+				"RATE_LIMIT_ROUTES": "POST /v1/login=ten/1m",
+				"TRUSTED_PROXIES":   "10.0.0.0/8,gateway",
+			},
+			expected: []string{"RATE_LIMIT_STORE", "RATE_LIMIT_ROUTES", `TRUSTED_PROXIES entry "gateway"`},
+		},
+		{
+			name: "invalid request hardening",
+			env: map[string]string{
+				"DATABASE_URL":          "postgres://localhost/bookstore",
+				"CORS_ALLOWED_ORIGINS":  "https://shop.example.com/checkout",
+				"SERVER_MAX_BODY_BYTES": "0",
+			},
+			expected: []string{`CORS_ALLOWED_ORIGINS entry "https://shop.example.com/checkout"`, "SERVER_MAX_BODY_BYTES"},
+		},
+		{
+			name: "invalid connection pool",
+			env: map[string]string{
+				"DATABASE_URL":              "postgres://localhost/bookstore",
+				"DB_DRIVER":                 "pgbouncer",
+				"DB_MIN_CONNS":              "30",
+				"DB_STATEMENT_CACHE_SIZE":   "-1",
+				"DB_REPLICA_CHECK_INTERVAL": "0s",
+			},
+			expected: []string{"DB_DRIVER", "DB_MIN_CONNS", "DB_STATEMENT_CACHE_SIZE", "DB_REPLICA_CHECK_INTERVAL"},
+		},
+		{
+			name: "read-your-writes window shorter than replica staleness",
+			env: map[string]string{
+				"DATABASE_URL":               "postgres://localhost/bookstore",
+				"DATABASE_REPLICA_URLS":      "postgres://replica-1/bookstore",
+				"DB_REPLICA_MAX_LAG":         "10s",
+				"DB_REPLICA_CHECK_INTERVAL":  "5s",
+				"DB_READ_YOUR_WRITES_WINDOW": "5s",
+			},
+			expected: []string{"DB_READ_YOUR_WRITES_WINDOW must be at least DB_REPLICA_MAX_LAG plus DB_REPLICA_CHECK_INTERVAL (15s)"},
+		},
+		{
+			name: "idempotency lock shorter than a request",
+			env: map[string]string{
+				"DATABASE_URL":             "postgres://localhost/bookstore",
+				"SERVER_WRITE_TIMEOUT":     "30s",
+				"IDEMPOTENCY_LOCK_TIMEOUT": "10s",
+			},
+			expected: []string{"IDEMPOTENCY_LOCK_TIMEOUT must be at least SERVER_WRITE_TIMEOUT (30s)"},
+		},
+		{
+			name: "invalid book cache",
+			env: map[string]string{
+				"DATABASE_URL":    "postgres://localhost/bookstore",
+				"BOOK_CACHE_SIZE": "-1",
+				"BOOK_CACHE_TTL":  "0s",
+			},
+			expected: []string{"BOOK_CACHE_SIZE", "BOOK_CACHE_TTL"},
+		},
+		{
+			name: "invalid outbox",
+			env: map[string]string{
+				"DATABASE_URL":         "postgres://localhost/bookstore",
+				"OUTBOX_SINK":          "webhook",
+				"OUTBOX_WEBHOOK_URL":   "hooks.example.com/books",
+				"OUTBOX_BATCH_SIZE":    "0",
+				"OUTBOX_POLL_INTERVAL": "0s",
+			},
+			expected: []string{"OUTBOX_WEBHOOK_URL", "OUTBOX_BATCH_SIZE", "OUTBOX_POLL_INTERVAL"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("DATABASE_URL", "")
+			os.Unsetenv("DATABASE_URL")
+			for name, value := range tc.env {
+				t.Setenv(name, value)
+			}
+
+			_, err := LoadFile("")
+			if err == nil {
+				t.Fatal("Expected an error")
+			}
+			for _, message := range tc.expected {
+				if !strings.Contains(err.Error(), message) {
+					t.Errorf("Expected error to mention %q, got: %v", message, err)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadFileRejectsUnknownKeys(t *testing.T) {
+	path := writeFile(t, "config.yaml", "database:\n  url: postgres://db/bookstore\n  max_conns: 5\n")
+	if _, err := LoadFile(path); err == nil {
+		t.Error("Expected an error for an unknown key")
+	}
+}
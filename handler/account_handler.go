@@ -0,0 +1,243 @@
+package handler
+
+import (
+	"bookstore-api/auth"
+	"bookstore-api/model"
+	"bookstore-api/repository"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetMeHandler returns the profile of the authenticated user
+func (h *UserHandler) GetMeHandler(c *gin.Context){
+	user, err := h.repo.GetUserByID(c.Request.Context(), c.GetInt64(contextUserID))
+	if err != nil{
+		ErrorHandler(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// UpdateMeHandler changes the name immediately. A new email is only applied
+// after the user confirms it through the link sent to that address.
+func (h *UserHandler) UpdateMeHandler(c *gin.Context){
+	var input struct{
+		Name	*string `json:"name" binding:"omitempty,min=1"`
+		Email	*string `json:"email" binding:"omitempty,email"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil{
+		c.JSON(http.StatusBadRequest, model.AppError{
+			Code: http.StatusBadRequest,
+			Message: "Invalid input: " + err.Error(),
+		})
+		return
+	}
+
+	userID := c.GetInt64(contextUserID)
+
+	if input.Name != nil{
+		name := strings.TrimSpace(*input.Name)
+		if name == ""{
+			c.JSON(http.StatusBadRequest, model.AppError{
+				Code: http.StatusBadRequest,
+				Message: "Invalid input: name must not be empty",
+			})
+			return
+		}
+		if err := h.repo.UpdateName(c.Request.Context(), userID, name); err != nil{
+			ErrorHandler(c, err)
+			return
+		}
+	}
+
+	user, err := h.repo.GetUserByID(c.Request.Context(), userID)
+	if err != nil{
+		ErrorHandler(c, err)
+		return
+	}
+
+	response := gin.H{"user": user}
+
+	if input.Email != nil && !strings.EqualFold(*input.Email, user.Email){
+		if err := h.startEmailChange(c.Request.Context(), user, *input.Email); err != nil{
+			ErrorHandler(c, err)
+			return
+		}
+		response["pending_email"] = *input.Email
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// startEmailChange stores the pending change and mails the verification token to the new address
+func (h *UserHandler) startEmailChange(ctx context.Context, user model.User, newEmail string) error{
+	token, tokenHash, err := auth.NewOpaqueToken()
+	if err != nil{
+		return err
+	}
+
+	err = h.repo.CreateEmailChange(ctx, user.ID, newEmail, tokenHash, time.Now().Add(h.auth.EmailVerificationTTL.Duration))
+	if err != nil{
+		return err
+	}
+
+	body := fmt.Sprintf("Hi %s,\n\nConfirm your new email address by sending this token to POST /v1/verify-email:\n\n%s\n\nThe token expires in %s.", user.Name, token, describeTTL(h.auth.EmailVerificationTTL.Duration))
+	return h.mailer.Send(newEmail, "Confirm your new email address", body)
+}
+
+// describeTTL spells out a token lifetime for an email, in the largest unit
+// that divides it, e.g. "24 hours" or "90 minutes"
+func describeTTL(ttl time.Duration) string{
+	count, unit := int64(ttl.Round(time.Second) / time.Second), "second"
+	switch{
+	case ttl >= time.Hour && ttl % time.Hour == 0:
+		count, unit = int64(ttl / time.Hour), "hour"
+	case ttl >= time.Minute && ttl % time.Minute == 0:
+		count, unit = int64(ttl / time.Minute), "minute"
+	}
+	if count == 1{
+		return "1 " + unit
+	}
+	return fmt.Sprintf("%d %ss", count, unit)
+}
+
+// VerifyEmailHandler applies a pending email change using the token from the verification email
+func (h *UserHandler) VerifyEmailHandler(c *gin.Context){
+	var input struct{
+		Token	string `json:"token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil{
+		c.JSON(http.StatusBadRequest, model.AppError{
+			Code: http.StatusBadRequest,
+			Message: "Invalid input: " + err.Error(),
+		})
+		return
+	}
+
+	user, err := h.repo.ConfirmEmailChange(c.Request.Context(), auth.HashToken(input.Token))
+	if err != nil{
+		ErrorHandler(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// ChangePasswordHandler replaces the password after checking the current one
+func (h *UserHandler) ChangePasswordHandler(c *gin.Context){
+	var input struct{
+		CurrentPassword	string `json:"current_password" binding:"required"`
+		NewPassword		string `json:"new_password" binding:"required,min=6"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil{
+		c.JSON(http.StatusBadRequest, model.AppError{
+			Code: http.StatusBadRequest,
+			Message: "Invalid input: " + err.Error(),
+		})
+		return
+	}
+
+	user, err := h.verifyCurrentPassword(c.Request.Context(), c.GetInt64(contextUserID), input.CurrentPassword)
+	if err != nil{
+		ErrorHandler(c, err)
+		return
+	}
+
+	if err := h.policy.Validate(input.NewPassword, user.Name, user.Email); err != nil{
+		rejectPassword(c, err)
+		return
+	}
+
+	if err := h.repo.UpdatePassword(c.Request.Context(), user.ID, input.NewPassword); err != nil{
+		ErrorHandler(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Password updated successfully",
+	})
+}
+
+// DeleteMeHandler permanently deletes the account after re-checking the password
+func (h *UserHandler) DeleteMeHandler(c *gin.Context){
+	var input struct{
+		Password	string `json:"password" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil{
+		c.JSON(http.StatusBadRequest, model.AppError{
+			Code: http.StatusBadRequest,
+			Message: "Invalid input: " + err.Error(),
+		})
+		return
+	}
+
+	user, err := h.verifyCurrentPassword(c.Request.Context(), c.GetInt64(contextUserID), input.Password)
+	if err != nil{
+		ErrorHandler(c, err)
+		return
+	}
+
+	if err := h.repo.DeleteUser(c.Request.Context(), user.ID); err != nil{
+		ErrorHandler(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ResetPasswordHandler sets a new password using the token mailed by an admin-forced reset
+func (h *UserHandler) ResetPasswordHandler(c *gin.Context){
+	var input struct{
+		Token		string `json:"token" binding:"required"`
+		NewPassword	string `json:"new_password" binding:"required,min=6"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil{
+		c.JSON(http.StatusBadRequest, model.AppError{
+			Code: http.StatusBadRequest,
+			Message: "Invalid input: " + err.Error(),
+		})
+		return
+	}
+
+	if err := h.policy.Validate(input.NewPassword); err != nil{
+		rejectPassword(c, err)
+		return
+	}
+
+	if err := h.repo.ResetPassword(c.Request.Context(), auth.HashToken(input.Token), input.NewPassword); err != nil{
+		ErrorHandler(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Password updated successfully",
+	})
+}
+
+// verifyCurrentPassword loads the user and checks the password they typed
+func (h *UserHandler) verifyCurrentPassword(ctx context.Context, userID int64, password string) (model.User, error){
+	user, err := h.repo.GetUserByID(ctx, userID)
+	if err != nil{
+		return user, err
+	}
+
+	user, err = h.repo.Login(ctx, user.Email, password)
+	if err != nil{
+		if err == repository.ErrUserNotFound{
+			return user, err
+		}
+		return user, repository.ErrInvalidPassword
+	}
+	return user, nil
+}
@@ -0,0 +1,351 @@
+package handler
+
+import (
+	"bookstore-api/config"
+	"bookstore-api/model"
+	"bookstore-api/password"
+	"bookstore-api/repository"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// memoryUsers is an in-memory user repository. Passwords are kept in plain
+// text; the TOTP enrollment methods are left to the embedded nil userStore
+// and panic.
+type memoryUsers struct {
+	userStore
+	users			map[int64]model.User
+	passwords		map[int64]string
+	emailChanges	map[string]pendingEmail
+	resets			map[string]pendingEmail
+	identities		map[string]int64
+	totpSteps		map[int64]int64
+	recoveryCodes	map[string]int64
+	challenges		map[string]*mfaChallenge
+}
+
+// pendingEmail is a token mailed to a user that expires, for an email change or a password reset
+type pendingEmail struct {
+	userID		int64
+	email		string
+	expiresAt	time.Time
+}
+
+func newMemoryUsers(users ...model.User) *memoryUsers{
+	m := &memoryUsers{
+		users: map[int64]model.User{},
+		passwords: map[int64]string{},
+		emailChanges: map[string]pendingEmail{},
+		resets: map[string]pendingEmail{},
+		identities: map[string]int64{},
+		totpSteps: map[int64]int64{},
+		recoveryCodes: map[string]int64{},
+		challenges: map[string]*mfaChallenge{},
+	}
+	for _, user := range users{
+		m.passwords[user.ID] = user.Password
+		user.Password = ""
+		m.users[user.ID] = user
+	}
+	return m
+}
+
+func (m *memoryUsers) GetUserByID(ctx context.Context, id int64) (model.User, error){
+	user, ok := m.users[id]
+	if !ok{
+		return user, repository.ErrUserNotFound
+	}
+	return user, nil
+}
+
+func (m *memoryUsers) Login(ctx context.Context, email, plaintext string) (model.User, error){
+	for id, user := range m.users{
+		if user.Email == email{
+			if m.passwords[id] != plaintext{
+				return model.User{}, repository.ErrInvalidPassword
+			}
+			return user, nil
+		}
+	}
+	return model.User{}, repository.ErrUserNotFound
+}
+
+func (m *memoryUsers) UpdateName(ctx context.Context, userID int64, name string) error{
+	user, ok := m.users[userID]
+	if !ok{
+		return repository.ErrUserNotFound
+	}
+	user.Name = name
+	m.users[userID] = user
+	return nil
+}
+
+func (m *memoryUsers) UpdatePassword(ctx context.Context, userID int64, password string) error{
+	if _, ok := m.users[userID]; !ok{
+		return repository.ErrUserNotFound
+	}
+	m.passwords[userID] = password
+	return nil
+}
+
+func (m *memoryUsers) DeleteUser(ctx context.Context, userID int64) error{
+	if _, ok := m.users[userID]; !ok{
+		return repository.ErrUserNotFound
+	}
+	delete(m.users, userID)
+	delete(m.passwords, userID)
+	return nil
+}
+
+func (m *memoryUsers) CreateEmailChange(ctx context.Context, userID int64, newEmail string, tokenHash string, expiresAt time.Time) error{
+	for _, user := range m.users{
+		if user.Email == newEmail{
+			return repository.ErrMailExists
+		}
+	}
+	for hash, change := range m.emailChanges{
+		if change.userID == userID{
+			delete(m.emailChanges, hash)
+		}
+	}
+	m.emailChanges[tokenHash] = pendingEmail{userID: userID, email: newEmail, expiresAt: expiresAt}
+	return nil
+}
+
+func (m *memoryUsers) ConfirmEmailChange(ctx context.Context, tokenHash string) (model.User, error){
+	change, ok := m.emailChanges[tokenHash]
+	if !ok || !change.expiresAt.After(time.Now()){
+		return model.User{}, repository.ErrVerificationNotFound
+	}
+	delete(m.emailChanges, tokenHash)
+
+	user := m.users[change.userID]
+	user.Email = change.email
+	user.EmailVerified = true
+	m.users[user.ID] = user
+	return user, nil
+}
+
+// memoryMailer keeps sent emails so tests can read the tokens in them
+type memoryMailer struct {
+	mu		sync.Mutex
+	sent	[]sentMail
+}
+
+type sentMail struct {
+	to, subject, body string
+}
+
+func (m *memoryMailer) Send(to, subject, body string) error{
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, sentMail{to: to, subject: subject, body: body})
+	return nil
+}
+
+// lastToken returns the token of the last email, which sits in its own paragraph
+func (m *memoryMailer) lastToken(t *testing.T, to string) string{
+	t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.sent) == 0{
+		t.Fatal("Expected an email to be sent")
+	}
+	last := m.sent[len(m.sent)-1]
+	if last.to != to{
+		t.Fatalf("Expected an email to %s but it went to %s", to, last.to)
+	}
+	paragraphs := strings.Split(last.body, "\n\n")
+	if len(paragraphs) < 3{
+		t.Fatalf("Expected a token in the email, got %q", last.body)
+	}
+	return paragraphs[2]
+}
+
+func setupAccountRouter(t *testing.T, users *memoryUsers, authConfig config.Auth) (http.Handler, *memoryMailer, func(model.User) string){
+	gin.SetMode(gin.TestMode)
+	tokens := newTestTokens(t)
+	mailer := &memoryMailer{}
+	handler := NewUserHandler(users, tokens, mailer, password.NewPolicy(8, 128), authConfig)
+	authenticate := AuthMiddleware(tokens, users, stubAPIKeys{})
+
+	router := gin.New()
+	router.POST("/v1/verify-email", handler.VerifyEmailHandler)
+	router.GET("/v1/me", authenticate, handler.GetMeHandler)
+	router.PATCH("/v1/me", authenticate, handler.UpdateMeHandler)
+	router.DELETE("/v1/me", authenticate, RequireSession(), handler.DeleteMeHandler)
+	router.POST("/v1/me/password", authenticate, RequireSession(), handler.ChangePasswordHandler)
+
+	accessToken := func(user model.User) string{
+		token, err := issueAccessToken(tokens, user, time.Hour)
+		if err != nil{
+			t.Fatalf("issueAccessToken() failed: %v", err)
+		}
+		return token
+	}
+	return validateContract(t, router), mailer, accessToken
+}
+
+// serveJSON sends a request with an optional JSON body and bearer token
+func serveJSON(router http.Handler, method, path, token, body string) *httptest.ResponseRecorder{
+	recorder := httptest.NewRecorder()
+	request, _ := http.NewRequest(method, path, strings.NewReader(body))
+	if body != ""{
+		request.Header.Set("Content-Type", "application/json")
+	}
+	if token != ""{
+		request.Header.Set("Authorization", "Bearer " + token)
+	}
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestEmailChangeRequiresVerification(t *testing.T){
+	reader := model.User{ID: 42, Name: "Reader", Email: "reader@example.com", Password: "old password", Role: model.RoleUser}
+	other := model.User{ID: 43, Name: "Other", Email: "other@example.com", Role: model.RoleUser}
+	users := newMemoryUsers(reader, other)
+	authConfig := config.Default().Auth
+	authConfig.EmailVerificationTTL.Duration = 90 * time.Minute
+	router, mailer, accessToken := setupAccountRouter(t, users, authConfig)
+	token := accessToken(reader)
+
+	recorder := serveJSON(router, http.MethodPatch, "/v1/me", token, `{"name": "Avid Reader", "email": "new@example.com"}`)
+	if recorder.Code != http.StatusOK{
+		t.Fatalf("Expected status code %d but got %d: %s", http.StatusOK, recorder.Code, recorder.Body.String())
+	}
+	var response struct{
+		User			model.User	`json:"user"`
+		PendingEmail	string		`json:"pending_email"`
+	}
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+	if response.User.Name != "Avid Reader" || response.PendingEmail != "new@example.com"{
+		t.Errorf("Expected the new name and a pending email, got %s", recorder.Body.String())
+	}
+	if users.users[reader.ID].Email != reader.Email{
+		t.Fatalf("Expected the email to stay %s until it is verified, got %s", reader.Email, users.users[reader.ID].Email)
+	}
+
+	verification := mailer.lastToken(t, "new@example.com")
+	if body := mailer.sent[len(mailer.sent)-1].body; !strings.Contains(body, "The token expires in 90 minutes."){
+		t.Errorf("Expected the email to state the configured lifetime, got %q", body)
+	}
+	recorder = serveJSON(router, http.MethodPost, "/v1/verify-email", "", `{"token": "` + verification + `"}`)
+	if recorder.Code != http.StatusOK{
+		t.Fatalf("Expected status code %d but got %d: %s", http.StatusOK, recorder.Code, recorder.Body.String())
+	}
+	if user := users.users[reader.ID]; user.Email != "new@example.com" || !user.EmailVerified{
+		t.Errorf("Expected the verified new email, got %+v", user)
+	}
+
+	// A token is only good once
+	recorder = serveJSON(router, http.MethodPost, "/v1/verify-email", "", `{"token": "` + verification + `"}`)
+	if recorder.Code != http.StatusBadRequest{
+		t.Errorf("Expected a reused token to get %d but got %d", http.StatusBadRequest, recorder.Code)
+	}
+
+	recorder = serveJSON(router, http.MethodPatch, "/v1/me", token, `{"email": "other@example.com"}`)
+	if recorder.Code != http.StatusConflict{
+		t.Errorf("Expected a taken email to get %d but got %d", http.StatusConflict, recorder.Code)
+	}
+}
+
+func TestDescribeTTL(t *testing.T){
+	cases := map[time.Duration]string{
+		24 * time.Hour: "24 hours",
+		time.Hour: "1 hour",
+		90 * time.Minute: "90 minutes",
+		time.Minute: "1 minute",
+		90 * time.Second: "90 seconds",
+	}
+	for ttl, expected := range cases{
+		if got := describeTTL(ttl); got != expected{
+			t.Errorf("describeTTL(%s) = %q, expected %q", ttl, got, expected)
+		}
+	}
+}
+
+func TestExpiredEmailVerificationIsRejected(t *testing.T){
+	reader := model.User{ID: 42, Name: "Reader", Email: "reader@example.com", Role: model.RoleUser}
+	users := newMemoryUsers(reader)
+	authConfig := config.Default().Auth
+	authConfig.EmailVerificationTTL.Duration = -time.Minute
+	router, mailer, accessToken := setupAccountRouter(t, users, authConfig)
+
+	recorder := serveJSON(router, http.MethodPatch, "/v1/me", accessToken(reader), `{"email": "new@example.com"}`)
+	if recorder.Code != http.StatusOK{
+		t.Fatalf("Expected status code %d but got %d", http.StatusOK, recorder.Code)
+	}
+
+	recorder = serveJSON(router, http.MethodPost, "/v1/verify-email", "", `{"token": "` + mailer.lastToken(t, "new@example.com") + `"}`)
+	if recorder.Code != http.StatusBadRequest{
+		t.Errorf("Expected an expired token to get %d but got %d", http.StatusBadRequest, recorder.Code)
+	}
+	if users.users[reader.ID].Email != reader.Email{
+		t.Errorf("Expected the email to be unchanged, got %s", users.users[reader.ID].Email)
+	}
+}
+
+func TestChangePasswordChecksCurrentPassword(t *testing.T){
+	reader := model.User{ID: 42, Name: "Reader", Email: "reader@example.com", Password: "old password", Role: model.RoleUser}
+	users := newMemoryUsers(reader)
+	router, _, accessToken := setupAccountRouter(t, users, config.Default().Auth)
+	token := accessToken(reader)
+
+	recorder := serveJSON(router, http.MethodPost, "/v1/me/password", token, `{"current_password": "wrong password", "new_password": "brand new secret"}`)
+	if recorder.Code != http.StatusUnauthorized{
+		t.Errorf("Expected a wrong current password to get %d but got %d", http.StatusUnauthorized, recorder.Code)
+	}
+	if users.passwords[reader.ID] != "old password"{
+		t.Fatal("Expected the password to be unchanged")
+	}
+
+	recorder = serveJSON(router, http.MethodPost, "/v1/me/password", token, `{"current_password": "old password", "new_password": "short"}`)
+	if recorder.Code != http.StatusBadRequest{
+		t.Errorf("Expected a password below the policy to get %d but got %d", http.StatusBadRequest, recorder.Code)
+	}
+
+	recorder = serveJSON(router, http.MethodPost, "/v1/me/password", token, `{"current_password": "old password", "new_password": "brand new secret"}`)
+	if recorder.Code != http.StatusOK{
+		t.Fatalf("Expected status code %d but got %d: %s", http.StatusOK, recorder.Code, recorder.Body.String())
+	}
+	if users.passwords[reader.ID] != "brand new secret"{
+		t.Error("Expected the new password to be stored")
+	}
+}
+
+func TestDeleteMeRemovesAccount(t *testing.T){
+	reader := model.User{ID: 42, Name: "Reader", Email: "reader@example.com", Password: "my password", Role: model.RoleUser}
+	users := newMemoryUsers(reader)
+	router, _, accessToken := setupAccountRouter(t, users, config.Default().Auth)
+	token := accessToken(reader)
+
+	recorder := serveJSON(router, http.MethodDelete, "/v1/me", token, `{"password": "wrong password"}`)
+	if recorder.Code != http.StatusUnauthorized{
+		t.Errorf("Expected a wrong password to get %d but got %d", http.StatusUnauthorized, recorder.Code)
+	}
+	if _, ok := users.users[reader.ID]; !ok{
+		t.Fatal("Expected the account to survive a wrong password")
+	}
+
+	recorder = serveJSON(router, http.MethodDelete, "/v1/me", token, `{"password": "my password"}`)
+	if recorder.Code != http.StatusNoContent{
+		t.Fatalf("Expected status code %d but got %d: %s", http.StatusNoContent, recorder.Code, recorder.Body.String())
+	}
+	if _, ok := users.users[reader.ID]; ok{
+		t.Error("Expected the account to be deleted")
+	}
+
+	// The token of a deleted account is worthless
+	recorder = serveJSON(router, http.MethodGet, "/v1/me", token, "")
+	if recorder.Code != http.StatusUnauthorized{
+		t.Errorf("Expected %d after the account was deleted but got %d", http.StatusUnauthorized, recorder.Code)
+	}
+}
@@ -0,0 +1,263 @@
+package handler
+
+import (
+	"bookstore-api/auth"
+	"bookstore-api/config"
+	"bookstore-api/logging"
+	"bookstore-api/mail"
+	"bookstore-api/model"
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize = 100
+)
+
+// adminUserStore is the part of the user repository the admin handlers need
+type adminUserStore interface{
+	GetUserByID(ctx context.Context, id int64) (model.User, error)
+	ListUsers(ctx context.Context, search string, limit, offset int) ([]model.User, int, error)
+	SetDisabled(ctx context.Context, userID int64, disabled bool) error
+	RequirePasswordReset(ctx context.Context, userID int64, tokenHash string, expiresAt time.Time) error
+}
+
+// auditLog is the part of the audit repository the admin handlers need
+type auditLog interface{
+	Record(ctx context.Context, entry model.AuditEntry) error
+	ListByTargetUser(ctx context.Context, userID int64, limit int) ([]model.AuditEntry, error)
+}
+
+type AdminHandler struct {
+	users adminUserStore
+	audit auditLog
+	tokens *auth.TokenManager
+	mailer mail.Sender
+	auth config.Auth
+}
+
+func NewAdminHandler(users adminUserStore, audit auditLog, tokens *auth.TokenManager, mailer mail.Sender, authConfig config.Auth) *AdminHandler{
+	return &AdminHandler{users: users, audit: audit, tokens: tokens, mailer: mailer, auth: authConfig}
+}
+
+// ListUsersHandler returns a page of users, optionally filtered by ?q= on email or name
+func (h *AdminHandler) ListUsersHandler(c *gin.Context){
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1{
+		c.JSON(http.StatusBadRequest, model.AppError{
+			Code: http.StatusBadRequest,
+			Message: "Invalid page",
+		})
+		return
+	}
+
+	perPage, err := strconv.Atoi(c.DefaultQuery("per_page", strconv.Itoa(defaultPageSize)))
+	if err != nil || perPage < 1 || perPage > maxPageSize{
+		c.JSON(http.StatusBadRequest, model.AppError{
+			Code: http.StatusBadRequest,
+			Message: fmt.Sprintf("Invalid per_page, must be between 1 and %d", maxPageSize),
+		})
+		return
+	}
+
+	users, total, err := h.users.ListUsers(c.Request.Context(), strings.TrimSpace(c.Query("q")), perPage, (page-1)*perPage)
+	if err != nil{
+		ErrorHandler(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"users": users,
+		"page": page,
+		"per_page": perPage,
+		"total": total,
+	})
+}
+
+// GetUserHandler returns a single user with their recent audit history
+func (h *AdminHandler) GetUserHandler(c *gin.Context){
+	user, ok := h.targetUser(c)
+	if !ok{
+		return
+	}
+
+	history, err := h.audit.ListByTargetUser(c.Request.Context(), user.ID, 50)
+	if err != nil{
+		ErrorHandler(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user": user,
+		"audit_log": history,
+	})
+}
+
+// DisableUserHandler blocks logins and rejects every token of the user
+func (h *AdminHandler) DisableUserHandler(c *gin.Context){
+	h.setDisabled(c, true)
+}
+
+// EnableUserHandler lifts a previous disable
+func (h *AdminHandler) EnableUserHandler(c *gin.Context){
+	h.setDisabled(c, false)
+}
+
+func (h *AdminHandler) setDisabled(c *gin.Context, disabled bool){
+	user, ok := h.targetUser(c)
+	if !ok{
+		return
+	}
+
+	if disabled && user.ID == c.GetInt64(contextUserID){
+		c.JSON(http.StatusBadRequest, model.AppError{
+			Code: http.StatusBadRequest,
+			Message: "Admins cannot disable their own account",
+		})
+		return
+	}
+
+	if err := h.users.SetDisabled(c.Request.Context(), user.ID, disabled); err != nil{
+		ErrorHandler(c, err)
+		return
+	}
+
+	action := "user.enabled"
+	if disabled{
+		action = "user.disabled"
+	}
+	h.record(c, action, user.ID, nil)
+
+	user.Disabled = disabled
+	c.JSON(http.StatusOK, user)
+}
+
+// ForcePasswordResetHandler rejects every credential of the user until they set
+// a new password with the token mailed to them
+func (h *AdminHandler) ForcePasswordResetHandler(c *gin.Context){
+	user, ok := h.targetUser(c)
+	if !ok{
+		return
+	}
+
+	token, tokenHash, err := auth.NewOpaqueToken()
+	if err != nil{
+		ErrorHandler(c, err)
+		return
+	}
+
+	if err := h.users.RequirePasswordReset(c.Request.Context(), user.ID, tokenHash, time.Now().Add(h.auth.PasswordResetTTL.Duration)); err != nil{
+		ErrorHandler(c, err)
+		return
+	}
+
+	body := fmt.Sprintf("Hi %s,\n\nAn administrator requires you to choose a new password. Send this token with your new password to POST /v1/reset-password:\n\n%s\n\nThe token expires in %s.", user.Name, token, describeTTL(h.auth.PasswordResetTTL.Duration))
+	if err := h.mailer.Send(user.Email, "Reset your password", body); err != nil{
+		ErrorHandler(c, err)
+		return
+	}
+
+	h.record(c, "user.password_reset_forced", user.ID, nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Password reset required, instructions were sent to the user",
+	})
+}
+
+// ImpersonateUserHandler issues a short-lived token for the user that names the
+// admin in its act claim, so support staff can reproduce what the user sees
+func (h *AdminHandler) ImpersonateUserHandler(c *gin.Context){
+	var input struct{
+		Reason	string `json:"reason" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil{
+		c.JSON(http.StatusBadRequest, model.AppError{
+			Code: http.StatusBadRequest,
+			Message: "Invalid input: " + err.Error(),
+		})
+		return
+	}
+
+	user, ok := h.targetUser(c)
+	if !ok{
+		return
+	}
+
+	if user.Role == model.RoleAdmin || user.Disabled{
+		c.JSON(http.StatusForbidden, model.AppError{
+			Code: http.StatusForbidden,
+			Message: "Admins and disabled users cannot be impersonated",
+		})
+		return
+	}
+
+	admin, err := h.users.GetUserByID(c.Request.Context(), c.GetInt64(contextUserID))
+	if err != nil{
+		ErrorHandler(c, err)
+		return
+	}
+
+	tokenString, err := issueImpersonationToken(h.tokens, user, admin, h.auth.ImpersonationTTL.Duration)
+	if err != nil{
+		ErrorHandler(c, err)
+		return
+	}
+
+	// Issuing the token is only allowed if it can be traced afterwards
+	err = h.audit.Record(c.Request.Context(), model.AuditEntry{
+		ActorID: admin.ID,
+		Action: "user.impersonated",
+		TargetUserID: user.ID,
+		Details: map[string]any{"reason": input.Reason},
+	})
+	if err != nil{
+		ErrorHandler(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token": tokenString,
+		"expires_in": int(h.auth.ImpersonationTTL.Seconds()),
+	})
+}
+
+// targetUser loads the user from the :id path parameter and writes the error response if it fails
+func (h *AdminHandler) targetUser(c *gin.Context) (model.User, bool){
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil{
+		c.JSON(http.StatusBadRequest, model.AppError{
+			Code: http.StatusBadRequest,
+			Message: "Invalid user ID",
+		})
+		return model.User{}, false
+	}
+
+	user, err := h.users.GetUserByID(c.Request.Context(), id)
+	if err != nil{
+		ErrorHandler(c, err)
+		return model.User{}, false
+	}
+	return user, true
+}
+
+// record writes an audit entry for an admin action. The action already
+// happened, so a failure is logged rather than returned to the admin.
+func (h *AdminHandler) record(c *gin.Context, action string, targetUserID int64, details map[string]any){
+	err := h.audit.Record(c.Request.Context(), model.AuditEntry{
+		ActorID: c.GetInt64(contextUserID),
+		Action: action,
+		TargetUserID: targetUserID,
+		Details: details,
+	})
+	if err != nil{
+		logging.FromContext(c.Request.Context()).Error("failed to record audit entry", "action", action, "target_user_id", targetUserID, "error", err)
+	}
+}
@@ -0,0 +1,383 @@
+package handler
+
+import (
+	"bookstore-api/config"
+	"bookstore-api/model"
+	"bookstore-api/password"
+	"bookstore-api/repository"
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func (m *memoryUsers) ListUsers(ctx context.Context, search string, limit, offset int) ([]model.User, int, error){
+	search = strings.ToLower(search)
+	var matches []model.User
+	for _, user := range m.users{
+		if strings.Contains(strings.ToLower(user.Email), search) || strings.Contains(strings.ToLower(user.Name), search){
+			matches = append(matches, user)
+		}
+	}
+	slices.SortFunc(matches, func(a, b model.User) int{ return int(a.ID - b.ID) })
+
+	page := make([]model.User, 0)
+	for i := offset; i < len(matches) && i < offset+limit; i++{
+		page = append(page, matches[i])
+	}
+	return page, len(matches), nil
+}
+
+func (m *memoryUsers) SetDisabled(ctx context.Context, userID int64, disabled bool) error{
+	user, ok := m.users[userID]
+	if !ok{
+		return repository.ErrUserNotFound
+	}
+	user.Disabled = disabled
+	m.users[userID] = user
+	return nil
+}
+
+func (m *memoryUsers) RequirePasswordReset(ctx context.Context, userID int64, tokenHash string, expiresAt time.Time) error{
+	user, ok := m.users[userID]
+	if !ok{
+		return repository.ErrUserNotFound
+	}
+	user.PasswordResetRequired = true
+	m.users[userID] = user
+	m.resets[tokenHash] = pendingEmail{userID: userID, expiresAt: expiresAt}
+	return nil
+}
+
+func (m *memoryUsers) ResetPassword(ctx context.Context, tokenHash string, password string) error{
+	reset, ok := m.resets[tokenHash]
+	if !ok || !reset.expiresAt.After(time.Now()){
+		return repository.ErrVerificationNotFound
+	}
+	delete(m.resets, tokenHash)
+
+	now := time.Now()
+	user := m.users[reset.userID]
+	user.PasswordResetRequired = false
+	user.TokensValidAfter = &now
+	m.users[user.ID] = user
+	m.passwords[user.ID] = password
+	return nil
+}
+
+// memoryAudit is an in-memory audit log
+type memoryAudit struct {
+	entries []model.AuditEntry
+}
+
+func (m *memoryAudit) Record(ctx context.Context, entry model.AuditEntry) error{
+	entry.ID = int64(len(m.entries) + 1)
+	entry.CreatedAt = time.Now()
+	m.entries = append(m.entries, entry)
+	return nil
+}
+
+func (m *memoryAudit) ListByTargetUser(ctx context.Context, userID int64, limit int) ([]model.AuditEntry, error){
+	entries := make([]model.AuditEntry, 0)
+	for i := len(m.entries) - 1; i >= 0 && len(entries) < limit; i--{
+		if m.entries[i].TargetUserID == userID{
+			entries = append(entries, m.entries[i])
+		}
+	}
+	return entries, nil
+}
+
+// adminTestServer serves the admin routes together with the account routes the
+// admin actions affect, all behind the real authentication middleware
+type adminTestServer struct {
+	http.Handler
+	users	*memoryUsers
+	audit	*memoryAudit
+	mailer	*memoryMailer
+	tokens	func(user model.User, issuedAt time.Time) string
+}
+
+var (
+	testAdmin	= model.User{ID: 1, Name: "Admin", Email: "admin@example.com", Role: model.RoleAdmin}
+	testReader	= model.User{ID: 2, Name: "Reader", Email: "reader@example.com", Password: "my password", Role: model.RoleUser}
+	testWriter	= model.User{ID: 3, Name: "Writer", Email: "writer@example.com", Role: model.RoleUser}
+)
+
+func setupAdminRouter(t *testing.T) *adminTestServer{
+	gin.SetMode(gin.TestMode)
+	tokens := newTestTokens(t)
+	users := newMemoryUsers(testAdmin, testReader, testWriter)
+	audit := &memoryAudit{}
+	mailer := &memoryMailer{}
+	authConfig := config.Default().Auth
+
+	admins := NewAdminHandler(users, audit, tokens, mailer, authConfig)
+	accounts := NewUserHandler(users, tokens, mailer, password.NewPolicy(8, 128), authConfig)
+	authenticate := AuthMiddleware(tokens, users, stubAPIKeys{})
+
+	router := gin.New()
+	router.POST("/v1/reset-password", accounts.ResetPasswordHandler)
+	router.GET("/v1/me", authenticate, accounts.GetMeHandler)
+	admin := router.Group("/v1/admin", authenticate, RequireSession(), RequireRole(model.RoleAdmin))
+	admin.GET("/users", admins.ListUsersHandler)
+	admin.GET("/users/:id", admins.GetUserHandler)
+	admin.POST("/users/:id/disable", admins.DisableUserHandler)
+	admin.POST("/users/:id/enable", admins.EnableUserHandler)
+	admin.POST("/users/:id/force-password-reset", admins.ForcePasswordResetHandler)
+	admin.POST("/users/:id/impersonate", admins.ImpersonateUserHandler)
+
+	// Tokens are signed with an explicit iat so a test can date them before a reset
+	sign := func(user model.User, issuedAt time.Time) string{
+		token, err := tokens.Sign(jwt.MapClaims{
+			"user_id": user.ID,
+			"email": user.Email,
+			"iat": issuedAt.Unix(),
+			"exp": issuedAt.Add(time.Hour).Unix(),
+		})
+		if err != nil{
+			t.Fatalf("Sign() failed: %v", err)
+		}
+		return token
+	}
+	return &adminTestServer{Handler: validateContract(t, router), users: users, audit: audit, mailer: mailer, tokens: sign}
+}
+
+// lastAudit returns the newest audit entry and fails the test without one
+func (s *adminTestServer) lastAudit(t *testing.T) model.AuditEntry{
+	t.Helper()
+	if len(s.audit.entries) == 0{
+		t.Fatal("Expected an audit entry")
+	}
+	return s.audit.entries[len(s.audit.entries)-1]
+}
+
+func TestListUsersHandler(t *testing.T){
+	server := setupAdminRouter(t)
+	adminToken := server.tokens(testAdmin, time.Now())
+
+	cases := []struct{
+		name	string
+		query	string
+		code	int
+		emails	[]string
+		total	int
+	}{
+		{"first page", "", http.StatusOK, []string{"admin@example.com", "reader@example.com", "writer@example.com"}, 3},
+		{"second page", "?page=2&per_page=2", http.StatusOK, []string{"writer@example.com"}, 3},
+		{"past the last page", "?page=5&per_page=2", http.StatusOK, []string{}, 3},
+		{"search", "?q=READER", http.StatusOK, []string{"reader@example.com"}, 1},
+		{"page zero", "?page=0", http.StatusBadRequest, nil, 0},
+		{"page not a number", "?page=first", http.StatusBadRequest, nil, 0},
+		{"per_page zero", "?per_page=0", http.StatusBadRequest, nil, 0},
+		{"per_page above the maximum", "?per_page=101", http.StatusBadRequest, nil, 0},
+	}
+
+	for _, tc := range cases{
+		recorder := serveJSON(server, http.MethodGet, "/v1/admin/users" + tc.query, adminToken, "")
+		if recorder.Code != tc.code{
+			t.Errorf("%s: expected status code %d but got %d", tc.name, tc.code, recorder.Code)
+			continue
+		}
+		if tc.code != http.StatusOK{
+			continue
+		}
+
+		var response struct{
+			Users	[]model.User	`json:"users"`
+			Total	int				`json:"total"`
+		}
+		json.Unmarshal(recorder.Body.Bytes(), &response)
+		emails := []string{}
+		for _, user := range response.Users{
+			emails = append(emails, user.Email)
+		}
+		if !slices.Equal(emails, tc.emails) || response.Total != tc.total{
+			t.Errorf("%s: expected %v of %d but got %v of %d", tc.name, tc.emails, tc.total, emails, response.Total)
+		}
+	}
+
+	readerToken := server.tokens(testReader, time.Now())
+	if recorder := serveJSON(server, http.MethodGet, "/v1/admin/users", readerToken, ""); recorder.Code != http.StatusForbidden{
+		t.Errorf("Expected a user to get %d but got %d", http.StatusForbidden, recorder.Code)
+	}
+}
+
+func TestDisableUserHandler(t *testing.T){
+	server := setupAdminRouter(t)
+	adminToken := server.tokens(testAdmin, time.Now())
+	readerToken := server.tokens(testReader, time.Now())
+
+	recorder := serveJSON(server, http.MethodPost, "/v1/admin/users/2/disable", adminToken, "")
+	if recorder.Code != http.StatusOK{
+		t.Fatalf("Expected status code %d but got %d: %s", http.StatusOK, recorder.Code, recorder.Body.String())
+	}
+	if entry := server.lastAudit(t); entry.Action != "user.disabled" || entry.ActorID != testAdmin.ID || entry.TargetUserID != testReader.ID{
+		t.Errorf("Unexpected audit entry %+v", entry)
+	}
+
+	// The existing token stops working at once
+	if recorder := serveJSON(server, http.MethodGet, "/v1/me", readerToken, ""); recorder.Code != http.StatusUnauthorized{
+		t.Errorf("Expected a disabled user's token to get %d but got %d", http.StatusUnauthorized, recorder.Code)
+	}
+
+	recorder = serveJSON(server, http.MethodPost, "/v1/admin/users/2/enable", adminToken, "")
+	if recorder.Code != http.StatusOK{
+		t.Fatalf("Expected status code %d but got %d", http.StatusOK, recorder.Code)
+	}
+	if entry := server.lastAudit(t); entry.Action != "user.enabled"{
+		t.Errorf("Expected a user.enabled audit entry, got %q", entry.Action)
+	}
+	if recorder := serveJSON(server, http.MethodGet, "/v1/me", readerToken, ""); recorder.Code != http.StatusOK{
+		t.Errorf("Expected the token to work again after enabling but got %d", recorder.Code)
+	}
+
+	cases := []struct{
+		name	string
+		path	string
+		code	int
+	}{
+		{"own account", "/v1/admin/users/1/disable", http.StatusBadRequest},
+		{"unknown user", "/v1/admin/users/99/disable", http.StatusNotFound},
+		{"invalid ID", "/v1/admin/users/abc/disable", http.StatusBadRequest},
+	}
+	for _, tc := range cases{
+		if recorder := serveJSON(server, http.MethodPost, tc.path, adminToken, ""); recorder.Code != tc.code{
+			t.Errorf("%s: expected status code %d but got %d", tc.name, tc.code, recorder.Code)
+		}
+	}
+}
+
+func TestForcePasswordResetHandler(t *testing.T){
+	server := setupAdminRouter(t)
+	adminToken := server.tokens(testAdmin, time.Now())
+	readerToken := server.tokens(testReader, time.Now().Add(-time.Minute))
+
+	recorder := serveJSON(server, http.MethodPost, "/v1/admin/users/2/force-password-reset", adminToken, "")
+	if recorder.Code != http.StatusOK{
+		t.Fatalf("Expected status code %d but got %d: %s", http.StatusOK, recorder.Code, recorder.Body.String())
+	}
+	if entry := server.lastAudit(t); entry.Action != "user.password_reset_forced" || entry.TargetUserID != testReader.ID{
+		t.Errorf("Unexpected audit entry %+v", entry)
+	}
+
+	// An existing token is rejected while the reset is pending
+	if recorder := serveJSON(server, http.MethodGet, "/v1/me", readerToken, ""); recorder.Code != http.StatusUnauthorized{
+		t.Errorf("Expected %d after a forced reset but got %d", http.StatusUnauthorized, recorder.Code)
+	}
+
+	resetToken := server.mailer.lastToken(t, testReader.Email)
+	if body := server.mailer.sent[len(server.mailer.sent)-1].body; !strings.Contains(body, "The token expires in 72 hours."){
+		t.Errorf("Expected the email to state the configured lifetime, got %q", body)
+	}
+	recorder = serveJSON(server, http.MethodPost, "/v1/reset-password", "", `{"token": "` + resetToken + `", "new_password": "brand new secret"}`)
+	if recorder.Code != http.StatusOK{
+		t.Fatalf("Expected status code %d but got %d: %s", http.StatusOK, recorder.Code, recorder.Body.String())
+	}
+
+	// ... and after it, while a token issued since works
+	if recorder := serveJSON(server, http.MethodGet, "/v1/me", readerToken, ""); recorder.Code != http.StatusUnauthorized{
+		t.Errorf("Expected a token from before the reset to get %d but got %d", http.StatusUnauthorized, recorder.Code)
+	}
+	freshToken := server.tokens(testReader, time.Now().Add(time.Second))
+	if recorder := serveJSON(server, http.MethodGet, "/v1/me", freshToken, ""); recorder.Code != http.StatusOK{
+		t.Errorf("Expected a token issued after the reset to work but got %d", recorder.Code)
+	}
+
+	recorder = serveJSON(server, http.MethodPost, "/v1/reset-password", "", `{"token": "` + resetToken + `", "new_password": "another secret"}`)
+	if recorder.Code != http.StatusBadRequest{
+		t.Errorf("Expected a reused reset token to get %d but got %d", http.StatusBadRequest, recorder.Code)
+	}
+}
+
+func TestImpersonateUserHandler(t *testing.T){
+	server := setupAdminRouter(t)
+	adminToken := server.tokens(testAdmin, time.Now())
+
+	recorder := serveJSON(server, http.MethodPost, "/v1/admin/users/2/impersonate", adminToken, `{"reason": "ticket 1234"}`)
+	if recorder.Code != http.StatusOK{
+		t.Fatalf("Expected status code %d but got %d: %s", http.StatusOK, recorder.Code, recorder.Body.String())
+	}
+	var response struct{
+		Token		string	`json:"token"`
+		ExpiresIn	int		`json:"expires_in"`
+	}
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+	if response.ExpiresIn != int(time.Hour.Seconds()){
+		t.Errorf("Expected the token to last an hour, got %ds", response.ExpiresIn)
+	}
+
+	claims, _, err := jwt.NewParser().ParseUnverified(response.Token, jwt.MapClaims{})
+	if err != nil{
+		t.Fatalf("Failed to decode the token: %v", err)
+	}
+	mapClaims := claims.Claims.(jwt.MapClaims)
+	actor, _ := mapClaims["act"].(map[string]interface{})
+	if mapClaims["user_id"] != float64(testReader.ID) || actor["user_id"] != float64(testAdmin.ID){
+		t.Errorf("Expected a token for the reader acting as the admin, got %v", mapClaims)
+	}
+
+	entry := server.lastAudit(t)
+	if entry.Action != "user.impersonated" || entry.ActorID != testAdmin.ID || entry.TargetUserID != testReader.ID || entry.Details["reason"] != "ticket 1234"{
+		t.Errorf("Unexpected audit entry %+v", entry)
+	}
+
+	// The token acts as the user but never as an admin
+	if recorder := serveJSON(server, http.MethodGet, "/v1/me", response.Token, ""); recorder.Code != http.StatusOK{
+		t.Errorf("Expected the impersonation token to work on /v1/me but got %d", recorder.Code)
+	}
+	if recorder := serveJSON(server, http.MethodGet, "/v1/admin/users", response.Token, ""); recorder.Code != http.StatusForbidden{
+		t.Errorf("Expected the impersonation token to get %d on admin routes but got %d", http.StatusForbidden, recorder.Code)
+	}
+
+	cases := []struct{
+		name	string
+		path	string
+		body	string
+		code	int
+	}{
+		{"missing reason", "/v1/admin/users/2/impersonate", `{}`, http.StatusBadRequest},
+		{"admin", "/v1/admin/users/1/impersonate", `{"reason": "curious"}`, http.StatusForbidden},
+		{"unknown user", "/v1/admin/users/99/impersonate", `{"reason": "curious"}`, http.StatusNotFound},
+	}
+	entries := len(server.audit.entries)
+	for _, tc := range cases{
+		if recorder := serveJSON(server, http.MethodPost, tc.path, adminToken, tc.body); recorder.Code != tc.code{
+			t.Errorf("%s: expected status code %d but got %d", tc.name, tc.code, recorder.Code)
+		}
+	}
+	if len(server.audit.entries) != entries{
+		t.Error("Expected refused impersonations to leave no audit entry")
+	}
+}
+
+func TestGetUserHandlerIncludesAuditLog(t *testing.T){
+	server := setupAdminRouter(t)
+	adminToken := server.tokens(testAdmin, time.Now())
+
+	serveJSON(server, http.MethodPost, "/v1/admin/users/3/disable", adminToken, "")
+	serveJSON(server, http.MethodPost, "/v1/admin/users/3/enable", adminToken, "")
+	serveJSON(server, http.MethodPost, "/v1/admin/users/2/disable", adminToken, "")
+
+	recorder := serveJSON(server, http.MethodGet, "/v1/admin/users/3", adminToken, "")
+	if recorder.Code != http.StatusOK{
+		t.Fatalf("Expected status code %d but got %d", http.StatusOK, recorder.Code)
+	}
+	var response struct{
+		User		model.User			`json:"user"`
+		AuditLog	[]model.AuditEntry	`json:"audit_log"`
+	}
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+	if response.User.ID != testWriter.ID || len(response.AuditLog) != 2 || response.AuditLog[0].Action != "user.enabled"{
+		t.Errorf("Expected the writer with their two audit entries, newest first, got %s", recorder.Body.String())
+	}
+
+	if recorder := serveJSON(server, http.MethodGet, "/v1/admin/users/99", adminToken, ""); recorder.Code != http.StatusNotFound{
+		t.Errorf("Expected an unknown user to get %d but got %d", http.StatusNotFound, recorder.Code)
+	}
+}
@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"bookstore-api/auth"
+	"bookstore-api/model"
+	"bookstore-api/repository"
+	"context"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// apiKeyStore is the part of the API key repository the API key handlers need
+type apiKeyStore interface{
+	CreateAPIKey(ctx context.Context, key *model.APIKey) error
+	ListAPIKeys(ctx context.Context, userID int64) ([]model.APIKey, error)
+	RevokeAPIKey(ctx context.Context, userID int64, keyID int64) error
+}
+
+// apiKeyAttempts is how often a key is generated again when its random prefix
+// is already taken. With 32 bits of prefix a second collision in a row is
+// all but impossible.
+const apiKeyAttempts = 3
+
+type APIKeyHandler struct {
+	repo apiKeyStore
+}
+
+func NewAPIKeyHandler(repo apiKeyStore) *APIKeyHandler{
+	return &APIKeyHandler{repo: repo}
+}
+
+// CreateAPIKeyHandler creates a scoped key for the current user. The key is
+// only included in this response; afterwards only its prefix can be seen.
+func (h *APIKeyHandler) CreateAPIKeyHandler(c *gin.Context){
+	var input struct{
+		Name			string		`json:"name" binding:"required,max=100"`
+		Scopes			[]string	`json:"scopes" binding:"required,min=1"`
+		ExpiresInDays	int			`json:"expires_in_days" binding:"omitempty,min=1,max=365"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil{
+		c.JSON(http.StatusBadRequest, model.AppError{
+			Code: http.StatusBadRequest,
+			Message: "Invalid input: " + err.Error(),
+		})
+		return
+	}
+
+	for _, scope := range input.Scopes{
+		if !slices.Contains(model.APIKeyScopes, scope){
+			c.JSON(http.StatusBadRequest, model.AppError{
+				Code: http.StatusBadRequest,
+				Message: "Invalid input: unknown scope " + scope,
+			})
+			return
+		}
+	}
+
+	key := model.APIKey{
+		UserID: c.GetInt64(contextUserID),
+		Name: input.Name,
+		Scopes: slices.Compact(slices.Sorted(slices.Values(input.Scopes))),
+	}
+	if input.ExpiresInDays > 0{
+		expiresAt := time.Now().AddDate(0, 0, input.ExpiresInDays)
+		key.ExpiresAt = &expiresAt
+	}
+
+	// The random prefix of a new key may already be taken, then a new key is generated
+	var secret string
+	for attempt := 1; ; attempt++{
+		var err error
+		secret, key.Prefix, key.KeyHash, err = auth.NewAPIKey()
+		if err != nil{
+			ErrorHandler(c, err)
+			return
+		}
+
+		err = h.repo.CreateAPIKey(c.Request.Context(), &key)
+		if err == repository.ErrAPIKeyPrefixTaken && attempt < apiKeyAttempts{
+			continue
+		}
+		if err != nil{
+			ErrorHandler(c, err)
+			return
+		}
+		break
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"api_key": key,
+		"key": secret,
+	})
+}
+
+// ListAPIKeysHandler lists the current user's keys without their secrets
+func (h *APIKeyHandler) ListAPIKeysHandler(c *gin.Context){
+	keys, err := h.repo.ListAPIKeys(c.Request.Context(), c.GetInt64(contextUserID))
+	if err != nil{
+		ErrorHandler(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, keys)
+}
+
+// RevokeAPIKeyHandler revokes one of the current user's keys
+func (h *APIKeyHandler) RevokeAPIKeyHandler(c *gin.Context){
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil{
+		c.JSON(http.StatusBadRequest, model.AppError{
+			Code: http.StatusBadRequest,
+			Message: "Invalid API key ID",
+		})
+		return
+	}
+
+	if err := h.repo.RevokeAPIKey(c.Request.Context(), c.GetInt64(contextUserID), id); err != nil{
+		ErrorHandler(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
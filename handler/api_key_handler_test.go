@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"bookstore-api/model"
+	"bookstore-api/repository"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// memoryAPIKeys is an in-memory API key repository that reports the prefix of
+// the next collisions keys as taken
+type memoryAPIKeys struct {
+	keys		[]model.APIKey
+	collisions	int
+}
+
+func (m *memoryAPIKeys) CreateAPIKey(ctx context.Context, key *model.APIKey) error{
+	if m.collisions > 0{
+		m.collisions--
+		return repository.ErrAPIKeyPrefixTaken
+	}
+	key.ID = int64(len(m.keys) + 1)
+	key.CreatedAt = time.Now()
+	m.keys = append(m.keys, *key)
+	return nil
+}
+
+func (m *memoryAPIKeys) ListAPIKeys(ctx context.Context, userID int64) ([]model.APIKey, error){
+	return m.keys, nil
+}
+
+func (m *memoryAPIKeys) RevokeAPIKey(ctx context.Context, userID int64, keyID int64) error{
+	return repository.ErrAPIKeyNotFound
+}
+
+func TestCreateAPIKeyRetriesTakenPrefix(t *testing.T){
+	gin.SetMode(gin.TestMode)
+	user := model.User{ID: 42, Email: "script@example.com", Role: model.RoleUser}
+	users := stubUsers{user.ID: user}
+	tokens := newTestTokens(t)
+	token, err := issueAccessToken(tokens, user, time.Hour)
+	if err != nil{
+		t.Fatalf("issueAccessToken() failed: %v", err)
+	}
+
+	cases := []struct{
+		name		string
+		collisions	int
+		code		int
+	}{
+		{"no collision", 0, http.StatusCreated},
+		{"collisions within the attempts", apiKeyAttempts - 1, http.StatusCreated},
+		{"every attempt collides", apiKeyAttempts, http.StatusInternalServerError},
+	}
+
+	for _, tc := range cases{
+		keys := &memoryAPIKeys{collisions: tc.collisions}
+		handler := NewAPIKeyHandler(keys)
+		router := gin.New()
+		router.POST("/v1/me/api-keys", AuthMiddleware(tokens, users, stubAPIKeys{}), RequireSession(), handler.CreateAPIKeyHandler)
+
+		recorder := serveJSON(validateContract(t, router), http.MethodPost, "/v1/me/api-keys", token, `{"name": "deploy", "scopes": ["write:books"]}`)
+		if recorder.Code != tc.code{
+			t.Errorf("%s: expected status code %d but got %d: %s", tc.name, tc.code, recorder.Code, recorder.Body.String())
+			continue
+		}
+		if tc.code != http.StatusCreated{
+			continue
+		}
+
+		var response struct{
+			APIKey	model.APIKey	`json:"api_key"`
+			Key		string			`json:"key"`
+		}
+		json.Unmarshal(recorder.Body.Bytes(), &response)
+		if len(keys.keys) != 1 || !strings.Contains(response.Key, keys.keys[0].Prefix) || response.APIKey.Prefix != keys.keys[0].Prefix{
+			t.Errorf("%s: expected the returned key to match the stored one, got %s", tc.name, recorder.Body.String())
+		}
+	}
+}
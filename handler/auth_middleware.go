@@ -0,0 +1,204 @@
+package handler
+
+import (
+	"bookstore-api/auth"
+	"bookstore-api/logging"
+	"bookstore-api/model"
+	"bookstore-api/repository"
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	contextUserID = "user_id"
+	contextUserRole = "user_role"
+	// contextImpersonatorID holds the admin acting on behalf of the user, if any
+	contextImpersonatorID = "impersonator_id"
+	// contextAPIKey holds the model.APIKey when the request authenticated with one
+	contextAPIKey = "api_key"
+)
+
+// userGetter is the part of the user repository the middleware needs
+type userGetter interface{
+	GetUserByID(ctx context.Context, id int64) (model.User, error)
+}
+
+// apiKeyGetter is the part of the API key repository the middleware needs
+type apiKeyGetter interface{
+	GetAPIKeyByPrefix(ctx context.Context, prefix string) (model.APIKey, error)
+	TouchAPIKey(ctx context.Context, keyID int64, usedAt time.Time) error
+}
+
+// AuthMiddleware requires either a bearer access token or an API key for an
+// active account and stores the user ID and role in the context. The account is
+// looked up on every request so disabling a user or forcing a password reset
+// revokes their credentials immediately.
+func AuthMiddleware(tokens *auth.TokenManager, users userGetter, keys apiKeyGetter) gin.HandlerFunc{
+	return func(c *gin.Context){
+		credential, found := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !found{
+			credential = c.GetHeader("X-API-Key")
+		}
+		if credential == ""{
+			abortUnauthorized(c, "Missing bearer token or API key")
+			return
+		}
+
+		var userID int64
+		var claims map[string]interface{}
+		if auth.IsAPIKey(credential){
+			key, ok := authenticateAPIKey(c.Request.Context(), keys, credential)
+			if !ok{
+				abortUnauthorized(c, "Invalid API key")
+				return
+			}
+			userID = key.UserID
+			c.Set(contextAPIKey, key)
+		} else {
+			var err error
+			claims, err = tokens.Parse(credential)
+			if err != nil{
+				abortUnauthorized(c, err.Error())
+				return
+			}
+
+			// MFA challenge tokens only prove the password step and must not grant access
+			if purpose, _ := claims["purpose"].(string); purpose != ""{
+				abortUnauthorized(c, auth.ErrInvalidToken.Error())
+				return
+			}
+
+			var ok bool
+			userID, ok = userIDFromClaims(claims)
+			if !ok{
+				abortUnauthorized(c, auth.ErrInvalidToken.Error())
+				return
+			}
+
+			if actor, ok := claims["act"].(map[string]interface{}); ok{
+				if impersonatorID, ok := userIDFromClaims(actor); ok{
+					c.Set(contextImpersonatorID, impersonatorID)
+				}
+			}
+		}
+
+		user, err := users.GetUserByID(c.Request.Context(), userID)
+		if err != nil && err != repository.ErrUserNotFound{
+			// A slow or unavailable database is not the client's fault
+			ErrorHandler(c, err)
+			c.Abort()
+			return
+		}
+		if err != nil || user.Disabled || user.PasswordResetRequired{
+			abortUnauthorized(c, auth.ErrInvalidToken.Error())
+			return
+		}
+		// Tokens from before a completed forced reset stay revoked
+		if claims != nil && user.TokensValidAfter != nil && issuedBefore(claims, *user.TokensValidAfter){
+			abortUnauthorized(c, auth.ErrInvalidToken.Error())
+			return
+		}
+
+		c.Set(contextUserID, user.ID)
+		c.Set(contextUserRole, user.Role)
+
+		// Everything logged for the rest of the request names the user
+		logAttrs := []any{"user_id", user.ID}
+		if impersonatorID, ok := c.Get(contextImpersonatorID); ok{
+			logAttrs = append(logAttrs, "impersonator_id", impersonatorID)
+		}
+		c.Request = c.Request.WithContext(logging.With(c.Request.Context(), logAttrs...))
+		c.Next()
+	}
+}
+
+// authenticateAPIKey looks the key up by prefix and compares the full hash in constant time
+func authenticateAPIKey(ctx context.Context, keys apiKeyGetter, credential string) (model.APIKey, bool){
+	prefix, ok := auth.APIKeyLookupPrefix(credential)
+	if !ok{
+		return model.APIKey{}, false
+	}
+
+	key, err := keys.GetAPIKeyByPrefix(ctx, prefix)
+	if err != nil{
+		return model.APIKey{}, false
+	}
+
+	if subtle.ConstantTimeCompare([]byte(key.KeyHash), []byte(auth.HashToken(credential))) != 1{
+		return model.APIKey{}, false
+	}
+
+	now := time.Now()
+	if !key.Active(now){
+		return model.APIKey{}, false
+	}
+
+	if err := keys.TouchAPIKey(ctx, key.ID, now); err != nil{
+		logging.FromContext(ctx).Warn("failed to record api key use", "api_key_id", key.ID, "error", err)
+	}
+	return key, true
+}
+
+// RequireScope rejects API keys that were not granted scope. Login tokens carry every scope.
+func RequireScope(scope string) gin.HandlerFunc{
+	return func(c *gin.Context){
+		if value, ok := c.Get(contextAPIKey); ok && !value.(model.APIKey).HasScope(scope){
+			c.AbortWithStatusJSON(http.StatusForbidden, model.AppError{
+				Code: http.StatusForbidden,
+				Message: "API key is missing the " + scope + " scope",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireSession rejects API keys and impersonation tokens. It guards routes
+// such as key management and admin actions that must only be reachable by the
+// person who logged in, so an impersonating admin cannot mint credentials
+// that outlive the impersonation.
+func RequireSession() gin.HandlerFunc{
+	return func(c *gin.Context){
+		if _, ok := c.Get(contextAPIKey); ok{
+			c.AbortWithStatusJSON(http.StatusForbidden, model.AppError{
+				Code: http.StatusForbidden,
+				Message: "This endpoint cannot be used with an API key",
+			})
+			return
+		}
+		if _, ok := c.Get(contextImpersonatorID); ok{
+			c.AbortWithStatusJSON(http.StatusForbidden, model.AppError{
+				Code: http.StatusForbidden,
+				Message: "This endpoint cannot be used while impersonating a user",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireRole rejects users that do not have the given role. It must run after AuthMiddleware.
+func RequireRole(role string) gin.HandlerFunc{
+	return func(c *gin.Context){
+		if c.GetString(contextUserRole) != role{
+			c.AbortWithStatusJSON(http.StatusForbidden, model.AppError{
+				Code: http.StatusForbidden,
+				Message: "Insufficient permissions",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+func abortUnauthorized(c *gin.Context, message string){
+	c.AbortWithStatusJSON(http.StatusUnauthorized, model.AppError{
+		Code: http.StatusUnauthorized,
+		Message: message,
+	})
+}
@@ -0,0 +1,310 @@
+package handler
+
+import (
+	"bookstore-api/auth"
+	"bookstore-api/model"
+	"bookstore-api/repository"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// stubUsers serves users from memory so the middleware can be tested without a database
+type stubUsers map[int64]model.User
+
+func (s stubUsers) GetUserByID(ctx context.Context, id int64) (model.User, error){
+	user, ok := s[id]
+	if !ok{
+		return user, repository.ErrUserNotFound
+	}
+	return user, nil
+}
+
+// stubAPIKeys serves API keys from memory, keyed by prefix
+type stubAPIKeys map[string]model.APIKey
+
+func (s stubAPIKeys) GetAPIKeyByPrefix(ctx context.Context, prefix string) (model.APIKey, error){
+	key, ok := s[prefix]
+	if !ok{
+		return key, repository.ErrAPIKeyNotFound
+	}
+	return key, nil
+}
+
+func (s stubAPIKeys) TouchAPIKey(ctx context.Context, keyID int64, usedAt time.Time) error{
+	return nil
+}
+
+func setupAuthRouter(t *testing.T, users stubUsers) (http.Handler, *auth.TokenManager){
+	return setupAuthRouterWithKeys(t, users, stubAPIKeys{})
+}
+
+// newTestTokens returns a token manager with a freshly generated signing key
+func newTestTokens(t *testing.T) *auth.TokenManager{
+	key, err := auth.GenerateKey("test")
+	if err != nil{
+		t.Fatalf("Failed to generate signing key: %v", err)
+	}
+	keySet, err := auth.NewKeySet([]*auth.Key{key}, "")
+	if err != nil{
+		t.Fatalf("Failed to build key set: %v", err)
+	}
+	return auth.NewTokenManager(keySet, "bookstore-api")
+}
+
+func setupAuthRouterWithKeys(t *testing.T, users stubUsers, keys stubAPIKeys) (http.Handler, *auth.TokenManager){
+	gin.SetMode(gin.TestMode)
+	tokens := newTestTokens(t)
+
+	authenticate := AuthMiddleware(tokens, users, keys)
+
+	router := gin.New()
+	router.GET("/v1/me", authenticate, func(c *gin.Context){
+		c.JSON(http.StatusOK, users[c.GetInt64(contextUserID)])
+	})
+	router.GET("/v1/admin/users", authenticate, RequireSession(), RequireRole(model.RoleAdmin), func(c *gin.Context){
+		c.JSON(http.StatusOK, gin.H{"users": []model.User{}, "page": 1, "per_page": 20, "total": 0})
+	})
+	router.POST("/v1/books", authenticate, RequireScope(model.ScopeWriteBooks), NewBookHandler(newMemoryBooks()).CreateBookHandler)
+	router.GET("/v1/me/api-keys", authenticate, RequireSession(), func(c *gin.Context){
+		c.JSON(http.StatusOK, []model.APIKey{})
+	})
+	return validateContract(t, router), tokens
+}
+
+// newAuthRequest builds a request carrying a credential, with a valid book as
+// the body of a POST
+func newAuthRequest(method, path, header, value string) *http.Request{
+	var body io.Reader
+	if method == http.MethodPost{
+		body = strings.NewReader(`{"title": "Dune", "author": "Frank Herbert"}`)
+	}
+	request := httptest.NewRequest(method, path, body)
+	if body != nil{
+		request.Header.Set("Content-Type", "application/json")
+	}
+	if header != ""{
+		request.Header.Set(header, value)
+	}
+	return request
+}
+
+func TestAuthMiddleware(t *testing.T){
+	user := model.User{ID: 42, Email: "staff@example.com", Role: model.RoleUser}
+	disabled := model.User{ID: 43, Email: "gone@example.com", Role: model.RoleUser, Disabled: true}
+	admin := model.User{ID: 1, Email: "admin@example.com", Role: model.RoleAdmin}
+	router, tokens := setupAuthRouter(t, stubUsers{user.ID: user, disabled.ID: disabled, admin.ID: admin})
+
+	accessToken, err := issueAccessToken(tokens, user, time.Hour)
+	if err != nil{
+		t.Fatalf("issueAccessToken() failed: %v", err)
+	}
+	challenge, err := issueMFAChallenge(tokens, user, time.Minute)
+	if err != nil{
+		t.Fatalf("issueMFAChallenge() failed: %v", err)
+	}
+	disabledToken, _ := issueAccessToken(tokens, disabled, time.Hour)
+	adminToken, _ := issueAccessToken(tokens, admin, time.Hour)
+	impersonationToken, _ := issueImpersonationToken(tokens, user, admin, time.Hour)
+
+	cases := []struct{
+		name	string
+		path	string
+		header	string
+		code	int
+	}{
+		{"missing header", "/v1/me", "", http.StatusUnauthorized},
+		{"malformed token", "/v1/me", "Bearer not-a-token", http.StatusUnauthorized},
+		{"mfa challenge token", "/v1/me", "Bearer " + challenge, http.StatusUnauthorized},
+		{"disabled user", "/v1/me", "Bearer " + disabledToken, http.StatusUnauthorized},
+		{"access token", "/v1/me", "Bearer " + accessToken, http.StatusOK},
+		{"user on admin route", "/v1/admin/users", "Bearer " + accessToken, http.StatusForbidden},
+		{"admin on admin route", "/v1/admin/users", "Bearer " + adminToken, http.StatusOK},
+		{"impersonation on admin route", "/v1/admin/users", "Bearer " + impersonationToken, http.StatusForbidden},
+	}
+
+	for _, tc := range cases{
+		recorder := httptest.NewRecorder()
+		request := newAuthRequest(http.MethodGet, tc.path, "Authorization", tc.header)
+
+		router.ServeHTTP(recorder, request)
+
+		if recorder.Code != tc.code{
+			t.Errorf("%s: expected status code %d but got %d", tc.name, tc.code, recorder.Code)
+		}
+	}
+}
+
+func TestAuthMiddlewareForcedPasswordReset(t *testing.T){
+	pending := model.User{ID: 42, Email: "pending@example.com", Role: model.RoleUser, PasswordResetRequired: true}
+	resetAt := time.Now()
+	reset := model.User{ID: 43, Email: "reset@example.com", Role: model.RoleUser, TokensValidAfter: &resetAt}
+
+	secret, prefix, hash, err := auth.NewAPIKey()
+	if err != nil{
+		t.Fatalf("NewAPIKey() failed: %v", err)
+	}
+	keys := stubAPIKeys{prefix: {ID: 1, UserID: pending.ID, Prefix: prefix, KeyHash: hash, Scopes: []string{model.ScopeWriteBooks}}}
+	router, tokens := setupAuthRouterWithKeys(t, stubUsers{pending.ID: pending, reset.ID: reset}, keys)
+
+	pendingToken, _ := issueAccessToken(tokens, pending, time.Hour)
+	// Tokens issued before the reset, with and without an iat claim
+	staleToken, _ := tokens.Sign(jwt.MapClaims{"user_id": reset.ID, "iat": resetAt.Add(-time.Minute).Unix(), "exp": time.Now().Add(time.Hour).Unix()})
+	legacyToken, _ := tokens.Sign(jwt.MapClaims{"user_id": reset.ID, "exp": time.Now().Add(time.Hour).Unix()})
+	freshToken, _ := issueAccessToken(tokens, reset, time.Hour)
+
+	cases := []struct{
+		name	string
+		method	string
+		path	string
+		header	string
+		value	string
+		code	int
+	}{
+		{"token while the reset is pending", http.MethodGet, "/v1/me", "Authorization", "Bearer " + pendingToken, http.StatusUnauthorized},
+		{"API key while the reset is pending", http.MethodPost, "/v1/books", "X-API-Key", secret, http.StatusUnauthorized},
+		{"token issued before the reset", http.MethodGet, "/v1/me", "Authorization", "Bearer " + staleToken, http.StatusUnauthorized},
+		{"token without iat", http.MethodGet, "/v1/me", "Authorization", "Bearer " + legacyToken, http.StatusUnauthorized},
+		{"token issued after the reset", http.MethodGet, "/v1/me", "Authorization", "Bearer " + freshToken, http.StatusOK},
+	}
+
+	for _, tc := range cases{
+		recorder := httptest.NewRecorder()
+		request := newAuthRequest(tc.method, tc.path, tc.header, tc.value)
+
+		router.ServeHTTP(recorder, request)
+
+		if recorder.Code != tc.code{
+			t.Errorf("%s: expected status code %d but got %d", tc.name, tc.code, recorder.Code)
+		}
+	}
+}
+
+func TestAuthMiddlewareImpersonation(t *testing.T){
+	gin.SetMode(gin.TestMode)
+	user := model.User{ID: 42, Email: "reader@example.com", Role: model.RoleUser}
+	admin := model.User{ID: 1, Email: "admin@example.com", Role: model.RoleAdmin}
+	users := stubUsers{user.ID: user, admin.ID: admin}
+	tokens := newTestTokens(t)
+
+	var userID, impersonatorID int64
+	router := gin.New()
+	router.GET("/v1/me", AuthMiddleware(tokens, users, stubAPIKeys{}), func(c *gin.Context){
+		userID = c.GetInt64(contextUserID)
+		impersonatorID = c.GetInt64(contextImpersonatorID)
+		c.JSON(http.StatusOK, users[userID])
+	})
+
+	tokenString, err := issueImpersonationToken(tokens, user, admin, time.Hour)
+	if err != nil{
+		t.Fatalf("issueImpersonationToken() failed: %v", err)
+	}
+
+	recorder := httptest.NewRecorder()
+	validateContract(t, router).ServeHTTP(recorder, newAuthRequest(http.MethodGet, "/v1/me", "Authorization", "Bearer " + tokenString))
+
+	if recorder.Code != http.StatusOK{
+		t.Fatalf("Expected status code 200 but got %d", recorder.Code)
+	}
+	if userID != user.ID || impersonatorID != admin.ID{
+		t.Errorf("Expected user 42 impersonated by 1 but got user %d impersonated by %d", userID, impersonatorID)
+	}
+}
+
+func TestRequireSession(t *testing.T){
+	user := model.User{ID: 42, Email: "reader@example.com", Role: model.RoleUser}
+	admin := model.User{ID: 1, Email: "admin@example.com", Role: model.RoleAdmin}
+	secret, prefix, hash, err := auth.NewAPIKey()
+	if err != nil{
+		t.Fatalf("NewAPIKey() failed: %v", err)
+	}
+	keys := stubAPIKeys{prefix: {ID: 1, UserID: user.ID, Prefix: prefix, KeyHash: hash, Scopes: model.APIKeyScopes}}
+	router, tokens := setupAuthRouterWithKeys(t, stubUsers{user.ID: user, admin.ID: admin}, keys)
+
+	accessToken, _ := issueAccessToken(tokens, user, time.Hour)
+	impersonationToken, _ := issueImpersonationToken(tokens, user, admin, time.Hour)
+
+	cases := []struct{
+		name	string
+		header	string
+		value	string
+		code	int
+	}{
+		{"access token", "Authorization", "Bearer " + accessToken, http.StatusOK},
+		{"API key", "X-API-Key", secret, http.StatusForbidden},
+		{"impersonation token", "Authorization", "Bearer " + impersonationToken, http.StatusForbidden},
+	}
+
+	for _, tc := range cases{
+		recorder := httptest.NewRecorder()
+		request := newAuthRequest(http.MethodGet, "/v1/me/api-keys", tc.header, tc.value)
+
+		router.ServeHTTP(recorder, request)
+
+		if recorder.Code != tc.code{
+			t.Errorf("%s: expected status code %d but got %d", tc.name, tc.code, recorder.Code)
+		}
+	}
+}
+
+func TestAuthMiddlewareAPIKeys(t *testing.T){
+	user := model.User{ID: 42, Email: "script@example.com", Role: model.RoleUser}
+	admin := model.User{ID: 1, Email: "admin@example.com", Role: model.RoleAdmin}
+
+	var nextID int64
+	newKey := func(userID int64, scopes ...string) (string, model.APIKey){
+		nextID++
+		secret, prefix, hash, err := auth.NewAPIKey()
+		if err != nil{
+			t.Fatalf("NewAPIKey() failed: %v", err)
+		}
+		return secret, model.APIKey{ID: nextID, UserID: userID, Prefix: prefix, KeyHash: hash, Scopes: scopes}
+	}
+
+	accountSecret, account := newKey(user.ID, model.ScopeAccount)
+	writerSecret, writer := newKey(user.ID, model.ScopeWriteBooks)
+	revokedSecret, revoked := newKey(user.ID, model.ScopeWriteBooks)
+	revokedAt := time.Now().Add(-time.Minute)
+	revoked.RevokedAt = &revokedAt
+	expiredSecret, expired := newKey(user.ID, model.ScopeWriteBooks)
+	expired.ExpiresAt = &revokedAt
+	adminSecret, adminKey := newKey(admin.ID, model.APIKeyScopes...)
+
+	keys := stubAPIKeys{account.Prefix: account, writer.Prefix: writer, revoked.Prefix: revoked, expired.Prefix: expired, adminKey.Prefix: adminKey}
+	router, _ := setupAuthRouterWithKeys(t, stubUsers{user.ID: user, admin.ID: admin}, keys)
+
+	cases := []struct{
+		name	string
+		method	string
+		path	string
+		header	string
+		value	string
+		code	int
+	}{
+		{"key with scope", http.MethodPost, "/v1/books", "Authorization", "Bearer " + writerSecret, http.StatusCreated},
+		{"key in X-API-Key header", http.MethodPost, "/v1/books", "X-API-Key", writerSecret, http.StatusCreated},
+		{"key without scope", http.MethodPost, "/v1/books", "X-API-Key", accountSecret, http.StatusForbidden},
+		{"revoked key", http.MethodPost, "/v1/books", "X-API-Key", revokedSecret, http.StatusUnauthorized},
+		{"expired key", http.MethodPost, "/v1/books", "X-API-Key", expiredSecret, http.StatusUnauthorized},
+		{"tampered key", http.MethodPost, "/v1/books", "X-API-Key", writerSecret + "x", http.StatusUnauthorized},
+		{"admin key on admin route", http.MethodGet, "/v1/admin/users", "X-API-Key", adminSecret, http.StatusForbidden},
+	}
+
+	for _, tc := range cases{
+		recorder := httptest.NewRecorder()
+		request := newAuthRequest(tc.method, tc.path, tc.header, tc.value)
+
+		router.ServeHTTP(recorder, request)
+
+		if recorder.Code != tc.code{
+			t.Errorf("%s: expected status code %d but got %d", tc.name, tc.code, recorder.Code)
+		}
+	}
+}
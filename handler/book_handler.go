@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"bookstore-api/metrics"
 	"bookstore-api/model"
 	"bookstore-api/repository"
 	"net/http"
@@ -10,10 +11,10 @@ import (
 )
 
 type BookHandler struct {
-	repo *repository.BookRepository
+	repo repository.BookStore
 }
 
-func NewBookHandler(repo *repository.BookRepository) *BookHandler{
+func NewBookHandler(repo repository.BookStore) *BookHandler{
 	return &BookHandler{repo: repo}
 }
 
@@ -23,27 +24,34 @@ func NewBookHandler(repo *repository.BookRepository) *BookHandler{
 // @Tags books
 // @Accept json
 // @Produce json
-// @Param book body model.BookInput true "Book Input"
+// @Param book body model.Book true "Book Input"
 // @Success 201 {object} model.Book
-// @Failure 400 {object} gin.H{"error": "Bad Request"}
-// @Failure 500 {object} gin.H{"error": "Internal Server Error"}
-// @Router /books [post]
+// @Failure 400 {object} model.AppError
+// @Failure 401 {object} model.AppError
+// @Failure 403 {object} model.AppError
+// @Failure 500 {object} model.AppError
+// @Security BearerAuth
+// @Router /v1/books [post]
 func (h *BookHandler) CreateBookHandler(c *gin.Context){
 	var input model.Book
 
 	if err := c.ShouldBindJSON(&input); err != nil{
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input: " + err.Error()})
+		c.JSON(http.StatusBadRequest, model.AppError{
+			Code: http.StatusBadRequest,
+			Message: "Invalid input: " + err.Error(),
+		})
+		return
 	}
 
-	bookID, err := h.repo.CreateBook(input)
+	book, err := h.repo.CreateBook(c.Request.Context(), input)
 	if err != nil{
-		c.JSON(http.StatusInternalServerError, gin.H{"error" : "Failed to create book"})
+		ErrorHandler(c, err)
 		return
 	}
 
-	input.ID = bookID
+	metrics.BooksCreated.Inc()
 
-	c.JSON(http.StatusCreated, input)
+	c.JSON(http.StatusCreated, book)
 
 }
 
@@ -53,13 +61,28 @@ func (h *BookHandler) CreateBookHandler(c *gin.Context){
 // @Tags books
 // @Accept json
 // @Produce json
+// @Param If-None-Match header string false "ETag of the cached list"
+// @Param If-Modified-Since header string false "Last-Modified of the cached list"
 // @Success 200 {array} model.Book
-// @Failure 500 {object} gin.H{"error": "Internal Server Error"}
-// @Router /books [get]
+// @Success 304 "Not Modified"
+// @Failure 500 {object} model.AppError
+// @Router /v1/books [get]
 func (h *BookHandler) GetBooksHandler(c *gin.Context){
-	books, err := h.repo.GetBooks()
+	// The list is only loaded when the client's copy is out of date. Both reads
+	// go to the same replica, so the validators describe the list sent.
+	ctx := repository.PinReplica(c.Request.Context())
+	modifiedAt, err := h.repo.BooksModifiedAt(ctx)
 	if err != nil{
-		c.JSON(http.StatusInternalServerError, gin.H{"error" : "Failed to retrieve books"})
+		ErrorHandler(c, err)
+		return
+	}
+	if notModified(c, "books-" + strconv.FormatInt(modifiedAt.UnixNano(), 36), modifiedAt){
+		return
+	}
+
+	books, err := h.repo.GetBooks(ctx)
+	if err != nil{
+		ErrorHandler(c, err)
 		return
 	}
 
@@ -73,26 +96,35 @@ func (h *BookHandler) GetBooksHandler(c *gin.Context){
 // @Accept json
 // @Produce json
 // @Param id path int true "Book ID"
+// @Param If-None-Match header string false "ETag of the cached book"
+// @Param If-Modified-Since header string false "Last-Modified of the cached book"
 // @Success 200 {object} model.Book
-// @Failure 400 {object} gin.H{"error": "Bad Request"}
-// @Failure 404 {object} gin.H{"error": "Book not found"}
-// @Failure 500 {object} gin.H{"error": "Internal Server Error"}
-// @Router /books/{id} [get]
+// @Success 304 "Not Modified"
+// @Failure 400 {object} model.AppError
+// @Failure 404 {object} model.AppError
+// @Failure 500 {object} model.AppError
+// @Router /v1/books/{id} [get]
 func (h *BookHandler) GetBookByIDHandler(c *gin.Context){
 	idStr := c.Param("id")
 
 	id, err := strconv.Atoi(idStr)
-	if (err != nil){
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid book ID"})
+	if err != nil{
+		c.JSON(http.StatusBadRequest, model.AppError{
+			Code: http.StatusBadRequest,
+			Message: "Invalid book ID",
+		})
 		return
 	}
 
-	book, err := h.repo.GetBookByID(id)
+	book, err := h.repo.GetBookByID(c.Request.Context(), id)
 	if err != nil{
 		ErrorHandler(c, err)
 		return
 	}
 
+	if notModified(c, "book-" + strconv.Itoa(book.ID) + "-" + strconv.FormatInt(book.UpdatedAt.UnixNano(), 36), book.UpdatedAt){
+		return
+	}
 	c.JSON(http.StatusOK, book)
 }
 
@@ -103,12 +135,15 @@ func (h *BookHandler) GetBookByIDHandler(c *gin.Context){
 // @Accept json
 // @Produce json
 // @Param id path int true "Book ID"
-// @Param book body model.BookInput true "Book Input"
+// @Param book body model.Book true "Book Input"
 // @Success 200 {object} model.Book
-// @Failure 400 {object} gin.H{"error": "Bad Request"}
-// @Failure 404 {object} gin.H{"error": "Book not found"}
-// @Failure 500 {object} gin.H{"error": "Internal Server Error"}
-// @Router /books/{id} [put]
+// @Failure 400 {object} model.AppError
+// @Failure 401 {object} model.AppError
+// @Failure 403 {object} model.AppError
+// @Failure 404 {object} model.AppError
+// @Failure 500 {object} model.AppError
+// @Security BearerAuth
+// @Router /v1/books/{id} [put]
 func (h *BookHandler) UpdateBookHandler(c *gin.Context){
 	idStr := c.Param("id")
 
@@ -130,27 +165,28 @@ func (h *BookHandler) UpdateBookHandler(c *gin.Context){
 		return
 	}
 
-	err = h.repo.UpdateBook(id, input)
+	book, err := h.repo.UpdateBook(c.Request.Context(), id, input)
 	if err != nil{
 		ErrorHandler(c, err)
 		return
 	}
-	input.ID = id
-	c.JSON(http.StatusOK, input)
+	c.JSON(http.StatusOK, book)
 }
 
 // DeleteBookHandler adalah fungsi untuk menangani permintaan menghapus buku berdasarkan ID
 // @Summary Delete a book by ID
 // @Description Delete a book by its ID from the database
 // @Tags books
-// @Accept json
 // @Produce json
 // @Param id path int true "Book ID"
-// @Success 200 {object} gin.H{"message": "Book deleted successfully"}
-// @Failure 400 {object} gin.H{"error": "Bad Request"}
-// @Failure 404 {object} gin.H{"error": "Book not found"}	
-// @Failure 500 {object} gin.H{"error": "Internal Server Error"}
-// @Router /books/{id} [delete]
+// @Success 204 "No Content"
+// @Failure 400 {object} model.AppError
+// @Failure 401 {object} model.AppError
+// @Failure 403 {object} model.AppError
+// @Failure 404 {object} model.AppError
+// @Failure 500 {object} model.AppError
+// @Security BearerAuth
+// @Router /v1/books/{id} [delete]
 func (h *BookHandler) DeleteBookHandler(c *gin.Context){
 	idStr := c.Param("id")
 
@@ -163,7 +199,7 @@ func (h *BookHandler) DeleteBookHandler(c *gin.Context){
 		return
 	}
 
-	err = h.repo.DeleteBook(id)
+	err = h.repo.DeleteBook(c.Request.Context(), id)
 	if err != nil{
 		ErrorHandler(c, err)
 		return
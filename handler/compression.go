@@ -0,0 +1,171 @@
+package handler
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+)
+
+// compressMinSize is the smallest body worth compressing. Smaller bodies would
+// hardly shrink and are sent as they are.
+const compressMinSize = 1024
+
+// brotliLevel trades ratio for speed, since responses are compressed on every request
+const brotliLevel = 4
+
+// Compress encodes responses with brotli or gzip, whichever the client prefers
+// in Accept-Encoding, with brotli winning a tie. Only text and JSON bodies of
+// at least compressMinSize bytes are compressed, and responses a handler
+// already encoded itself, such as /metrics, are left alone.
+func Compress() gin.HandlerFunc{
+	return func(c *gin.Context){
+		encoding := negotiateEncoding(c.GetHeader("Accept-Encoding"))
+		if encoding == "" || c.Request.Method == http.MethodHead{
+			c.Next()
+			return
+		}
+
+		original := c.Writer
+		writer := &compressWriter{ResponseWriter: original, encoding: encoding}
+		c.Writer = writer
+		defer func(){
+			// A panic discards the buffered body so Recovery can write its own response
+			if recovered := recover(); recovered != nil{
+				c.Writer = original
+				panic(recovered)
+			}
+		}()
+
+		c.Next()
+
+		writer.finish()
+		c.Writer = original
+	}
+}
+
+// negotiateEncoding picks br or gzip from an Accept-Encoding header, or ""
+// when the client accepts neither
+func negotiateEncoding(acceptEncoding string) string{
+	best, bestQuality := "", 0.0
+	wildcard := -1.0
+	qualities := map[string]float64{}
+	for _, part := range strings.Split(acceptEncoding, ","){
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		quality := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok{
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil{
+				continue
+			}
+			quality = parsed
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "*"{
+			wildcard = quality
+			continue
+		}
+		qualities[name] = quality
+	}
+
+	for _, encoding := range []string{"br", "gzip"}{
+		quality, listed := qualities[encoding]
+		if !listed{
+			quality = wildcard
+		}
+		if quality > bestQuality{
+			best, bestQuality = encoding, quality
+		}
+	}
+	return best
+}
+
+// compressible reports whether a body of this type shrinks when compressed
+func compressible(contentType string) bool{
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil{
+		return false
+	}
+	return strings.HasPrefix(mediaType, "text/") || mediaType == "application/json" || mediaType == "application/javascript"
+}
+
+// compressWriter holds the body back until compressMinSize bytes were written
+// or the handler returned, then decides whether to compress it
+type compressWriter struct {
+	gin.ResponseWriter
+	encoding	string
+	buffer		[]byte
+	decided		bool
+	// encoder is set once the body is being compressed
+	encoder		io.WriteCloser
+}
+
+func (w *compressWriter) Write(data []byte) (int, error){
+	if !w.decided{
+		w.buffer = append(w.buffer, data...)
+		if len(w.buffer) < compressMinSize{
+			return len(data), nil
+		}
+		if err := w.decide(); err != nil{
+			return 0, err
+		}
+		return len(data), nil
+	}
+	if w.encoder != nil{
+		return w.encoder.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *compressWriter) WriteString(s string) (int, error){
+	return w.Write([]byte(s))
+}
+
+// decide starts compressing if the buffered body is large and compressible,
+// then writes out the buffer
+func (w *compressWriter) decide() error{
+	w.decided = true
+	header := w.Header()
+	if !compressible(header.Get("Content-Type")) || header.Get("Content-Encoding") != ""{
+		return w.flushBuffer(w.ResponseWriter)
+	}
+
+	// Caches must not hand a compressed body to a client that did not ask for it
+	header.Add("Vary", "Accept-Encoding")
+	if len(w.buffer) < compressMinSize{
+		return w.flushBuffer(w.ResponseWriter)
+	}
+
+	header.Set("Content-Encoding", w.encoding)
+	header.Del("Content-Length")
+	if w.encoding == "br"{
+		w.encoder = brotli.NewWriterLevel(w.ResponseWriter, brotliLevel)
+	} else {
+		w.encoder = gzip.NewWriter(w.ResponseWriter)
+	}
+	return w.flushBuffer(w.encoder)
+}
+
+func (w *compressWriter) flushBuffer(to io.Writer) error{
+	if len(w.buffer) == 0{
+		return nil
+	}
+	_, err := to.Write(w.buffer)
+	w.buffer = nil
+	return err
+}
+
+// finish writes whatever is still buffered and completes the compressed stream
+func (w *compressWriter) finish(){
+	if !w.decided{
+		w.decide()
+	}
+	if w.encoder != nil{
+		w.encoder.Close()
+	}
+}
@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"bookstore-api/model"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+)
+
+func TestNegotiateEncoding(t *testing.T){
+	cases := map[string]string{
+		"": "",
+		"gzip": "gzip",
+		"gzip, deflate, br": "br",
+		"br;q=0.5, gzip": "gzip",
+		"br;q=0, gzip;q=0": "",
+		"identity": "",
+		"*": "br",
+		"*;q=0.5, br;q=0": "gzip",
+		"GZIP": "gzip",
+	}
+	for acceptEncoding, expected := range cases{
+		if got := negotiateEncoding(acceptEncoding); got != expected{
+			t.Errorf("negotiateEncoding(%q) = %q, expected %q", acceptEncoding, got, expected)
+		}
+	}
+}
+
+func TestCompress(t *testing.T){
+	gin.SetMode(gin.TestMode)
+	books := newMemoryBooks()
+	for i := 0; i < 50; i++{
+		books.CreateBook(context.Background(), model.Book{Title: "Dune", Author: "Frank Herbert", Description: "A desert planet"})
+	}
+	handler := NewBookHandler(books)
+	router := gin.New()
+	router.Use(Compress())
+	router.GET("/v1/books", handler.GetBooksHandler)
+	router.GET("/v1/books/:id", handler.GetBookByIDHandler)
+	// No documented route serves binary content, so this one bypasses the contract check
+	router.GET("/binary", func(c *gin.Context){
+		c.Data(http.StatusOK, "image/png", bytes.Repeat([]byte{0}, 4096))
+	})
+	server := validateContract(t, router)
+
+	plain := httptest.NewRecorder()
+	server.ServeHTTP(plain, httptest.NewRequest(http.MethodGet, "/v1/books", nil))
+	large := plain.Body.String()
+
+	decoders := map[string]func(io.Reader) (io.Reader, error){
+		"gzip": func(r io.Reader) (io.Reader, error){ return gzip.NewReader(r) },
+		"br": func(r io.Reader) (io.Reader, error){ return brotli.NewReader(r), nil },
+	}
+	for encoding, decode := range decoders{
+		req := httptest.NewRequest(http.MethodGet, "/v1/books", nil)
+		req.Header.Set("Accept-Encoding", encoding)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+
+		if got := w.Header().Get("Content-Encoding"); got != encoding{
+			t.Fatalf("Expected Content-Encoding %q but got %q", encoding, got)
+		}
+		if got := w.Header().Get("Vary"); got != "Accept-Encoding"{
+			t.Errorf("Expected Vary: Accept-Encoding but got %q", got)
+		}
+		if w.Body.Len() >= len(large){
+			t.Errorf("%s: expected a smaller body but got %d bytes", encoding, w.Body.Len())
+		}
+		reader, err := decode(w.Body)
+		if err != nil{
+			t.Fatalf("%s: failed to open the body: %v", encoding, err)
+		}
+		body, err := io.ReadAll(reader)
+		if err != nil || string(body) != large{
+			t.Errorf("%s: body did not survive the round trip: %v", encoding, err)
+		}
+	}
+
+	for path, target := range map[string]http.Handler{"/v1/books/1": server, "/binary": router}{
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Accept-Encoding", "gzip, br")
+		w := httptest.NewRecorder()
+		target.ServeHTTP(w, req)
+		if got := w.Header().Get("Content-Encoding"); got != ""{
+			t.Errorf("%s: expected no compression but got %q", path, got)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// catalogCacheControl lets browsers and shared caches keep book responses but
+// revalidate them on every use, which is cheap thanks to the 304 handling
+const catalogCacheControl = "public, no-cache"
+
+// notModified sets the validators of a response and answers with 304 when the
+// client's copy is still current. If-None-Match takes precedence over
+// If-Modified-Since (RFC 9110, section 13.2.2). The ETag is weak because
+// compression changes the bytes but not the content.
+func notModified(c *gin.Context, etag string, modifiedAt time.Time) bool{
+	etag = `W/"` + etag + `"`
+	c.Header("ETag", etag)
+	c.Header("Last-Modified", modifiedAt.UTC().Format(http.TimeFormat))
+	c.Header("Cache-Control", catalogCacheControl)
+
+	fresh := false
+	if ifNoneMatch := c.GetHeader("If-None-Match"); ifNoneMatch != ""{
+		fresh = etagMatches(ifNoneMatch, etag)
+	} else if since, err := http.ParseTime(c.GetHeader("If-Modified-Since")); err == nil{
+		// HTTP dates have whole seconds
+		fresh = !modifiedAt.Truncate(time.Second).After(since)
+	}
+
+	if fresh{
+		c.Status(http.StatusNotModified)
+	}
+	return fresh
+}
+
+// etagMatches compares a list of entity tags the weak way, ignoring W/ prefixes
+func etagMatches(ifNoneMatch, etag string) bool{
+	for _, candidate := range strings.Split(ifNoneMatch, ","){
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/"){
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"bookstore-api/model"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func getConditional(server http.Handler, path string, headers map[string]string) *httptest.ResponseRecorder{
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	for name, value := range headers{
+		req.Header.Set(name, value)
+	}
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	return w
+}
+
+func TestBooksAnswerConditionalRequests(t *testing.T){
+	gin.SetMode(gin.TestMode)
+	repo := newMemoryBooks()
+	repo.CreateBook(context.Background(), model.Book{Title: "Dune", Author: "Frank Herbert"})
+	books := NewBookHandler(repo)
+	router := gin.New()
+	router.GET("/v1/books", books.GetBooksHandler)
+	router.GET("/v1/books/:id", books.GetBookByIDHandler)
+	server := validateContract(t, router)
+
+	for _, path := range []string{"/v1/books", "/v1/books/1"}{
+		first := getConditional(server, path, nil)
+		if first.Code != http.StatusOK{
+			t.Fatalf("%s: expected status code 200 but got %d", path, first.Code)
+		}
+		etag, lastModified := first.Header().Get("ETag"), first.Header().Get("Last-Modified")
+		if etag == "" || lastModified == ""{
+			t.Fatalf("%s: expected ETag and Last-Modified but got %v", path, first.Header())
+		}
+		if got := first.Header().Get("Cache-Control"); got != catalogCacheControl{
+			t.Errorf("%s: expected Cache-Control %q but got %q", path, catalogCacheControl, got)
+		}
+
+		if w := getConditional(server, path, map[string]string{"If-None-Match": etag}); w.Code != http.StatusNotModified || w.Body.Len() != 0{
+			t.Errorf("%s: expected an empty 304 for a matching ETag but got %d", path, w.Code)
+		}
+		if w := getConditional(server, path, map[string]string{"If-Modified-Since": lastModified}); w.Code != http.StatusNotModified{
+			t.Errorf("%s: expected 304 for an unchanged Last-Modified but got %d", path, w.Code)
+		}
+		// A stale ETag wins over a current date
+		stale := map[string]string{"If-None-Match": `W/"stale"`, "If-Modified-Since": lastModified}
+		if w := getConditional(server, path, stale); w.Code != http.StatusOK{
+			t.Errorf("%s: expected 200 for a stale ETag but got %d", path, w.Code)
+		}
+	}
+
+	bookETag := getConditional(server, "/v1/books/1", nil).Header().Get("ETag")
+	repo.UpdateBook(context.Background(), 1, model.Book{Title: "Dune Messiah", Author: "Frank Herbert"})
+	if w := getConditional(server, "/v1/books/1", map[string]string{"If-None-Match": bookETag}); w.Code != http.StatusOK{
+		t.Errorf("Expected the updated book to be sent again but got %d", w.Code)
+	}
+
+	// Deleting a book changes the list even though no remaining book changed
+	repo.CreateBook(context.Background(), model.Book{Title: "Emma", Author: "Jane Austen"})
+	listETag := getConditional(server, "/v1/books", nil).Header().Get("ETag")
+	repo.DeleteBook(context.Background(), 2)
+	if w := getConditional(server, "/v1/books", map[string]string{"If-None-Match": listETag}); w.Code != http.StatusOK{
+		t.Errorf("Expected the list to be sent again after a delete but got %d", w.Code)
+	}
+}
+
+func TestEtagMatches(t *testing.T){
+	etag := `W/"books-1"`
+	cases := map[string]bool{
+		`W/"books-1"`: true,
+		`"books-1"`: true,
+		`W/"books-0", W/"books-1"`: true,
+		`*`: true,
+		`W/"books-2"`: false,
+	}
+	for ifNoneMatch, expected := range cases{
+		if got := etagMatches(ifNoneMatch, etag); got != expected{
+			t.Errorf("etagMatches(%q) = %v, expected %v", ifNoneMatch, got, expected)
+		}
+	}
+}
+
+func TestIfModifiedSinceIgnoresSubsecondChanges(t *testing.T){
+	gin.SetMode(gin.TestMode)
+	modifiedAt := time.Date(2026, 10, 1, 12, 0, 0, 500_000_000, time.UTC)
+	router := gin.New()
+	router.GET("/", func(c *gin.Context){
+		if !notModified(c, "x", modifiedAt){
+			c.String(http.StatusOK, "fresh")
+		}
+	})
+
+	cases := map[string]int{
+		"Thu, 01 Oct 2026 12:00:00 GMT": http.StatusNotModified,
+		"Thu, 01 Oct 2026 11:59:59 GMT": http.StatusOK,
+		"not a date": http.StatusOK,
+	}
+	for since, expected := range cases{
+		if w := getConditional(router, "/", map[string]string{"If-Modified-Since": since}); w.Code != expected{
+			t.Errorf("If-Modified-Since %q: expected %d but got %d", since, expected, w.Code)
+		}
+	}
+}
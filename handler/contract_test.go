@@ -0,0 +1,314 @@
+package handler
+
+import (
+	"bookstore-api/model"
+	"bookstore-api/openapi"
+	"bookstore-api/repository"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/gin-gonic/gin"
+)
+
+// contractRouter is built once from openapi/openapi.yaml and shared by every test
+var contractRouter = sync.OnceValues(func() (routers.Router, error){
+	spec, err := openapi.JSON()
+	if err != nil{
+		return nil, err
+	}
+
+	loader := openapi3.NewLoader()
+	doc, err := loader.LoadFromData(spec)
+	if err != nil{
+		return nil, err
+	}
+	if err := doc.Validate(loader.Context); err != nil{
+		return nil, err
+	}
+	// The docs page and its script are checked as plain text
+	openapi3filter.RegisterBodyDecoder("text/html", openapi3filter.PlainBodyDecoder)
+	openapi3filter.RegisterBodyDecoder("text/javascript", openapi3filter.PlainBodyDecoder)
+	return gorillamux.NewRouter(doc)
+})
+
+// contractValidator serves requests through next and fails the test whenever
+// the exchange breaks the OpenAPI contract:
+//   - the route must be documented; a deprecated alias without /v1 is checked
+//     as its /v1 successor, and a CORS preflight as the route it asks about
+//   - a request that matches the documented schema must get a documented
+//     response whose body, decompressed, matches its schema
+//   - a request that breaks the schema must be rejected with a documented 4xx
+type contractValidator struct {
+	t		*testing.T
+	next	http.Handler
+}
+
+// validateContract wraps a router so every request served in a test is checked against the spec
+func validateContract(t *testing.T, next http.Handler) http.Handler{
+	t.Helper()
+	if _, err := contractRouter(); err != nil{
+		t.Fatalf("Failed to load the OpenAPI document: %v", err)
+	}
+	return contractValidator{t: t, next: next}
+}
+
+func (v contractValidator) ServeHTTP(w http.ResponseWriter, req *http.Request){
+	v.t.Helper()
+	router, _ := contractRouter()
+
+	var body []byte
+	if req.Body != nil{
+		body, _ = io.ReadAll(req.Body)
+	}
+	restoreBody := func(){
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	// The route the request is checked against, which the request itself is
+	// served from unchanged
+	documented := req.Clone(req.Context())
+	if method := req.Header.Get("Access-Control-Request-Method"); req.Method == http.MethodOptions && method != ""{
+		documented.Method = method
+	}
+	if !strings.HasPrefix(req.URL.Path, "/v1/") && !isDocumentedPath(router, documented){
+		documented.URL.Path = "/v1" + req.URL.Path
+	}
+
+	restoreBody()
+	route, pathParams, err := router.FindRoute(documented)
+	if err != nil{
+		v.t.Errorf("%s %s is not described in the OpenAPI document: %v", req.Method, req.URL.Path, err)
+		v.next.ServeHTTP(w, req)
+		return
+	}
+	// A preflight is answered by the CORS middleware for any documented route
+	if documented.Method != req.Method{
+		v.next.ServeHTTP(w, req)
+		return
+	}
+
+	documented.Body = io.NopCloser(bytes.NewReader(body))
+	requestInput := &openapi3filter.RequestValidationInput{
+		Request: documented,
+		PathParams: pathParams,
+		Route: route,
+		Options: &openapi3filter.Options{
+			AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+			MultiError: true,
+		},
+	}
+	requestErr := openapi3filter.ValidateRequest(context.Background(), requestInput)
+
+	restoreBody()
+	recorder := httptest.NewRecorder()
+	v.next.ServeHTTP(recorder, req)
+
+	if requestErr != nil && (recorder.Code < 400 || recorder.Code >= 500){
+		v.t.Errorf("%s %s: request breaks the contract but was answered with %d: %v", req.Method, req.URL.Path, recorder.Code, requestErr)
+	}
+	defer copyResponse(w, recorder)
+
+	// Nobody is left to read the answer to a client that went away
+	if recorder.Code == StatusClientClosedRequest{
+		return
+	}
+
+	responseBody, err := decodeBody(recorder.Header().Get("Content-Encoding"), recorder.Body.Bytes())
+	if err != nil{
+		v.t.Errorf("%s %s: failed to decode the %s response: %v", req.Method, req.URL.Path, recorder.Header().Get("Content-Encoding"), err)
+		return
+	}
+
+	responseInput := &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: requestInput,
+		Status: recorder.Code,
+		Header: recorder.Header(),
+		Options: &openapi3filter.Options{
+			IncludeResponseStatus: true,
+			MultiError: true,
+		},
+	}
+	responseInput.SetBodyBytes(responseBody)
+	if err := openapi3filter.ValidateResponse(context.Background(), responseInput); err != nil{
+		v.t.Errorf("%s %s: %d response breaks the contract: %v\nbody: %s", req.Method, req.URL.Path, recorder.Code, err, recorder.Body.String())
+	}
+	// The schema check only decodes the first JSON value, so a handler that
+	// writes a second response after an error would slip through
+	if strings.HasPrefix(recorder.Header().Get("Content-Type"), "application/json") && !isSingleJSONValue(responseBody){
+		v.t.Errorf("%s %s: response body is not exactly one JSON value, was the response written twice?\nbody: %s", req.Method, req.URL.Path, responseBody)
+	}
+}
+
+func isDocumentedPath(router routers.Router, req *http.Request) bool{
+	_, _, err := router.FindRoute(req)
+	return err == nil
+}
+
+// decodeBody undoes the Content-Encoding of a response
+func decodeBody(encoding string, body []byte) ([]byte, error){
+	switch encoding{
+	case "":
+		return body, nil
+	case "gzip":
+		reader, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil{
+			return nil, err
+		}
+		return io.ReadAll(reader)
+	case "br":
+		return io.ReadAll(brotli.NewReader(bytes.NewReader(body)))
+	}
+	return nil, fmt.Errorf("unknown encoding %q", encoding)
+}
+
+func copyResponse(w http.ResponseWriter, recorder *httptest.ResponseRecorder){
+	for name, values := range recorder.Header(){
+		w.Header()[name] = values
+	}
+	w.WriteHeader(recorder.Code)
+	w.Write(recorder.Body.Bytes())
+}
+
+func isSingleJSONValue(body []byte) bool{
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	var value any
+	if err := decoder.Decode(&value); err != nil{
+		return false
+	}
+	return decoder.Decode(&value) == io.EOF
+}
+
+// memoryBooks is an in-memory repository.BookStore
+type memoryBooks struct {
+	books		map[int]model.Book
+	nextID		int
+	modifiedAt	time.Time
+}
+
+func newMemoryBooks() *memoryBooks{
+	return &memoryBooks{books: map[int]model.Book{}, nextID: 1, modifiedAt: time.Now()}
+}
+
+// touch returns a modification time after every earlier one, even when the
+// clock has not moved on
+func (m *memoryBooks) touch() time.Time{
+	now := time.Now()
+	if !now.After(m.modifiedAt){
+		now = m.modifiedAt.Add(time.Microsecond)
+	}
+	m.modifiedAt = now
+	return now
+}
+
+func (m *memoryBooks) CreateBook(ctx context.Context, book model.Book) (model.Book, error){
+	book.ID = m.nextID
+	book.CreatedAt = m.touch()
+	book.UpdatedAt = book.CreatedAt
+	m.books[book.ID] = book
+	m.nextID++
+	return book, nil
+}
+
+func (m *memoryBooks) GetBooks(ctx context.Context) ([]model.Book, error){
+	books := make([]model.Book, 0, len(m.books))
+	for id := 1; id < m.nextID; id++{
+		if book, ok := m.books[id]; ok{
+			books = append(books, book)
+		}
+	}
+	return books, nil
+}
+
+func (m *memoryBooks) GetBookByID(ctx context.Context, id int) (model.Book, error){
+	book, ok := m.books[id]
+	if !ok{
+		return model.Book{}, repository.ErrBookNotFound
+	}
+	return book, nil
+}
+
+func (m *memoryBooks) UpdateBook(ctx context.Context, id int, book model.Book) (model.Book, error){
+	existing, ok := m.books[id]
+	if !ok{
+		return model.Book{}, repository.ErrBookNotFound
+	}
+	book.ID = id
+	book.CreatedAt = existing.CreatedAt
+	book.UpdatedAt = m.touch()
+	m.books[id] = book
+	return book, nil
+}
+
+func (m *memoryBooks) DeleteBook(ctx context.Context, id int) error{
+	if _, ok := m.books[id]; !ok{
+		return repository.ErrBookNotFound
+	}
+	delete(m.books, id)
+	m.touch()
+	return nil
+}
+
+func (m *memoryBooks) BooksModifiedAt(ctx context.Context) (time.Time, error){
+	return m.modifiedAt, nil
+}
+
+func TestBookHandlersMatchContract(t *testing.T){
+	gin.SetMode(gin.TestMode)
+	books := NewBookHandler(newMemoryBooks())
+	router := gin.New()
+	router.GET("/v1/books", books.GetBooksHandler)
+	router.GET("/v1/books/:id", books.GetBookByIDHandler)
+	router.POST("/v1/books", books.CreateBookHandler)
+	router.PUT("/v1/books/:id", books.UpdateBookHandler)
+	router.DELETE("/v1/books/:id", books.DeleteBookHandler)
+	server := validateContract(t, router)
+
+	cases := []struct{
+		method	string
+		path	string
+		body	string
+		status	int
+	}{
+		{http.MethodGet, "/v1/books", "", http.StatusOK},
+		{http.MethodPost, "/v1/books", `{"title": "Dune", "author": "Frank Herbert", "description": "Spice"}`, http.StatusCreated},
+		{http.MethodPost, "/v1/books", `{"title": "Dune"}`, http.StatusBadRequest},
+		{http.MethodPost, "/v1/books", `{not json`, http.StatusBadRequest},
+		{http.MethodGet, "/v1/books", "", http.StatusOK},
+		{http.MethodGet, "/v1/books/1", "", http.StatusOK},
+		{http.MethodGet, "/v1/books/abc", "", http.StatusBadRequest},
+		{http.MethodGet, "/v1/books/99", "", http.StatusNotFound},
+		{http.MethodPut, "/v1/books/1", `{"title": "Dune Messiah", "author": "Frank Herbert"}`, http.StatusOK},
+		{http.MethodPut, "/v1/books/1", `{"author": "Frank Herbert"}`, http.StatusBadRequest},
+		{http.MethodPut, "/v1/books/99", `{"title": "Dune", "author": "Frank Herbert"}`, http.StatusNotFound},
+		{http.MethodDelete, "/v1/books/1", "", http.StatusNoContent},
+		{http.MethodDelete, "/v1/books/1", "", http.StatusNotFound},
+	}
+
+	for _, tc := range cases{
+		req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+		if tc.body != ""{
+			req.Header.Set("Content-Type", "application/json")
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+
+		if w.Code != tc.status{
+			t.Errorf("%s %s: expected status %d but got %d: %s", tc.method, tc.path, tc.status, w.Code, w.Body.String())
+		}
+	}
+}
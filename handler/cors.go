@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// corsMaxAge is how long browsers may cache a preflight response
+const corsMaxAge = 2 * time.Hour
+
+var (
+	corsAllowedMethods = strings.Join([]string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}, ", ")
+	corsAllowedHeaders = strings.Join([]string{"Authorization", "Content-Type", "X-API-Key", IdempotencyKeyHeader, RequestIDHeader, "If-None-Match", "If-Modified-Since"}, ", ")
+	// corsExposedHeaders are the response headers scripts on another origin may read
+	corsExposedHeaders = strings.Join([]string{
+		RequestIDHeader, IdempotentReplayedHeader, "Retry-After",
+		"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy",
+		"Deprecation", "Sunset", "Link", "ETag",
+	}, ", ")
+)
+
+// CORS lets browser scripts from allowedOrigins call the API. An entry of "*"
+// allows every origin. Requests from other origins are served without CORS
+// headers, so the browser keeps their responses from the script.
+//
+// Credentials are sent in the Authorization or X-API-Key header rather than
+// cookies, so Access-Control-Allow-Credentials is never set.
+//
+// Preflight requests are answered here, before routing, so the middleware must
+// be registered on the engine rather than on a group.
+func CORS(allowedOrigins []string) gin.HandlerFunc{
+	allowAll := slices.Contains(allowedOrigins, "*")
+	allowed := map[string]bool{}
+	for _, origin := range allowedOrigins{
+		allowed[strings.TrimSuffix(origin, "/")] = true
+	}
+
+	return func(c *gin.Context){
+		origin := c.GetHeader("Origin")
+		if origin == ""{
+			c.Next()
+			return
+		}
+		// The response depends on the origin even when it is not allowed
+		c.Writer.Header().Add("Vary", "Origin")
+		if !allowAll && !allowed[origin]{
+			c.Next()
+			return
+		}
+
+		if allowAll{
+			c.Header("Access-Control-Allow-Origin", "*")
+		} else {
+			c.Header("Access-Control-Allow-Origin", origin)
+		}
+
+		if c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""{
+			c.Header("Access-Control-Allow-Methods", corsAllowedMethods)
+			c.Header("Access-Control-Allow-Headers", corsAllowedHeaders)
+			c.Header("Access-Control-Max-Age", strconv.Itoa(int(corsMaxAge.Seconds())))
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		c.Header("Access-Control-Expose-Headers", corsExposedHeaders)
+		c.Next()
+	}
+}
@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func setupCORSRouter(t *testing.T, allowedOrigins ...string) http.Handler{
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(CORS(allowedOrigins))
+	router.GET("/v1/books", NewBookHandler(newMemoryBooks()).GetBooksHandler)
+	return validateContract(t, router)
+}
+
+func TestCORSAnswersPreflightForAllowedOrigins(t *testing.T){
+	router := setupCORSRouter(t, "https://shop.example.com")
+
+	req := httptest.NewRequest(http.MethodOptions, "/v1/books", nil)
+	req.Header.Set("Origin", "https://shop.example.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	req.Header.Set("Access-Control-Request-Headers", "authorization, content-type")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNoContent{
+		t.Fatalf("Expected status code 204 but got %d", w.Code)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://shop.example.com"{
+		t.Errorf("Expected the origin to be allowed but got %q", got)
+	}
+	if w.Header().Get("Access-Control-Allow-Methods") == "" || w.Header().Get("Access-Control-Allow-Headers") == ""{
+		t.Errorf("Expected allowed methods and headers in the preflight response")
+	}
+	if w.Header().Get("Access-Control-Allow-Credentials") != ""{
+		t.Errorf("Expected credentials not to be allowed")
+	}
+}
+
+func TestCORSIgnoresOtherOrigins(t *testing.T){
+	router := setupCORSRouter(t, "https://shop.example.com")
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/books", nil)
+	req.Header.Set("Origin", "https://evil.example.com")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK{
+		t.Errorf("Expected status code 200 but got %d", w.Code)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != ""{
+		t.Errorf("Expected no CORS headers but got Access-Control-Allow-Origin %q", got)
+	}
+	if got := w.Header().Get("Vary"); got != "Origin"{
+		t.Errorf("Expected Vary: Origin but got %q", got)
+	}
+}
+
+func TestCORSAllowsEveryOriginWithWildcard(t *testing.T){
+	router := setupCORSRouter(t, "*")
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/books", nil)
+	req.Header.Set("Origin", "https://shop.example.com")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "*"{
+		t.Errorf("Expected Access-Control-Allow-Origin * but got %q", got)
+	}
+	if w.Header().Get("Access-Control-Expose-Headers") == ""{
+		t.Errorf("Expected exposed headers on the response")
+	}
+}
@@ -0,0 +1,29 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// contextSuccessorRoute holds the route template a deprecated alias stands for,
+// so per-route settings such as rate limits apply to both
+const contextSuccessorRoute = "successor_route"
+
+// Deprecated marks every response of a group as deprecated: Deprecation
+// (RFC 9745) says since when, Sunset (RFC 8594) when the paths stop working and
+// Link points to the same path under successorPrefix.
+func Deprecated(deprecatedAt, sunset time.Time, successorPrefix string) gin.HandlerFunc{
+	deprecation := "@" + strconv.FormatInt(deprecatedAt.Unix(), 10)
+	sunsetDate := sunset.UTC().Format(http.TimeFormat)
+
+	return func(c *gin.Context){
+		c.Header("Deprecation", deprecation)
+		c.Header("Sunset", sunsetDate)
+		c.Header("Link", "<" + successorPrefix + c.Request.URL.Path + `>; rel="successor-version"`)
+		c.Set(contextSuccessorRoute, successorPrefix + c.FullPath())
+		c.Next()
+	}
+}
@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"bookstore-api/model"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestDeprecatedAnnouncesSuccessor(t *testing.T){
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	deprecatedAt := time.Date(2026, time.November, 1, 0, 0, 0, 0, time.UTC)
+	sunset := time.Date(2027, time.May, 1, 0, 0, 0, 0, time.UTC)
+	legacy := router.Group("", Deprecated(deprecatedAt, sunset, "/v1"))
+	books := newMemoryBooks()
+	for i := 0; i < 7; i++{
+		books.CreateBook(context.Background(), model.Book{Title: "Dune", Author: "Frank Herbert"})
+	}
+	legacy.GET("/books/:id", NewBookHandler(books).GetBookByIDHandler)
+
+	w := httptest.NewRecorder()
+	validateContract(t, router).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/books/7", nil))
+
+	expected := map[string]string{
+		"Deprecation": "@1793491200",
+		"Sunset": "Sat, 01 May 2027 00:00:00 GMT",
+		"Link": `</v1/books/7>; rel="successor-version"`,
+	}
+	for header, value := range expected{
+		if got := w.Header().Get(header); got != value{
+			t.Errorf("Expected %s %q but got %q", header, value, got)
+		}
+	}
+	if w.Code != http.StatusOK{
+		t.Errorf("Expected status code 200 but got %d", w.Code)
+	}
+}
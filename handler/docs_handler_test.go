@@ -0,0 +1,35 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestDocsPagePinsSwaggerUI(t *testing.T){
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/docs", DocsHandler)
+
+	w := httptest.NewRecorder()
+	validateContract(t, router).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/docs", nil))
+	page := w.Body.String()
+
+	assets := map[string]string{
+		"swagger-ui.css": swaggerUICSSIntegrity,
+		"swagger-ui-bundle.js": swaggerUIBundleIntegrity,
+	}
+	for name, hash := range assets{
+		url := "https://unpkg.com/swagger-ui-dist@" + swaggerUIVersion + "/" + name
+		expected := `"` + url + `"` + integrityAttributes(hash) + ">"
+		if !strings.Contains(page, expected){
+			t.Errorf("Expected the page to load %s with %s", url, integrityAttributes(hash))
+		}
+		if hash != "" && !strings.HasPrefix(hash, "sha384-"){
+			t.Errorf("%s: expected a sha384 integrity hash but got %q", name, hash)
+		}
+	}
+}
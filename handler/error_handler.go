@@ -3,21 +3,61 @@ package handler
 import (
 	"bookstore-api/model"
 	"bookstore-api/repository"
+	"context"
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 )
 
+// StatusClientClosedRequest is the non-standard status (from nginx) recorded
+// when the client went away before the response was ready
+const StatusClientClosedRequest = 499
+
 // ErrorHandler will handle errors and send appropriate HTTP responses
 func ErrorHandler(c *gin.Context, err error){
 	var appErr model.AppError
 
+	// The database driver may wrap a cancelled query in its own error, so the
+	// request context is checked as well
+	if errors.Is(err, context.Canceled) || errors.Is(c.Request.Context().Err(), context.Canceled){
+		appErr = model.AppError{
+			Code: StatusClientClosedRequest,
+			Message: "Client closed request",
+		}
+		c.JSON(appErr.Code, appErr)
+		return
+	}
+	if errors.Is(err, context.DeadlineExceeded){
+		appErr = model.AppError{
+			Code: http.StatusGatewayTimeout,
+			Message: "The request took too long to process",
+		}
+		c.JSON(appErr.Code, appErr)
+		return
+	}
+
 	switch err{
-	case repository.ErrBookNotFound:
+	case repository.ErrBookNotFound, repository.ErrUserNotFound, repository.ErrAPIKeyNotFound:
 			appErr = model.AppError{
 				Code: http.StatusNotFound,
 				Message: err.Error(),
 			}
+		case repository.ErrMailExists:
+			appErr = model.AppError{
+				Code: http.StatusConflict,
+				Message: err.Error(),
+			}
+		case repository.ErrInvalidPassword:
+			appErr = model.AppError{
+				Code: http.StatusUnauthorized,
+				Message: err.Error(),
+			}
+		case repository.ErrVerificationNotFound:
+			appErr = model.AppError{
+				Code: http.StatusBadRequest,
+				Message: err.Error(),
+			}
 		default:
 			appErr = model.AppError{
 				Code: http.StatusInternalServerError,
@@ -25,4 +65,4 @@ func ErrorHandler(c *gin.Context, err error){
 			}
 	}
 	c.JSON(appErr.Code, appErr)
-}
\ No newline at end of file
+}
@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"bookstore-api/repository"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestErrorHandlerStatusCodes(t *testing.T){
+	gin.SetMode(gin.TestMode)
+
+	var err error
+	router := gin.New()
+	router.GET("/v1/books/:id", func(c *gin.Context){
+		ErrorHandler(c, err)
+	})
+	server := validateContract(t, router)
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct{
+		name string
+		ctx context.Context
+		err error
+		expected int
+	}{
+		{"not found", context.Background(), repository.ErrBookNotFound, http.StatusNotFound},
+		{"query deadline", context.Background(), fmt.Errorf("timeout: %w", context.DeadlineExceeded), http.StatusGatewayTimeout},
+		{"client went away", context.Background(), context.Canceled, StatusClientClosedRequest},
+		{"driver error after disconnect", cancelled, fmt.Errorf("conn closed"), StatusClientClosedRequest},
+		{"other error", context.Background(), fmt.Errorf("boom"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests{
+		t.Run(tt.name, func(t *testing.T){
+			err = tt.err
+			w := httptest.NewRecorder()
+			server.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/books/1", nil).WithContext(tt.ctx))
+
+			if w.Code != tt.expected{
+				t.Errorf("Expected status %d but got %d", tt.expected, w.Code)
+			}
+		})
+	}
+}
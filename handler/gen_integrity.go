@@ -0,0 +1,56 @@
+//go:build ignore
+
+// gen_integrity downloads the Swagger UI assets of a version and prints their
+// Subresource Integrity hashes as the constants of docs_handler.go:
+//
+//	go run gen_integrity.go -version 5.17.14
+package main
+
+import (
+	"crypto/sha512"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+func main(){
+	version := flag.String("version", "", "swagger-ui-dist version to hash")
+	flag.Parse()
+	if *version == ""{
+		log.Fatal("-version is required")
+	}
+
+	css, err := integrity(*version, "swagger-ui.css")
+	if err != nil{
+		log.Fatal(err)
+	}
+	bundle, err := integrity(*version, "swagger-ui-bundle.js")
+	if err != nil{
+		log.Fatal(err)
+	}
+
+	fmt.Printf("const (\n\tswaggerUICSSIntegrity = %q\n\tswaggerUIBundleIntegrity = %q\n)\n", css, bundle)
+}
+
+// integrity returns the sha384 SRI value of an asset of swagger-ui-dist on unpkg
+func integrity(version, name string) (string, error){
+	client := &http.Client{Timeout: time.Minute}
+	response, err := client.Get("https://unpkg.com/swagger-ui-dist@" + version + "/" + name)
+	if err != nil{
+		return "", err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK{
+		return "", fmt.Errorf("%s: unexpected status %s", name, response.Status)
+	}
+
+	hash := sha512.New384()
+	if _, err := io.Copy(hash, response.Body); err != nil{
+		return "", err
+	}
+	return "sha384-" + base64.StdEncoding.EncodeToString(hash.Sum(nil)), nil
+}
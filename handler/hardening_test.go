@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSecurityHeaders(t *testing.T){
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(SecurityHeaders(365 * 24 * time.Hour))
+	router.GET("/openapi.json", OpenAPIHandler)
+	router.GET("/docs", DocsHandler)
+	server := validateContract(t, router)
+
+	for path, csp := range map[string]string{"/openapi.json": apiContentSecurityPolicy, "/docs": docsContentSecurityPolicy}{
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+
+		expected := map[string]string{
+			"Strict-Transport-Security": "max-age=31536000; includeSubDomains",
+			"X-Content-Type-Options": "nosniff",
+			"X-Frame-Options": "DENY",
+			"Content-Security-Policy": csp,
+		}
+		for header, value := range expected{
+			if got := w.Header().Get(header); got != value{
+				t.Errorf("%s: expected %s %q but got %q", path, header, value, got)
+			}
+		}
+	}
+}
+
+func TestMaxBodySize(t *testing.T){
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(MaxBodySize(48))
+	router.POST("/v1/books", NewBookHandler(newMemoryBooks()).CreateBookHandler)
+	server := validateContract(t, router)
+
+	newRequest := func(body string) *http.Request{
+		req := httptest.NewRequest(http.MethodPost, "/v1/books", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		return req
+	}
+	// A chunked body has no Content-Length, so only reading it reveals the size
+	chunked := newRequest(`{"title":"Dune Messiah","author":"Frank Herbert"}`)
+	chunked.ContentLength = -1
+
+	cases := []struct{
+		name	string
+		req		*http.Request
+		status	int
+	}{
+		{"within the limit", newRequest(`{"title":"Dune","author":"Frank Herbert"}`), http.StatusCreated},
+		{"declared too large", newRequest(`{"title":"Dune Messiah","author":"Frank Herbert"}`), http.StatusRequestEntityTooLarge},
+		{"chunked too large", chunked, http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tc := range cases{
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, tc.req)
+		if w.Code != tc.status{
+			t.Errorf("%s: expected status code %d but got %d", tc.name, tc.status, w.Code)
+		}
+	}
+}
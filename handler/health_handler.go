@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	healthOK = "ok"
+	healthFailing = "failing"
+	healthShuttingDown = "shutting_down"
+)
+
+// HealthCheck is one dependency that must be healthy for the API to take traffic
+type HealthCheck struct {
+	Name	string
+	Check	func(ctx context.Context) error
+}
+
+// checkResult is the readiness report of a single dependency
+type checkResult struct {
+	Status		string	`json:"status"`
+	LatencyMS	float64	`json:"latency_ms"`
+	Error		string	`json:"error,omitempty"`
+}
+
+type HealthHandler struct {
+	checks		[]HealthCheck
+	timeout		time.Duration
+	draining	atomic.Bool
+}
+
+// NewHealthHandler runs every readiness check with the given timeout
+func NewHealthHandler(timeout time.Duration, checks ...HealthCheck) *HealthHandler{
+	return &HealthHandler{checks: checks, timeout: timeout}
+}
+
+// StartDraining makes readiness fail so load balancers stop routing new
+// requests here while in-flight ones are finished
+func (h *HealthHandler) StartDraining(){
+	h.draining.Store(true)
+}
+
+// LivenessHandler reports that the process is up and serving HTTP. It never
+// checks dependencies, so a database outage does not get the container restarted.
+func (h *HealthHandler) LivenessHandler(c *gin.Context){
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, gin.H{"status": healthOK})
+}
+
+// ReadinessHandler reports whether the API can serve requests: every check
+// must pass within the timeout and the server must not be shutting down
+func (h *HealthHandler) ReadinessHandler(c *gin.Context){
+	c.Header("Cache-Control", "no-store")
+
+	if h.draining.Load(){
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": healthShuttingDown})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.timeout)
+	defer cancel()
+
+	// Checks run concurrently so the response time is bounded by the timeout
+	// rather than by its multiple
+	results := make(map[string]checkResult, len(h.checks))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range h.checks{
+		wg.Add(1)
+		go func(){
+			defer wg.Done()
+			start := time.Now()
+			err := check.Check(ctx)
+
+			result := checkResult{
+				Status: healthOK,
+				LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+			}
+			if err != nil{
+				result.Status = healthFailing
+				result.Error = err.Error()
+			}
+			mu.Lock()
+			results[check.Name] = result
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	status, code := healthOK, http.StatusOK
+	for _, result := range results{
+		if result.Status != healthOK{
+			status, code = healthFailing, http.StatusServiceUnavailable
+		}
+	}
+
+	c.JSON(code, gin.H{
+		"status": status,
+		"checks": results,
+	})
+}
@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func setupHealthRouter(t *testing.T, h *HealthHandler) http.Handler{
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/healthz", h.LivenessHandler)
+	router.GET("/readyz", h.ReadinessHandler)
+	return validateContract(t, router)
+}
+
+type readinessReport struct {
+	Status	string					`json:"status"`
+	Checks	map[string]checkResult	`json:"checks"`
+}
+
+func getReadiness(t *testing.T, router http.Handler) (int, readinessReport){
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	var report readinessReport
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil{
+		t.Fatalf("Readiness response is not JSON: %v", err)
+	}
+	return w.Code, report
+}
+
+func passing(context.Context) error{
+	return nil
+}
+
+func TestReadinessReportsEveryCheck(t *testing.T){
+	router := setupHealthRouter(t, NewHealthHandler(time.Second,
+		HealthCheck{Name: "database", Check: passing},
+		HealthCheck{Name: "migrations", Check: func(context.Context) error{
+			return errors.New("1 pending migrations, starting with 0008_outbox.sql")
+		}},
+	))
+
+	code, report := getReadiness(t, router)
+	if code != http.StatusServiceUnavailable || report.Status != healthFailing{
+		t.Errorf("Expected 503 failing but got %d %q", code, report.Status)
+	}
+	if report.Checks["database"].Status != healthOK{
+		t.Errorf("Expected the database check to pass, got %+v", report.Checks["database"])
+	}
+	if report.Checks["migrations"].Error == ""{
+		t.Errorf("Expected the migrations check to report its error, got %+v", report.Checks["migrations"])
+	}
+}
+
+func TestReadinessTimesOutSlowChecks(t *testing.T){
+	router := setupHealthRouter(t, NewHealthHandler(50*time.Millisecond,
+		HealthCheck{Name: "database", Check: func(ctx context.Context) error{
+			<-ctx.Done()
+			return ctx.Err()
+		}},
+	))
+
+	start := time.Now()
+	code, report := getReadiness(t, router)
+	if code != http.StatusServiceUnavailable || report.Checks["database"].Status != healthFailing{
+		t.Errorf("Expected a hanging check to fail, got %d %+v", code, report)
+	}
+	if time.Since(start) > time.Second{
+		t.Errorf("Expected the check to be cut off at the timeout, took %s", time.Since(start))
+	}
+}
+
+func TestReadinessFailsWhileDraining(t *testing.T){
+	health := NewHealthHandler(time.Second, HealthCheck{Name: "database", Check: passing})
+	router := setupHealthRouter(t, health)
+
+	if code, _ := getReadiness(t, router); code != http.StatusOK{
+		t.Fatalf("Expected 200 before shutdown but got %d", code)
+	}
+
+	health.StartDraining()
+	code, report := getReadiness(t, router)
+	if code != http.StatusServiceUnavailable || report.Status != healthShuttingDown{
+		t.Errorf("Expected 503 shutting_down but got %d %q", code, report.Status)
+	}
+
+	// Liveness is unaffected so the orchestrator does not kill the draining process
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if w.Code != http.StatusOK{
+		t.Errorf("Expected liveness to stay 200 but got %d", w.Code)
+	}
+}
@@ -0,0 +1,163 @@
+package handler
+
+import (
+	"bookstore-api/logging"
+	"bookstore-api/model"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// IdempotencyKeyHeader carries the client's key for a request that must not be applied twice
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader marks a response that was replayed from an earlier request
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength = 255
+)
+
+// idempotencyStore is the part of the idempotency repository the middleware needs
+type idempotencyStore interface{
+	ReserveIdempotencyKey(ctx context.Context, record model.IdempotencyRecord) (model.IdempotencyRecord, bool, error)
+	CompleteIdempotencyKey(ctx context.Context, record model.IdempotencyRecord) error
+	ReleaseIdempotencyKey(ctx context.Context, record model.IdempotencyRecord) error
+}
+
+// Idempotency makes a route safe to retry when the client sends an
+// Idempotency-Key header. The first request with a key runs normally and its
+// response is stored for ttl; a retry with the same key and request gets the
+// stored response replayed. Reusing a key for a different request is rejected
+// with 422, and a retry while the first request is still running with 409.
+// Server errors are not stored, so the client can retry them. A request that
+// never finishes, e.g. because the instance crashed, holds its key for
+// lockTimeout, after which a retry runs as if it was the first request.
+//
+// Keys are scoped to the user, so the middleware must run after AuthMiddleware.
+// Requests without the header are passed through.
+func Idempotency(store idempotencyStore, ttl, lockTimeout time.Duration) gin.HandlerFunc{
+	return func(c *gin.Context){
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == ""{
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength{
+			abortWithError(c, http.StatusBadRequest, "Idempotency-Key must be at most 255 characters")
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil{
+			abortWithError(c, http.StatusBadRequest, "Failed to read the request body")
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		fingerprint := requestFingerprint(c.Request, body)
+		now := time.Now()
+		record, reserved, err := store.ReserveIdempotencyKey(c.Request.Context(), model.IdempotencyRecord{
+			UserID: c.GetInt64(contextUserID),
+			Key: key,
+			Fingerprint: fingerprint,
+			ExpiresAt: now.Add(ttl),
+			LockedUntil: now.Add(lockTimeout),
+		})
+		if err != nil{
+			ErrorHandler(c, err)
+			c.Abort()
+			return
+		}
+
+		if !reserved{
+			replayIdempotentResponse(c, record, fingerprint)
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+
+		// The outcome is stored even if the client went away, since the request was applied
+		ctx := context.WithoutCancel(c.Request.Context())
+		release := func(){
+			if err := store.ReleaseIdempotencyKey(ctx, record); err != nil{
+				logging.FromContext(ctx).Error("failed to release idempotency key", "error", err)
+			}
+		}
+		defer func(){
+			if recovered := recover(); recovered != nil{
+				release()
+				panic(recovered)
+			}
+		}()
+
+		c.Next()
+
+		status := c.Writer.Status()
+		if status >= http.StatusInternalServerError || status == StatusClientClosedRequest{
+			release()
+			return
+		}
+		record.StatusCode = status
+		record.ContentType = c.Writer.Header().Get("Content-Type")
+		record.Body = recorder.body.Bytes()
+		if err := store.CompleteIdempotencyKey(ctx, record); err != nil{
+			logging.FromContext(ctx).Error("failed to store idempotent response", "error", err)
+			// Without the stored response a retry would be stuck until the key expires
+			release()
+		}
+	}
+}
+
+// replayIdempotentResponse answers a request whose key was already reserved
+func replayIdempotentResponse(c *gin.Context, record model.IdempotencyRecord, fingerprint string){
+	if record.Fingerprint != fingerprint{
+		abortWithError(c, http.StatusUnprocessableEntity, "Idempotency-Key was already used for a different request")
+		return
+	}
+	if !record.Completed(){
+		c.Header("Retry-After", "1")
+		abortWithError(c, http.StatusConflict, "A request with this Idempotency-Key is still being processed")
+		return
+	}
+	c.Header(IdempotentReplayedHeader, "true")
+	c.Data(record.StatusCode, record.ContentType, record.Body)
+	c.Abort()
+}
+
+// requestFingerprint identifies a request by its method, path and body
+func requestFingerprint(req *http.Request, body []byte) string{
+	hash := sha256.New()
+	io.WriteString(hash, req.Method+" "+req.URL.Path+"\n")
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// abortWithError ends the request with an AppError
+func abortWithError(c *gin.Context, code int, message string){
+	c.AbortWithStatusJSON(code, model.AppError{
+		Code: code,
+		Message: message,
+	})
+}
+
+// responseRecorder keeps a copy of the response body while it is written
+type responseRecorder struct {
+	gin.ResponseWriter
+	body	bytes.Buffer
+}
+
+func (w *responseRecorder) Write(data []byte) (int, error){
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error){
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
@@ -0,0 +1,229 @@
+package handler
+
+import (
+	"bookstore-api/model"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// memoryIdempotency is an idempotencyStore backed by a map
+type memoryIdempotency struct {
+	mu		sync.Mutex
+	records	map[string]model.IdempotencyRecord
+}
+
+func newMemoryIdempotency() *memoryIdempotency{
+	return &memoryIdempotency{records: map[string]model.IdempotencyRecord{}}
+}
+
+func (m *memoryIdempotency) ReserveIdempotencyKey(ctx context.Context, record model.IdempotencyRecord) (model.IdempotencyRecord, bool, error){
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	if existing, ok := m.records[record.Key]; ok && existing.ExpiresAt.After(now) && (existing.Completed() || existing.LockedUntil.After(now)){
+		return existing, false, nil
+	}
+	m.records[record.Key] = record
+	return record, true, nil
+}
+
+func (m *memoryIdempotency) CompleteIdempotencyKey(ctx context.Context, record model.IdempotencyRecord) error{
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if existing := m.records[record.Key]; existing.LockedUntil.Equal(record.LockedUntil) && !existing.Completed(){
+		m.records[record.Key] = record
+	}
+	return nil
+}
+
+func (m *memoryIdempotency) ReleaseIdempotencyKey(ctx context.Context, record model.IdempotencyRecord) error{
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if existing := m.records[record.Key]; existing.LockedUntil.Equal(record.LockedUntil) && !existing.Completed(){
+		delete(m.records, record.Key)
+	}
+	return nil
+}
+
+func postBook(server http.Handler, key string, body string) *httptest.ResponseRecorder{
+	req := httptest.NewRequest(http.MethodPost, "/v1/books", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if key != ""{
+		req.Header.Set(IdempotencyKeyHeader, key)
+	}
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	return w
+}
+
+func setupIdempotentBooks(t *testing.T, store idempotencyStore) (http.Handler, *memoryBooks){
+	gin.SetMode(gin.TestMode)
+	repo := newMemoryBooks()
+	books := NewBookHandler(repo)
+	router := gin.New()
+	router.POST("/v1/books", func(c *gin.Context){ c.Set(contextUserID, int64(1)) }, Idempotency(store, time.Hour, time.Minute), books.CreateBookHandler)
+	return validateContract(t, router), repo
+}
+
+func TestIdempotencyReplaysRetries(t *testing.T){
+	server, repo := setupIdempotentBooks(t, newMemoryIdempotency())
+	body := `{"title": "Dune", "author": "Frank Herbert"}`
+
+	first := postBook(server, "3f1c9e", body)
+	retry := postBook(server, "3f1c9e", body)
+
+	if first.Code != http.StatusCreated || retry.Code != http.StatusCreated{
+		t.Fatalf("Expected both responses to be 201 but got %d and %d", first.Code, retry.Code)
+	}
+	if retry.Body.String() != first.Body.String(){
+		t.Errorf("Expected the retry to replay %s but got %s", first.Body.String(), retry.Body.String())
+	}
+	if retry.Header().Get(IdempotentReplayedHeader) != "true" || first.Header().Get(IdempotentReplayedHeader) != ""{
+		t.Errorf("Expected only the retry to be marked as replayed")
+	}
+	if books, _ := repo.GetBooks(context.Background()); len(books) != 1{
+		t.Errorf("Expected 1 book but got %d", len(books))
+	}
+
+	// Without a key every request is applied
+	postBook(server, "", body)
+	postBook(server, "", body)
+	if books, _ := repo.GetBooks(context.Background()); len(books) != 3{
+		t.Errorf("Expected 3 books but got %d", len(books))
+	}
+}
+
+func TestIdempotencyRejectsKeyReuseWithDifferentBody(t *testing.T){
+	server, _ := setupIdempotentBooks(t, newMemoryIdempotency())
+
+	postBook(server, "3f1c9e", `{"title": "Dune", "author": "Frank Herbert"}`)
+	w := postBook(server, "3f1c9e", `{"title": "Emma", "author": "Jane Austen"}`)
+
+	if w.Code != http.StatusUnprocessableEntity{
+		t.Errorf("Expected status code 422 but got %d", w.Code)
+	}
+}
+
+func TestIdempotencyRejectsRetryWhileInFlight(t *testing.T){
+	store := newMemoryIdempotency()
+	server, _ := setupIdempotentBooks(t, store)
+	body := `{"title": "Dune", "author": "Frank Herbert"}`
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/books", strings.NewReader(body))
+	store.ReserveIdempotencyKey(context.Background(), model.IdempotencyRecord{
+		UserID: 1,
+		Key: "3f1c9e",
+		Fingerprint: requestFingerprint(req, []byte(body)),
+		ExpiresAt: time.Now().Add(time.Hour),
+		LockedUntil: time.Now().Add(time.Minute),
+	})
+
+	w := postBook(server, "3f1c9e", body)
+	if w.Code != http.StatusConflict{
+		t.Errorf("Expected status code 409 but got %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") == ""{
+		t.Errorf("Expected a Retry-After header")
+	}
+}
+
+func TestIdempotencyTakesOverAbandonedKey(t *testing.T){
+	store := newMemoryIdempotency()
+	server, repo := setupIdempotentBooks(t, store)
+	body := `{"title": "Dune", "author": "Frank Herbert"}`
+
+	// The first request crashed without completing or releasing its key
+	req := httptest.NewRequest(http.MethodPost, "/v1/books", strings.NewReader(body))
+	abandoned, _, _ := store.ReserveIdempotencyKey(context.Background(), model.IdempotencyRecord{
+		UserID: 1,
+		Key: "3f1c9e",
+		Fingerprint: requestFingerprint(req, []byte(body)),
+		ExpiresAt: time.Now().Add(time.Hour),
+		LockedUntil: time.Now().Add(-time.Second),
+	})
+
+	w := postBook(server, "3f1c9e", body)
+	if w.Code != http.StatusCreated{
+		t.Fatalf("Expected the retry to be applied with 201 but got %d", w.Code)
+	}
+
+	// A late answer of the abandoned request must not replace the retry's
+	abandoned.StatusCode = http.StatusInternalServerError
+	store.CompleteIdempotencyKey(context.Background(), abandoned)
+	store.ReleaseIdempotencyKey(context.Background(), abandoned)
+
+	if retry := postBook(server, "3f1c9e", body); retry.Code != http.StatusCreated || retry.Header().Get(IdempotentReplayedHeader) != "true"{
+		t.Errorf("Expected the retry's response to be replayed but got %d", retry.Code)
+	}
+	if books, _ := repo.GetBooks(context.Background()); len(books) != 1{
+		t.Errorf("Expected 1 book but got %d", len(books))
+	}
+}
+
+func TestIdempotencyAppliesConcurrentDuplicatesOnce(t *testing.T){
+	gin.SetMode(gin.TestMode)
+	var applied atomic.Int32
+	router := gin.New()
+	router.POST("/orders", Idempotency(newMemoryIdempotency(), time.Hour, time.Minute), func(c *gin.Context){
+		applied.Add(1)
+		time.Sleep(20 * time.Millisecond)
+		c.JSON(http.StatusCreated, gin.H{"id": 1})
+	})
+
+	var wg sync.WaitGroup
+	for range 10{
+		wg.Add(1)
+		go func(){
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{}`))
+			req.Header.Set(IdempotencyKeyHeader, "3f1c9e")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != http.StatusCreated && w.Code != http.StatusConflict{
+				t.Errorf("Expected status code 201 or 409 but got %d", w.Code)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := applied.Load(); got != 1{
+		t.Errorf("Expected the request to be applied once but it was applied %d times", got)
+	}
+}
+
+func TestIdempotencyReleasesKeyAfterServerError(t *testing.T){
+	gin.SetMode(gin.TestMode)
+	fail := true
+	router := gin.New()
+	router.POST("/orders", Idempotency(newMemoryIdempotency(), time.Hour, time.Minute), func(c *gin.Context){
+		if fail{
+			c.JSON(http.StatusInternalServerError, model.AppError{Code: http.StatusInternalServerError, Message: "Internal Server Error"})
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"id": 1})
+	})
+
+	send := func() int{
+		req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{}`))
+		req.Header.Set(IdempotencyKeyHeader, "3f1c9e")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := send(); code != http.StatusInternalServerError{
+		t.Fatalf("Expected status code 500 but got %d", code)
+	}
+	fail = false
+	if code := send(); code != http.StatusCreated{
+		t.Errorf("Expected the retry to be applied with 201 but got %d", code)
+	}
+}
@@ -0,0 +1,23 @@
+package handler
+
+import (
+	"bookstore-api/auth"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type JWKSHandler struct {
+	tokens *auth.TokenManager
+}
+
+func NewJWKSHandler(tokens *auth.TokenManager) *JWKSHandler{
+	return &JWKSHandler{tokens: tokens}
+}
+
+// GetJWKSHandler publishes the public signing keys so other services can verify bookstore tokens
+func (h *JWKSHandler) GetJWKSHandler(c *gin.Context){
+	// Downstream verifiers may cache the set, but not past a typical rotation overlap
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.tokens.JWKS())
+}
@@ -0,0 +1,26 @@
+package handler
+
+import (
+	"bookstore-api/metrics"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MetricsMiddleware counts requests and observes their latency labelled by the
+// route template rather than the raw path, so /books/1 and /books/2 share a series
+func MetricsMiddleware() gin.HandlerFunc{
+	return func(c *gin.Context){
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == ""{
+			route = "unmatched"
+		}
+		status := strconv.Itoa(c.Writer.Status())
+		metrics.HTTPRequests.WithLabelValues(c.Request.Method, route, status).Inc()
+		metrics.HTTPRequestDuration.WithLabelValues(c.Request.Method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"bookstore-api/metrics"
+	"bookstore-api/model"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetricsMiddlewareUsesRouteTemplate(t *testing.T){
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(MetricsMiddleware())
+	books := newMemoryBooks()
+	books.CreateBook(context.Background(), model.Book{Title: "Dune", Author: "Frank Herbert"})
+	books.CreateBook(context.Background(), model.Book{Title: "Dune Messiah", Author: "Frank Herbert"})
+	router.GET("/v1/books/:id", NewBookHandler(books).GetBookByIDHandler)
+	router.GET("/metrics", gin.WrapH(metrics.Handler()))
+	server := validateContract(t, router)
+
+	counter := metrics.HTTPRequests.WithLabelValues(http.MethodGet, "/v1/books/:id", "200")
+	before := testutil.ToFloat64(counter)
+	for _, path := range []string{"/v1/books/1", "/v1/books/2"}{
+		server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	// An undocumented path on purpose, so it skips the contract check
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/missing", nil))
+
+	if got := testutil.ToFloat64(counter) - before; got != 2{
+		t.Errorf("Expected 2 requests on /v1/books/:id but got %v", got)
+	}
+	if testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues(http.MethodGet, "unmatched", "404")) < 1{
+		t.Error("Expected unknown paths to be counted as unmatched")
+	}
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := w.Body.String()
+	for _, name := range []string{
+		`bookstore_http_requests_total{method="GET",route="/v1/books/:id",status="200"}`,
+		`bookstore_http_request_duration_seconds_bucket{method="GET",route="/v1/books/:id",status="200"`,
+		`bookstore_logins_total{result="failed"}`,
+	}{
+		if !strings.Contains(body, name){
+			t.Errorf("Expected /metrics to contain %s", name)
+		}
+	}
+	if strings.Contains(body, "/v1/books/1"){
+		t.Error("Expected raw paths to stay out of the labels")
+	}
+}
@@ -0,0 +1,210 @@
+package handler
+
+import (
+	"bookstore-api/auth"
+	"bookstore-api/metrics"
+	"bookstore-api/model"
+	"bookstore-api/repository"
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// totpIssuer is the account label shown in authenticator apps
+const totpIssuer = "Bookstore"
+
+// maxMFAAttempts is how many codes may be tried with one challenge before the
+// user has to log in with their password again
+const maxMFAAttempts = 5
+
+// EnrollTOTPHandler starts TOTP enrollment by generating a new secret for the current user
+func (h *UserHandler) EnrollTOTPHandler(c *gin.Context){
+	user, err := h.repo.GetUserByID(c.Request.Context(), c.GetInt64(contextUserID))
+	if err != nil{
+		ErrorHandler(c, err)
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil{
+		ErrorHandler(c, err)
+		return
+	}
+
+	err = h.repo.SetPendingTOTPSecret(c.Request.Context(), user.ID, secret)
+	if err != nil{
+		if err == repository.ErrTOTPAlreadyEnabled{
+			c.JSON(http.StatusConflict, model.AppError{
+				Code: http.StatusConflict,
+				Message: err.Error(),
+			})
+			return
+		}
+		ErrorHandler(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret": secret,
+		"otpauth_uri": auth.TOTPURI(totpIssuer, user.Email, secret),
+	})
+}
+
+// ConfirmTOTPHandler activates TOTP once the user proves their app produces valid codes.
+// The recovery codes are only returned in this response.
+func (h *UserHandler) ConfirmTOTPHandler(c *gin.Context){
+	var input struct{
+		Code	string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil{
+		c.JSON(http.StatusBadRequest, model.AppError{
+			Code: http.StatusBadRequest,
+			Message: "Invalid input: " + err.Error(),
+		})
+		return
+	}
+
+	user, err := h.repo.GetUserByID(c.Request.Context(), c.GetInt64(contextUserID))
+	if err != nil{
+		ErrorHandler(c, err)
+		return
+	}
+
+	if user.TOTPEnabled || user.TOTPSecret == ""{
+		c.JSON(http.StatusConflict, model.AppError{
+			Code: http.StatusConflict,
+			Message: repository.ErrTOTPNotEnrolled.Error(),
+		})
+		return
+	}
+
+	step, ok := auth.ValidateTOTP(user.TOTPSecret, input.Code, time.Now())
+	if !ok{
+		c.JSON(http.StatusUnauthorized, model.AppError{
+			Code: http.StatusUnauthorized,
+			Message: "Invalid verification code",
+		})
+		return
+	}
+
+	codes, err := auth.GenerateRecoveryCodes()
+	if err != nil{
+		ErrorHandler(c, err)
+		return
+	}
+
+	hashes := make([]string, 0, len(codes))
+	for _, code := range codes{
+		hashes = append(hashes, auth.HashRecoveryCode(code))
+	}
+
+	err = h.repo.EnableTOTP(c.Request.Context(), user.ID, step, hashes)
+	if err != nil{
+		if err == repository.ErrTOTPNotEnrolled{
+			c.JSON(http.StatusConflict, model.AppError{
+				Code: http.StatusConflict,
+				Message: err.Error(),
+			})
+			return
+		}
+		ErrorHandler(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Two-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+// VerifyMFAHandler exchanges an MFA challenge token and a TOTP or recovery code for an access token.
+// A challenge is good for one successful code and at most maxMFAAttempts tries.
+func (h *UserHandler) VerifyMFAHandler(c *gin.Context){
+	var input struct{
+		ChallengeToken	string `json:"challenge_token" binding:"required"`
+		Code			string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil{
+		c.JSON(http.StatusBadRequest, model.AppError{
+			Code: http.StatusBadRequest,
+			Message: "Invalid input: " + err.Error(),
+		})
+		return
+	}
+
+	claims, err := h.tokens.Parse(input.ChallengeToken)
+	if err != nil || claims["purpose"] != purposeMFAChallenge{
+		abortUnauthorized(c, auth.ErrInvalidToken.Error())
+		return
+	}
+
+	userID, ok := userIDFromClaims(claims)
+	challengeID, _ := claims["jti"].(string)
+	expiresAt, _ := claims["exp"].(float64)
+	if !ok || challengeID == ""{
+		abortUnauthorized(c, auth.ErrInvalidToken.Error())
+		return
+	}
+
+	user, err := h.repo.GetUserByID(c.Request.Context(), userID)
+	if err != nil || !user.TOTPEnabled || user.Disabled{
+		abortUnauthorized(c, auth.ErrInvalidToken.Error())
+		return
+	}
+
+	// The attempt is counted before the code is checked, so concurrent
+	// guesses cannot slip past the limit
+	attempts, err := h.repo.RecordMFAAttempt(c.Request.Context(), challengeID, user.ID, time.Unix(int64(expiresAt), 0))
+	if err == repository.ErrMFAChallengeUsed || (err == nil && attempts > maxMFAAttempts){
+		abortUnauthorized(c, "Challenge is no longer valid, log in again")
+		return
+	}
+	if err != nil{
+		ErrorHandler(c, err)
+		return
+	}
+
+	verified, err := h.verifySecondFactor(c.Request.Context(), user, input.Code)
+	if err != nil{
+		ErrorHandler(c, err)
+		return
+	}
+	if !verified{
+		metrics.LoginFailed()
+		abortUnauthorized(c, "Invalid verification code")
+		return
+	}
+
+	consumed, err := h.repo.ConsumeMFAChallenge(c.Request.Context(), challengeID)
+	if err != nil{
+		ErrorHandler(c, err)
+		return
+	}
+	if !consumed{
+		abortUnauthorized(c, "Challenge is no longer valid, log in again")
+		return
+	}
+
+	tokenString, err := issueAccessToken(h.tokens, user, h.auth.AccessTokenTTL.Duration)
+	if err != nil{
+		ErrorHandler(c, err)
+		return
+	}
+	metrics.LoginSucceeded()
+
+	c.JSON(http.StatusOK, gin.H{
+		"token": tokenString,
+	})
+}
+
+// verifySecondFactor accepts either a current TOTP code or an unused recovery code
+func (h *UserHandler) verifySecondFactor(ctx context.Context, user model.User, code string) (bool, error){
+	if step, ok := auth.ValidateTOTP(user.TOTPSecret, code, time.Now()); ok{
+		return h.repo.ConsumeTOTPStep(ctx, user.ID, step)
+	}
+	return h.repo.ConsumeRecoveryCode(ctx, user.ID, auth.HashRecoveryCode(code))
+}
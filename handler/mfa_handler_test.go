@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"bookstore-api/auth"
+	"bookstore-api/config"
+	"bookstore-api/model"
+	"bookstore-api/password"
+	"bookstore-api/repository"
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// mfaChallenge is the attempt count of a login challenge
+type mfaChallenge struct {
+	attempts	int
+	used		bool
+}
+
+func (m *memoryUsers) ConsumeTOTPStep(ctx context.Context, userID int64, step int64) (bool, error){
+	if m.totpSteps[userID] >= step{
+		return false, nil
+	}
+	m.totpSteps[userID] = step
+	return true, nil
+}
+
+func (m *memoryUsers) ConsumeRecoveryCode(ctx context.Context, userID int64, codeHash string) (bool, error){
+	if m.recoveryCodes[codeHash] != userID{
+		return false, nil
+	}
+	delete(m.recoveryCodes, codeHash)
+	return true, nil
+}
+
+func (m *memoryUsers) RecordMFAAttempt(ctx context.Context, challengeID string, userID int64, expiresAt time.Time) (int, error){
+	challenge, ok := m.challenges[challengeID]
+	if !ok{
+		challenge = &mfaChallenge{}
+		m.challenges[challengeID] = challenge
+	}
+	challenge.attempts++
+	if challenge.used{
+		return challenge.attempts, repository.ErrMFAChallengeUsed
+	}
+	return challenge.attempts, nil
+}
+
+func (m *memoryUsers) ConsumeMFAChallenge(ctx context.Context, challengeID string) (bool, error){
+	challenge, ok := m.challenges[challengeID]
+	if !ok || challenge.used{
+		return false, nil
+	}
+	challenge.used = true
+	return true, nil
+}
+
+func TestVerifyMFALimitsChallenge(t *testing.T){
+	gin.SetMode(gin.TestMode)
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil{
+		t.Fatalf("GenerateTOTPSecret() failed: %v", err)
+	}
+	user := model.User{ID: 42, Email: "reader@example.com", Role: model.RoleUser, TOTPEnabled: true, TOTPSecret: secret}
+	users := newMemoryUsers(user)
+	users.recoveryCodes[auth.HashRecoveryCode("recovery-1")] = user.ID
+	users.recoveryCodes[auth.HashRecoveryCode("recovery-2")] = user.ID
+
+	tokens := newTestTokens(t)
+	handler := NewUserHandler(users, tokens, &memoryMailer{}, password.NewPolicy(8, 128), config.Default().Auth)
+	router := gin.New()
+	router.POST("/v1/login/mfa", handler.VerifyMFAHandler)
+	server := validateContract(t, router)
+
+	verify := func(challenge, code string) int{
+		return serveJSON(server, http.MethodPost, "/v1/login/mfa", "", `{"challenge_token": "` + challenge + `", "code": "` + code + `"}`).Code
+	}
+	newChallenge := func() string{
+		challenge, err := issueMFAChallenge(tokens, user, time.Minute)
+		if err != nil{
+			t.Fatalf("issueMFAChallenge() failed: %v", err)
+		}
+		return challenge
+	}
+
+	// Wrong codes use up the challenge, after which even a right one is refused
+	challenge := newChallenge()
+	for i := 0; i < maxMFAAttempts; i++{
+		if code := verify(challenge, "000000"); code != http.StatusUnauthorized{
+			t.Fatalf("Expected a wrong code to get %d but got %d", http.StatusUnauthorized, code)
+		}
+	}
+	if code := verify(challenge, "recovery-1"); code != http.StatusUnauthorized{
+		t.Errorf("Expected a challenge with %d failed attempts to get %d but got %d", maxMFAAttempts, http.StatusUnauthorized, code)
+	}
+
+	// A fresh challenge starts over, and is good for one login
+	challenge = newChallenge()
+	if code := verify(challenge, "recovery-1"); code != http.StatusOK{
+		t.Fatalf("Expected a recovery code to get %d but got %d", http.StatusOK, code)
+	}
+	if code := verify(challenge, "recovery-2"); code != http.StatusUnauthorized{
+		t.Errorf("Expected a used challenge to get %d but got %d", http.StatusUnauthorized, code)
+	}
+}
@@ -0,0 +1,192 @@
+package handler
+
+import (
+	"bookstore-api/auth"
+	"bookstore-api/config"
+	"bookstore-api/logging"
+	"bookstore-api/model"
+	"bookstore-api/oidc"
+	"bookstore-api/repository"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var errUnverifiedEmail = errors.New("identity provider did not verify the email address")
+
+const (
+	oidcFlowCookie = "oidc_flow"
+	purposeOIDCFlow = "oidc_flow"
+)
+
+// identityStore is the part of the user repository the single sign-on handlers need
+type identityStore interface{
+	GetUserByIdentity(ctx context.Context, issuer, subject string) (model.User, error)
+	GetUserByEmail(ctx context.Context, email string) (model.User, error)
+	LinkIdentity(ctx context.Context, userID int64, issuer, subject string) error
+	CreateUserWithIdentity(ctx context.Context, name, email, issuer, subject string) (model.User, error)
+}
+
+type OIDCHandler struct {
+	client *oidc.Client
+	users identityStore
+	tokens *auth.TokenManager
+	auth config.Auth
+}
+
+func NewOIDCHandler(client *oidc.Client, users identityStore, tokens *auth.TokenManager, authConfig config.Auth) *OIDCHandler{
+	return &OIDCHandler{client: client, users: users, tokens: tokens, auth: authConfig}
+}
+
+// LoginHandler starts the authorization code flow. State, nonce and the PKCE
+// verifier are kept in a signed, short-lived cookie so no server-side session is needed.
+func (h *OIDCHandler) LoginHandler(c *gin.Context){
+	state, err := oidc.NewState()
+	if err != nil{
+		ErrorHandler(c, err)
+		return
+	}
+	nonce, err := oidc.NewState()
+	if err != nil{
+		ErrorHandler(c, err)
+		return
+	}
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil{
+		ErrorHandler(c, err)
+		return
+	}
+
+	authURL, err := h.client.AuthCodeURL(c.Request.Context(), state, nonce, challenge)
+	if err != nil{
+		logging.FromContext(c.Request.Context()).Error("oidc discovery failed", "error", err)
+		c.JSON(http.StatusBadGateway, model.AppError{
+			Code: http.StatusBadGateway,
+			Message: "Identity provider is unavailable",
+		})
+		return
+	}
+
+	// The flow TTL bounds how long the user may spend at the identity provider
+	flowTTL := h.auth.OIDCFlowTTL.Duration
+	flow, err := h.tokens.Sign(jwt.MapClaims{
+		"purpose": purposeOIDCFlow,
+		"state": state,
+		"nonce": nonce,
+		"verifier": verifier,
+		"exp": time.Now().Add(flowTTL).Unix(),
+	})
+	if err != nil{
+		ErrorHandler(c, err)
+		return
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcFlowCookie, flow, int(flowTTL.Seconds()), h.flowCookiePath(), "", c.Request.TLS != nil, true)
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// flowCookiePath scopes the flow cookie to the directory of the configured
+// callback, e.g. /v1/auth/oidc, whichever path the login was started from
+func (h *OIDCHandler) flowCookiePath() string{
+	return path.Dir(h.client.CallbackPath())
+}
+
+// CallbackHandler completes the flow, links or provisions the user and issues the bookstore token
+func (h *OIDCHandler) CallbackHandler(c *gin.Context){
+	if providerError := c.Query("error"); providerError != ""{
+		c.JSON(http.StatusUnauthorized, model.AppError{
+			Code: http.StatusUnauthorized,
+			Message: "Identity provider returned an error: " + providerError,
+		})
+		return
+	}
+
+	flowCookie, err := c.Cookie(oidcFlowCookie)
+	if err != nil{
+		abortOIDCFlow(c, "Login session not found or expired")
+		return
+	}
+	// The flow cookie is single use
+	c.SetCookie(oidcFlowCookie, "", -1, h.flowCookiePath(), "", c.Request.TLS != nil, true)
+
+	flow, err := h.tokens.Parse(flowCookie)
+	if err != nil || flow["purpose"] != purposeOIDCFlow{
+		abortOIDCFlow(c, "Login session not found or expired")
+		return
+	}
+
+	state, _ := flow["state"].(string)
+	if subtle.ConstantTimeCompare([]byte(state), []byte(c.Query("state"))) != 1{
+		abortOIDCFlow(c, "State does not match")
+		return
+	}
+
+	nonce, _ := flow["nonce"].(string)
+	verifier, _ := flow["verifier"].(string)
+	claims, err := h.client.Exchange(c.Request.Context(), c.Query("code"), verifier, nonce)
+	if err != nil{
+		logging.FromContext(c.Request.Context()).Warn("oidc code exchange failed", "error", err)
+		abortUnauthorized(c, "Login with the identity provider failed")
+		return
+	}
+
+	user, err := h.resolveUser(c.Request.Context(), claims)
+	if err != nil{
+		if err == errUnverifiedEmail{
+			c.JSON(http.StatusForbidden, model.AppError{
+				Code: http.StatusForbidden,
+				Message: err.Error(),
+			})
+			return
+		}
+		ErrorHandler(c, err)
+		return
+	}
+
+	completeLogin(c, h.tokens, h.auth, user)
+}
+
+// resolveUser returns the user linked to the identity. An unlinked identity is
+// linked to the account with the same email, or a new account is provisioned,
+// but only when the provider vouches for the email address.
+func (h *OIDCHandler) resolveUser(ctx context.Context, claims oidc.Claims) (model.User, error){
+	user, err := h.users.GetUserByIdentity(ctx, claims.Issuer, claims.Subject)
+	if err != repository.ErrUserNotFound{
+		return user, err
+	}
+
+	if claims.Email == "" || !claims.EmailVerified{
+		return model.User{}, errUnverifiedEmail
+	}
+
+	user, err = h.users.GetUserByEmail(ctx, claims.Email)
+	if err == nil{
+		if err := h.users.LinkIdentity(ctx, user.ID, claims.Issuer, claims.Subject); err != nil{
+			return model.User{}, err
+		}
+		return user, nil
+	}
+	if err != repository.ErrUserNotFound{
+		return model.User{}, err
+	}
+
+	name := claims.Name
+	if name == ""{
+		name = claims.Email
+	}
+	return h.users.CreateUserWithIdentity(ctx, name, claims.Email, claims.Issuer, claims.Subject)
+}
+
+func abortOIDCFlow(c *gin.Context, message string){
+	c.JSON(http.StatusBadRequest, model.AppError{
+		Code: http.StatusBadRequest,
+		Message: message,
+	})
+}
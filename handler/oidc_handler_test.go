@@ -0,0 +1,192 @@
+package handler
+
+import (
+	"bookstore-api/config"
+	"bookstore-api/model"
+	"bookstore-api/oidc"
+	"bookstore-api/oidc/oidctest"
+	"bookstore-api/repository"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (m *memoryUsers) GetUserByEmail(ctx context.Context, email string) (model.User, error){
+	for _, user := range m.users{
+		if user.Email == email{
+			return user, nil
+		}
+	}
+	return model.User{}, repository.ErrUserNotFound
+}
+
+func (m *memoryUsers) GetUserByIdentity(ctx context.Context, issuer, subject string) (model.User, error){
+	id, ok := m.identities[issuer + " " + subject]
+	if !ok{
+		return model.User{}, repository.ErrUserNotFound
+	}
+	return m.GetUserByID(ctx, id)
+}
+
+func (m *memoryUsers) LinkIdentity(ctx context.Context, userID int64, issuer, subject string) error{
+	m.identities[issuer + " " + subject] = userID
+	return nil
+}
+
+func (m *memoryUsers) CreateUserWithIdentity(ctx context.Context, name, email, issuer, subject string) (model.User, error){
+	id := int64(len(m.users) + 1)
+	user := model.User{ID: id, Name: name, Email: email, EmailVerified: true, Role: model.RoleUser}
+	m.users[id] = user
+	m.identities[issuer + " " + subject] = id
+	return user, nil
+}
+
+type oidcTestServer struct {
+	http.Handler
+	provider	*oidctest.Provider
+	users		*memoryUsers
+}
+
+func setupOIDCRouter(t *testing.T, users *memoryUsers) *oidcTestServer{
+	gin.SetMode(gin.TestMode)
+	provider := oidctest.NewProvider("bookstore", "secret")
+	t.Cleanup(provider.Close)
+
+	client := oidc.NewClient(oidc.Config{
+		IssuerURL: provider.Issuer(),
+		ClientID: "bookstore",
+		ClientSecret: "secret",
+		RedirectURL: "http://bookstore.test/v1/auth/oidc/callback",
+	}, provider.Server.Client())
+	handler := NewOIDCHandler(client, users, newTestTokens(t), config.Default().Auth)
+
+	router := gin.New()
+	router.GET("/v1/auth/oidc/login", handler.LoginHandler)
+	router.GET("/v1/auth/oidc/callback", handler.CallbackHandler)
+	return &oidcTestServer{Handler: validateContract(t, router), provider: provider, users: users}
+}
+
+// authorize starts a login and follows the redirect through the provider. It
+// returns the callback request the browser would send, flow cookie included.
+func (s *oidcTestServer) authorize(t *testing.T) *http.Request{
+	t.Helper()
+	login := httptest.NewRecorder()
+	s.ServeHTTP(login, httptest.NewRequest(http.MethodGet, "/v1/auth/oidc/login", nil))
+	if login.Code != http.StatusFound{
+		t.Fatalf("Expected a redirect to the provider but got %d: %s", login.Code, login.Body.String())
+	}
+
+	browser := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error{
+		return http.ErrUseLastResponse
+	}}
+	response, err := browser.Get(login.Header().Get("Location"))
+	if err != nil{
+		t.Fatalf("Authorization request failed: %v", err)
+	}
+	response.Body.Close()
+	callback, err := url.Parse(response.Header.Get("Location"))
+	if err != nil || response.StatusCode != http.StatusFound{
+		t.Fatalf("Expected a redirect back from the provider but got %d", response.StatusCode)
+	}
+
+	request := httptest.NewRequest(http.MethodGet, callback.RequestURI(), nil)
+	for _, cookie := range login.Result().Cookies(){
+		request.AddCookie(cookie)
+	}
+	return request
+}
+
+func (s *oidcTestServer) serve(request *http.Request) *httptest.ResponseRecorder{
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestOIDCCallbackChecksFlow(t *testing.T){
+	server := setupOIDCRouter(t, newMemoryUsers())
+
+	// A state from another login
+	request := server.authorize(t)
+	query := request.URL.Query()
+	query.Set("state", "forged")
+	request.URL.RawQuery = query.Encode()
+	if recorder := server.serve(request); recorder.Code != http.StatusBadRequest{
+		t.Errorf("Expected a mismatched state to get %d but got %d", http.StatusBadRequest, recorder.Code)
+	}
+
+	// A callback without the flow cookie, e.g. started in another browser
+	request = server.authorize(t)
+	if recorder := server.serve(httptest.NewRequest(http.MethodGet, request.URL.RequestURI(), nil)); recorder.Code != http.StatusBadRequest{
+		t.Errorf("Expected a missing flow cookie to get %d but got %d", http.StatusBadRequest, recorder.Code)
+	}
+
+	// A flow cookie from another login
+	other := server.authorize(t)
+	request = server.authorize(t)
+	request.Header.Del("Cookie")
+	for _, cookie := range other.Cookies(){
+		request.AddCookie(cookie)
+	}
+	if recorder := server.serve(request); recorder.Code != http.StatusBadRequest{
+		t.Errorf("Expected a flow cookie of another login to get %d but got %d", http.StatusBadRequest, recorder.Code)
+	}
+}
+
+func TestOIDCCallbackRejectsUnverifiedEmail(t *testing.T){
+	existing := model.User{ID: 1, Name: "Staff", Email: "staff@example.com", Role: model.RoleAdmin}
+	users := newMemoryUsers(existing)
+	server := setupOIDCRouter(t, users)
+	server.provider.SetUser(oidctest.User{Subject: "unverified", Email: existing.Email, EmailVerified: false})
+
+	if recorder := server.serve(server.authorize(t)); recorder.Code != http.StatusForbidden{
+		t.Errorf("Expected an unverified email to get %d but got %d: %s", http.StatusForbidden, recorder.Code, recorder.Body.String())
+	}
+	if len(users.identities) != 0 || len(users.users) != 1{
+		t.Errorf("Expected no account to be linked or created, got identities %v", users.identities)
+	}
+}
+
+func TestOIDCCallbackLinksExistingUser(t *testing.T){
+	existing := model.User{ID: 1, Name: "Staff", Email: "staff@example.com", Role: model.RoleAdmin}
+	users := newMemoryUsers(existing)
+	server := setupOIDCRouter(t, users)
+	server.provider.SetUser(oidctest.User{Subject: "staff-subject", Email: existing.Email, EmailVerified: true, Name: "Staff"})
+
+	if recorder := server.serve(server.authorize(t)); recorder.Code != http.StatusOK{
+		t.Fatalf("Expected status code %d but got %d: %s", http.StatusOK, recorder.Code, recorder.Body.String())
+	}
+	if id := users.identities[server.provider.Issuer() + " staff-subject"]; id != existing.ID{
+		t.Errorf("Expected the identity to be linked to user %d but got %d", existing.ID, id)
+	}
+	if len(users.users) != 1{
+		t.Errorf("Expected no new account but got %d users", len(users.users))
+	}
+
+	// Once linked the identity is found even after the email changes at the provider
+	server.provider.SetUser(oidctest.User{Subject: "staff-subject", Email: "renamed@example.com", EmailVerified: true})
+	if recorder := server.serve(server.authorize(t)); recorder.Code != http.StatusOK || len(users.users) != 1{
+		t.Errorf("Expected the linked account to log in but got %d with %d users", recorder.Code, len(users.users))
+	}
+}
+
+func TestOIDCCallbackCreatesNewUser(t *testing.T){
+	users := newMemoryUsers()
+	server := setupOIDCRouter(t, users)
+	server.provider.SetUser(oidctest.User{Subject: "new-subject", Email: "new@example.com", EmailVerified: true})
+
+	if recorder := server.serve(server.authorize(t)); recorder.Code != http.StatusOK{
+		t.Fatalf("Expected status code %d but got %d: %s", http.StatusOK, recorder.Code, recorder.Body.String())
+	}
+	user, err := users.GetUserByIdentity(context.Background(), server.provider.Issuer(), "new-subject")
+	if err != nil{
+		t.Fatalf("Expected a user linked to the identity: %v", err)
+	}
+	// Without a name from the provider the email stands in
+	if user.Email != "new@example.com" || user.Name != "new@example.com" || user.Role != model.RoleUser{
+		t.Errorf("Unexpected new user %+v", user)
+	}
+}
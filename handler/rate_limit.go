@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"bookstore-api/logging"
+	"bookstore-api/metrics"
+	"bookstore-api/model"
+	"bookstore-api/ratelimit"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimit counts every request against a token bucket of the client and
+// rejects it with 429 once the bucket is empty. Clients are identified by their
+// API key, else by their user and else by their IP address, so the middleware
+// must run after AuthMiddleware on authenticated routes.
+//
+// Responses carry the RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset and
+// RateLimit-Policy headers of the IETF RateLimit header fields draft. If the
+// store fails the request is let through rather than taking the API down.
+func RateLimit(store ratelimit.Store, rules ratelimit.Rules) gin.HandlerFunc{
+	return func(c *gin.Context){
+		route := c.GetString(contextSuccessorRoute)
+		if route == ""{
+			route = c.FullPath()
+		}
+		limit, bucket, ok := rules.For(c.Request.Method + " " + route)
+		if !ok{
+			c.Next()
+			return
+		}
+
+		result, err := store.Take(c.Request.Context(), bucket + "|" + rateLimitClient(c), limit)
+		if err != nil{
+			logging.FromContext(c.Request.Context()).Warn("rate limit store failed, letting the request through", "error", err)
+			c.Next()
+			return
+		}
+
+		c.Header("RateLimit-Limit", strconv.Itoa(result.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.ResetAfter)))
+		c.Header("RateLimit-Policy", strconv.Itoa(limit.Burst) + ";w=" + strconv.Itoa(ceilSeconds(limit.Window())))
+
+		if !result.Allowed{
+			metrics.RateLimited.WithLabelValues(c.Request.Method, route).Inc()
+			c.Header("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+			abortWithError(c, http.StatusTooManyRequests, "Too many requests, retry later")
+			return
+		}
+		c.Next()
+	}
+}
+
+// rateLimitClient names the client a request is counted against
+func rateLimitClient(c *gin.Context) string{
+	if value, ok := c.Get(contextAPIKey); ok{
+		return "key:" + strconv.FormatInt(value.(model.APIKey).ID, 10)
+	}
+	if userID := c.GetInt64(contextUserID); userID != 0{
+		return "user:" + strconv.FormatInt(userID, 10)
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// ceilSeconds rounds up, so a client waiting that long is never rejected again
+func ceilSeconds(d time.Duration) int{
+	return int(math.Ceil(d.Seconds()))
+}
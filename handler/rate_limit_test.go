@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"bookstore-api/model"
+	"bookstore-api/ratelimit"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// setupRateLimitedBooks returns the router checked against the contract and,
+// for the undocumented deprecated aliases, the bare router
+func setupRateLimitedBooks(t *testing.T, store ratelimit.Store) (http.Handler, http.Handler){
+	gin.SetMode(gin.TestMode)
+	rules, err := ratelimit.ParseRules("", []string{"GET /v1/books=2/1m"})
+	if err != nil{
+		t.Fatalf("ParseRules failed: %v", err)
+	}
+	limit := RateLimit(store, rules)
+	// Stands in for AuthMiddleware, which identifies API key clients
+	identify := func(c *gin.Context){
+		if c.GetHeader("X-API-Key") != ""{
+			c.Set(contextAPIKey, model.APIKey{ID: 7})
+		}
+	}
+
+	books := NewBookHandler(newMemoryBooks())
+	router := gin.New()
+	router.GET("/v1/books", identify, limit, books.GetBooksHandler)
+	router.GET("/v1/books/:id", identify, limit, books.GetBookByIDHandler)
+	legacy := router.Group("", Deprecated(time.Now(), time.Now().Add(time.Hour), "/v1"))
+	legacy.GET("/books", identify, limit, books.GetBooksHandler)
+	return validateContract(t, router), router
+}
+
+func getBooks(server http.Handler, path string, apiKey string) *httptest.ResponseRecorder{
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.RemoteAddr = "10.0.0.5:41234"
+	if apiKey != ""{
+		req.Header.Set("X-API-Key", apiKey)
+	}
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	return w
+}
+
+func TestRateLimitRejectsClientsOverTheLimit(t *testing.T){
+	server, router := setupRateLimitedBooks(t, ratelimit.NewMemoryStore())
+
+	first := getBooks(server, "/v1/books", "")
+	if first.Code != http.StatusOK{
+		t.Fatalf("Expected status code 200 but got %d", first.Code)
+	}
+	expected := map[string]string{
+		"RateLimit-Limit": "2",
+		"RateLimit-Remaining": "1",
+		"RateLimit-Reset": "30",
+		"RateLimit-Policy": "2;w=60",
+	}
+	for header, value := range expected{
+		if got := first.Header().Get(header); got != value{
+			t.Errorf("Expected %s %q but got %q", header, value, got)
+		}
+	}
+
+	// The deprecated alias counts against the same bucket
+	getBooks(router, "/books", "")
+	limited := getBooks(server, "/v1/books", "")
+	if limited.Code != http.StatusTooManyRequests{
+		t.Fatalf("Expected status code 429 but got %d", limited.Code)
+	}
+	if got := limited.Header().Get("Retry-After"); got != "30"{
+		t.Errorf("Expected Retry-After 30 but got %q", got)
+	}
+
+	// API keys have their own bucket, even from the same address
+	if w := getBooks(server, "/v1/books", "bk_live_abc"); w.Code != http.StatusOK{
+		t.Errorf("Expected the API key client to be allowed but got %d", w.Code)
+	}
+	// Routes without a rule and without a default are not limited
+	if w := getBooks(server, "/v1/books/1", ""); w.Code != http.StatusNotFound{
+		t.Errorf("Expected an unlimited route but got %d", w.Code)
+	}
+}
+
+// failingStore is a ratelimit.Store whose backend is down
+type failingStore struct{}
+
+func (failingStore) Take(ctx context.Context, key string, limit ratelimit.Limit) (ratelimit.Result, error){
+	return ratelimit.Result{}, errors.New("connection refused")
+}
+
+func TestRateLimitLetsRequestsThroughWhenStoreFails(t *testing.T){
+	server, _ := setupRateLimitedBooks(t, failingStore{})
+
+	for range 3{
+		if w := getBooks(server, "/v1/books", ""); w.Code != http.StatusOK{
+			t.Fatalf("Expected status code 200 but got %d", w.Code)
+		}
+	}
+}
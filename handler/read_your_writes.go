@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"bookstore-api/repository"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ReadYourWrites sends a client's database reads to the primary for window
+// after the client changed something, so it sees its own writes even while the
+// replicas lag behind. Reads from everyone else keep going to the replicas.
+//
+// Clients are recognised by the credentials they send and by their IP address,
+// so a public read without a token still follows the client's write. Writes
+// are remembered per instance: behind several instances, a client only reads
+// its writes reliably when the load balancer keeps it on one instance.
+//
+// Public routes run without authentication, so the middleware must be
+// registered on the engine rather than on the authenticated groups.
+func ReadYourWrites(window time.Duration) gin.HandlerFunc{
+	writers := newRecentWriters(window)
+
+	return func(c *gin.Context){
+		keys := writerKeys(c)
+		if writers.wroteRecently(keys){
+			c.Request = c.Request.WithContext(repository.ReadFromPrimary(c.Request.Context()))
+		}
+
+		c.Next()
+
+		if isWrite(c.Request.Method) && c.Writer.Status() < http.StatusBadRequest{
+			writers.remember(keys)
+		}
+	}
+}
+
+func isWrite(method string) bool{
+	switch method{
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return true
+}
+
+// writerKeys identifies the client by a hash of its credentials, so no token
+// is kept in memory, and by its IP address
+func writerKeys(c *gin.Context) []string{
+	keys := []string{"ip:" + c.ClientIP()}
+	for _, header := range []string{"Authorization", "X-API-Key"}{
+		if credential := c.GetHeader(header); credential != ""{
+			sum := sha256.Sum256([]byte(credential))
+			keys = append(keys, "credential:" + hex.EncodeToString(sum[:16]))
+		}
+	}
+	return keys
+}
+
+// recentWriters remembers until when each client reads from the primary
+type recentWriters struct {
+	mu			sync.Mutex
+	window		time.Duration
+	until		map[string]time.Time
+	lastSweep	time.Time
+	now			func() time.Time
+}
+
+func newRecentWriters(window time.Duration) *recentWriters{
+	return &recentWriters{window: window, until: map[string]time.Time{}, now: time.Now}
+}
+
+func (w *recentWriters) wroteRecently(keys []string) bool{
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	now := w.now()
+	for _, key := range keys{
+		if now.Before(w.until[key]){
+			return true
+		}
+	}
+	return false
+}
+
+func (w *recentWriters) remember(keys []string){
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	now := w.now()
+	// Forget expired clients once per window so memory only grows with the
+	// number of recent writers
+	if now.Sub(w.lastSweep) >= w.window{
+		w.lastSweep = now
+		for key, until := range w.until{
+			if !now.Before(until){
+				delete(w.until, key)
+			}
+		}
+	}
+	for _, key := range keys{
+		w.until[key] = now.Add(w.window)
+	}
+}
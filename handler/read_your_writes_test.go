@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"bookstore-api/model"
+	"bookstore-api/repository"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestReadYourWritesReadsFromPrimaryAfterWriting(t *testing.T){
+	gin.SetMode(gin.TestMode)
+	primary := newMemoryBooks()
+	primary.CreateBook(context.Background(), model.Book{Title: "Dune", Author: "Frank Herbert"})
+	// The replica has not replayed the book yet
+	lagging := &repository.Replica{
+		Name: "replica",
+		Books: newMemoryBooks(),
+		Lag: func(context.Context) (time.Duration, error){ return 0, nil },
+	}
+	books := repository.NewReplicatedBookStore(primary, 0, lagging)
+	books.CheckReplicas(context.Background())
+
+	handler := NewBookHandler(books)
+	router := gin.New()
+	router.Use(ReadYourWrites(time.Minute))
+	router.GET("/v1/books/:id", handler.GetBookByIDHandler)
+	router.PUT("/v1/books/:id", handler.UpdateBookHandler)
+	server := validateContract(t, router)
+
+	send := func(method, body, token, ip string) *httptest.ResponseRecorder{
+		req := httptest.NewRequest(method, "/v1/books/1", strings.NewReader(body))
+		req.RemoteAddr = ip + ":41234"
+		if body != ""{
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if token != ""{
+			req.Header.Set("Authorization", "Bearer " + token)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := send(http.MethodGet, "", "alice", "10.0.0.5"); w.Code != http.StatusNotFound{
+		t.Fatalf("Expected the read to reach the lagging replica but got %d", w.Code)
+	}
+
+	// Stands in for the update being written to the primary
+	if w := send(http.MethodPut, `{"title": "Dune Messiah", "author": "Frank Herbert"}`, "alice", "10.0.0.5"); w.Code != http.StatusOK{
+		t.Fatalf("Expected the update to succeed but got %d", w.Code)
+	}
+
+	// The writer sees its write with the same token, and from the same address without one
+	for _, client := range []struct{ token, ip string }{{"alice", "10.0.0.9"}, {"", "10.0.0.5"}}{
+		if w := send(http.MethodGet, "", client.token, client.ip); w.Code != http.StatusOK{
+			t.Errorf("Expected %+v to read from the primary after writing but got %d", client, w.Code)
+		}
+	}
+	// Everyone else keeps reading from the replica
+	if w := send(http.MethodGet, "", "bob", "10.0.0.7"); w.Code != http.StatusNotFound{
+		t.Errorf("Expected another client to read from the replica but got %d", w.Code)
+	}
+}
+
+func TestRecentWritersExpire(t *testing.T){
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	writers := newRecentWriters(5 * time.Second)
+	writers.now = func() time.Time{ return now }
+
+	writers.remember([]string{"ip:10.0.0.5"})
+	now = now.Add(4 * time.Second)
+	if !writers.wroteRecently([]string{"ip:10.0.0.5"}){
+		t.Error("Expected the client to read from the primary within the window")
+	}
+	now = now.Add(time.Second)
+	if writers.wroteRecently([]string{"ip:10.0.0.5"}){
+		t.Error("Expected the window to end")
+	}
+
+	writers.remember([]string{"ip:10.0.0.6"})
+	if len(writers.until) != 1{
+		t.Errorf("Expected the expired client to be forgotten but got %v", writers.until)
+	}
+}
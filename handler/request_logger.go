@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"bookstore-api/logging"
+	"bookstore-api/model"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"runtime/debug"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// RequestIDHeader carries the request ID from proxies and back to the client
+	RequestIDHeader = "X-Request-ID"
+	contextRequestID = "request_id"
+)
+
+// validRequestID limits accepted request IDs so a client cannot inject arbitrary text into the logs
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestLogger assigns every request an ID, puts a logger carrying it and the
+// trace ID into the request context and writes one JSON line per request once
+// it completes. It must run after Tracing to see the trace ID.
+func RequestLogger(logger *slog.Logger) gin.HandlerFunc{
+	return func(c *gin.Context){
+		start := time.Now()
+
+		requestID := c.GetHeader(RequestIDHeader)
+		if !validRequestID.MatchString(requestID){
+			requestID = newRequestID()
+		}
+		c.Set(contextRequestID, requestID)
+		c.Header(RequestIDHeader, requestID)
+
+		requestLogger := logger.With("request_id", requestID)
+		if spanContext := trace.SpanContextFromContext(c.Request.Context()); spanContext.IsValid(){
+			requestLogger = requestLogger.With("trace_id", spanContext.TraceID().String())
+		}
+		c.Request = c.Request.WithContext(logging.WithContext(c.Request.Context(), requestLogger))
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == ""{
+			route = "unmatched"
+		}
+		attrs := []any{
+			"method", c.Request.Method,
+			"route", route,
+			"path", c.Request.URL.Path,
+			"status", c.Writer.Status(),
+			"latency_ms", float64(time.Since(start).Microseconds()) / 1000,
+			"bytes", max(c.Writer.Size(), 0),
+			"client_ip", c.ClientIP(),
+		}
+		if userID, ok := c.Get(contextUserID); ok{
+			attrs = append(attrs, "user_id", userID)
+		}
+		if impersonatorID, ok := c.Get(contextImpersonatorID); ok{
+			attrs = append(attrs, "impersonator_id", impersonatorID)
+		}
+		if len(c.Errors) > 0{
+			attrs = append(attrs, "errors", c.Errors.String())
+		}
+
+		level := slog.LevelInfo
+		switch{
+		case c.Writer.Status() >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case c.Writer.Status() >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+		requestLogger.Log(c.Request.Context(), level, "request completed", attrs...)
+	}
+}
+
+// Recovery turns a panic into a 500 response and logs it with the request ID
+func Recovery() gin.HandlerFunc{
+	return gin.CustomRecoveryWithWriter(nil, func(c *gin.Context, err any){
+		logging.FromContext(c.Request.Context()).Error("panic recovered", "panic", err, "stack", string(debug.Stack()))
+		c.AbortWithStatusJSON(http.StatusInternalServerError, model.AppError{
+			Code: http.StatusInternalServerError,
+			Message: "Internal Server Error",
+		})
+	})
+}
+
+func newRequestID() string{
+	raw := make([]byte, 16)
+	rand.Read(raw)
+	return hex.EncodeToString(raw)
+}
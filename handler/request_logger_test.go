@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"bookstore-api/logging"
+	"bookstore-api/model"
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func setupLoggedRouter(t *testing.T, buffer *bytes.Buffer) http.Handler{
+	gin.SetMode(gin.TestMode)
+	logger := slog.New(slog.NewJSONHandler(buffer, nil))
+
+	router := gin.New()
+	router.Use(RequestLogger(logger), Recovery())
+	router.GET("/v1/books/:id", func(c *gin.Context){
+		c.Set(contextUserID, int64(42))
+		logging.FromContext(c.Request.Context()).Info("loading book")
+		c.JSON(http.StatusOK, model.Book{ID: 1, Title: "Dune", Author: "Frank Herbert"})
+	})
+	router.GET("/v1/books", func(c *gin.Context){
+		panic("boom")
+	})
+	return validateContract(t, router)
+}
+
+// logLines decodes every JSON log line written to buffer
+func logLines(t *testing.T, buffer *bytes.Buffer) []map[string]any{
+	var lines []map[string]any
+	decoder := json.NewDecoder(buffer)
+	for decoder.More(){
+		var line map[string]any
+		if err := decoder.Decode(&line); err != nil{
+			t.Fatalf("Log line is not JSON: %v", err)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestRequestLoggerAcceptsRequestID(t *testing.T){
+	var buffer bytes.Buffer
+	router := setupLoggedRouter(t, &buffer)
+
+	req, _ := http.NewRequest(http.MethodGet, "/v1/books/1", nil)
+	req.Header.Set(RequestIDHeader, "trace-123")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Header().Get(RequestIDHeader) != "trace-123"{
+		t.Errorf("Expected request ID to be echoed, got %q", w.Header().Get(RequestIDHeader))
+	}
+
+	lines := logLines(t, &buffer)
+	if len(lines) != 2{
+		t.Fatalf("Expected 2 log lines but got %d", len(lines))
+	}
+
+	// The handler's own log line carries the request ID from the context logger
+	if lines[0]["msg"] != "loading book" || lines[0]["request_id"] != "trace-123"{
+		t.Errorf("Unexpected handler log line: %v", lines[0])
+	}
+
+	access := lines[1]
+	expected := map[string]any{
+		"msg": "request completed",
+		"request_id": "trace-123",
+		"route": "/v1/books/:id",
+		"path": "/v1/books/1",
+		"status": float64(http.StatusOK),
+		"user_id": float64(42),
+		"bytes": float64(w.Body.Len()),
+	}
+	for key, value := range expected{
+		if access[key] != value{
+			t.Errorf("Expected %s=%v but got %v", key, value, access[key])
+		}
+	}
+	if _, ok := access["latency_ms"]; !ok{
+		t.Error("Expected latency_ms in the access log")
+	}
+}
+
+func TestRequestLoggerGeneratesRequestID(t *testing.T){
+	var buffer bytes.Buffer
+	router := setupLoggedRouter(t, &buffer)
+
+	req, _ := http.NewRequest(http.MethodGet, "/v1/books", nil)
+	// IDs with characters that could forge log content are replaced
+	req.Header.Set(RequestIDHeader, "bad id\nlevel=ERROR")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusInternalServerError{
+		t.Errorf("Expected status %d but got %d", http.StatusInternalServerError, w.Code)
+	}
+	requestID := w.Header().Get(RequestIDHeader)
+	if len(requestID) != 32{
+		t.Errorf("Expected a generated request ID, got %q", requestID)
+	}
+
+	lines := logLines(t, &buffer)
+	access := lines[len(lines)-1]
+	if access["request_id"] != requestID || access["level"] != "ERROR" || access["route"] != "/v1/books"{
+		t.Errorf("Unexpected access log line: %v", access)
+	}
+}
@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"bookstore-api/auth"
+	"bookstore-api/model"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const purposeMFAChallenge = "mfa_challenge"
+
+// issueAccessToken creates the token used to call authenticated endpoints
+func issueAccessToken(tokens *auth.TokenManager, user model.User, ttl time.Duration) (string, error){
+	return tokens.Sign(jwt.MapClaims{
+		"user_id" : user.ID,
+		"email" : user.Email,
+		"iat" : time.Now().Unix(),
+		"exp" : time.Now().Add(ttl).Unix(),
+	})
+}
+
+// issueMFAChallenge creates a short-lived token proving the password step succeeded.
+// The ttl bounds how long a user has to type their code after the password step.
+// It carries a purpose claim so it can never be used as an access token, and a
+// random jti under which the attempts at it are counted.
+func issueMFAChallenge(tokens *auth.TokenManager, user model.User, ttl time.Duration) (string, error){
+	challengeID, _, err := auth.NewOpaqueToken()
+	if err != nil{
+		return "", err
+	}
+	return tokens.Sign(jwt.MapClaims{
+		"user_id" : user.ID,
+		"purpose" : purposeMFAChallenge,
+		"jti" : challengeID,
+		"exp" : time.Now().Add(ttl).Unix(),
+	})
+}
+
+// issueImpersonationToken creates an access token for user on behalf of an admin.
+// The admin is recorded in the "act" claim (RFC 8693 actor) so the token is never
+// mistaken for one the user obtained themselves.
+func issueImpersonationToken(tokens *auth.TokenManager, user model.User, admin model.User, ttl time.Duration) (string, error){
+	return tokens.Sign(jwt.MapClaims{
+		"user_id" : user.ID,
+		"email" : user.Email,
+		"act" : map[string]interface{}{"user_id": admin.ID},
+		"iat" : time.Now().Unix(),
+		"exp" : time.Now().Add(ttl).Unix(),
+	})
+}
+
+// issuedBefore reports whether the token was issued before t. Tokens without
+// an iat claim predate it and count as issued before.
+func issuedBefore(claims map[string]interface{}, t time.Time) bool{
+	issuedAt, ok := claims["iat"].(float64)
+	return !ok || int64(issuedAt) < t.Unix()
+}
+
+// userIDFromClaims reads the numeric user_id claim
+func userIDFromClaims(claims map[string]interface{}) (int64, bool){
+	id, ok := claims["user_id"].(float64)
+	if !ok{
+		return 0, false
+	}
+	return int64(id), true
+}
@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"bookstore-api/model"
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracingContinuesIncomingTrace(t *testing.T){
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	gin.SetMode(gin.TestMode)
+	var logs bytes.Buffer
+	router := gin.New()
+	router.Use(Tracing(), RequestLogger(slog.New(slog.NewJSONHandler(&logs, nil))), Recovery())
+	router.GET("/v1/books/:id", func(c *gin.Context){
+		c.JSON(http.StatusOK, model.Book{ID: 12, Title: "Dune", Author: "Frank Herbert"})
+	})
+	router.GET("/v1/books", func(c *gin.Context){
+		panic("boom")
+	})
+	server := validateContract(t, router)
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodGet, "/v1/books/12", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	server.ServeHTTP(httptest.NewRecorder(), req)
+	server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/books", nil))
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2{
+		t.Fatalf("Expected 2 spans but got %d", len(spans))
+	}
+
+	span := spans[0]
+	if span.Name != "GET /v1/books/:id"{
+		t.Errorf("Expected the span to be named after the route template, got %q", span.Name)
+	}
+	if span.SpanContext.TraceID().String() != traceID || span.Parent.SpanID().String() != "00f067aa0ba902b7"{
+		t.Errorf("Expected the span to continue the incoming trace, got trace %s parent %s", span.SpanContext.TraceID(), span.Parent.SpanID())
+	}
+	attributes := map[string]any{}
+	for _, attribute := range span.Attributes{
+		attributes[string(attribute.Key)] = attribute.Value.AsInterface()
+	}
+	if attributes["http.route"] != "/v1/books/:id" || attributes["http.response.status_code"] != int64(http.StatusOK){
+		t.Errorf("Unexpected span attributes: %v", attributes)
+	}
+
+	if spans[1].Status.Code != codes.Error{
+		t.Errorf("Expected a failed request to mark the span as an error, got %v", spans[1].Status)
+	}
+
+	if !strings.Contains(logs.String(), `"trace_id":"`+traceID+`"`){
+		t.Errorf("Expected the request log to carry the trace ID, got %s", logs.String())
+	}
+}
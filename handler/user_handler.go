@@ -1,23 +1,50 @@
 package handler
 
 import (
+	"bookstore-api/auth"
+	"bookstore-api/config"
+	"bookstore-api/mail"
+	"bookstore-api/metrics"
 	"bookstore-api/model"
+	"bookstore-api/password"
 	"bookstore-api/repository"
+	"context"
 	"net/http"
-	"os"
 	"time"
 
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/gin-gonic/gin"
 )
 
+// userStore is the part of the user repository the user handlers need
+type userStore interface{
+	CreateUser(ctx context.Context, user *model.User) (int, error)
+	GetUserByID(ctx context.Context, id int64) (model.User, error)
+	Login(ctx context.Context, email, plaintext string) (model.User, error)
+	UpdateName(ctx context.Context, userID int64, name string) error
+	UpdatePassword(ctx context.Context, userID int64, password string) error
+	DeleteUser(ctx context.Context, userID int64) error
+	CreateEmailChange(ctx context.Context, userID int64, newEmail string, tokenHash string, expiresAt time.Time) error
+	ConfirmEmailChange(ctx context.Context, tokenHash string) (model.User, error)
+	ResetPassword(ctx context.Context, tokenHash string, password string) error
+	SetPendingTOTPSecret(ctx context.Context, userID int64, secret string) error
+	EnableTOTP(ctx context.Context, userID int64, step int64, recoveryCodeHashes []string) error
+	ConsumeTOTPStep(ctx context.Context, userID int64, step int64) (bool, error)
+	ConsumeRecoveryCode(ctx context.Context, userID int64, codeHash string) (bool, error)
+	RecordMFAAttempt(ctx context.Context, challengeID string, userID int64, expiresAt time.Time) (int, error)
+	ConsumeMFAChallenge(ctx context.Context, challengeID string) (bool, error)
+}
+
 type UserHandler struct {
-	repo *repository.UserRepository
+	repo userStore
+	tokens *auth.TokenManager
+	mailer mail.Sender
+	policy *password.Policy
+	auth config.Auth
 }
 
 // RegisterUser handles user registration 
-func NewUserHandler(repo *repository.UserRepository) *UserHandler{
-	return &UserHandler{repo: repo}
+func NewUserHandler(repo userStore, tokens *auth.TokenManager, mailer mail.Sender, policy *password.Policy, authConfig config.Auth) *UserHandler{
+	return &UserHandler{repo: repo, tokens: tokens, mailer: mailer, policy: policy, auth: authConfig}
 }
 
 // RegisterUserHandler handles user registration
@@ -33,8 +60,13 @@ func (h *UserHandler) RegisterUserHandler(c *gin.Context){
 		return
 	}
 
+	if err := h.policy.Validate(input.Password, input.Name, input.Email); err != nil{
+		rejectPassword(c, err)
+		return
+	}
+
 	// Call repository to create new user
-	userID, err := h.repo.CreateUser(&input)
+	userID, err := h.repo.CreateUser(c.Request.Context(), &input)
 	if err != nil{
 		if err == repository.ErrMailExists{
 			c.JSON(http.StatusConflict, model.AppError{
@@ -49,6 +81,8 @@ func (h *UserHandler) RegisterUserHandler(c *gin.Context){
 		return
 	}
 
+	metrics.Registrations.Inc()
+
 	// send success response
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "User registered successfully",
@@ -72,8 +106,9 @@ func (h *UserHandler) LoginUserHandler(c *gin.Context){
 	}
 
 	// Verify user credentials to repository
-	user, err := h.repo.GetUserByEmail(input.Email)
+	user, err := h.repo.Login(c.Request.Context(), input.Email, input.Password)
 	if err != nil{
+		metrics.LoginFailed()
 		c.JSON(http.StatusUnauthorized, model.AppError{
 			Code: http.StatusUnauthorized,
 			Message: "Invalid email or password",
@@ -81,26 +116,64 @@ func (h *UserHandler) LoginUserHandler(c *gin.Context){
 		return
 	}
 
-	// Generate JWT TOKEN
-	// Create "claims" which include data we want to include in the token
-	claims := jwt.MapClaims{
-		"user_id" : user.ID,
-		"email" : user.Email,
-		"exp" : time.Now().Add(time.Hour * 24).Unix(), // Token expires in 24 hours
+	if user.PasswordResetRequired{
+		c.JSON(http.StatusForbidden, model.AppError{
+			Code: http.StatusForbidden,
+			Message: "Password reset required, check your email for the reset token",
+		})
+		return
+	}
+
+	completeLogin(c, h.tokens, h.auth, user)
+}
+
+// completeLogin finishes any successful first-factor login: disabled accounts
+// are rejected, users with two-factor authentication get an MFA challenge and
+// everyone else gets an access token
+func completeLogin(c *gin.Context, tokens *auth.TokenManager, authConfig config.Auth, user model.User){
+	if user.Disabled{
+		c.JSON(http.StatusForbidden, model.AppError{
+			Code: http.StatusForbidden,
+			Message: "Account is disabled",
+		})
+		return
 	}
 
-	// Create the token using the claims
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	// Users with two-factor authentication get a short-lived challenge
+	// that must be exchanged with a valid code on /login/mfa
+	if user.TOTPEnabled{
+		challenge, err := issueMFAChallenge(tokens, user, authConfig.MFAChallengeTTL.Duration)
+		if err != nil{
+			ErrorHandler(c, err)
+			return
+		}
 
-	// Sign the token with a secret key
-	tokenString, err := token.SignedString([]byte(os.Getenv("JWT_SECRET_KEY")))
+		c.JSON(http.StatusOK, gin.H{
+			"mfa_required": true,
+			"challenge_token": challenge,
+		})
+		return
+	}
+
+	// Generate JWT TOKEN
+	tokenString, err := issueAccessToken(tokens, user, authConfig.AccessTokenTTL.Duration)
 	if err != nil{
 		ErrorHandler(c, err)
 		return
 	}
 
+	metrics.LoginSucceeded()
+
 	// Send the token in response
 	c.JSON(http.StatusOK, gin.H{
 		"token": tokenString,
 	})
 }
+
+// rejectPassword responds to a password refused by the password policy
+func rejectPassword(c *gin.Context, err error){
+	c.JSON(http.StatusBadRequest, model.AppError{
+		Code: http.StatusBadRequest,
+		Message: "Invalid password: " + err.Error(),
+	})
+}
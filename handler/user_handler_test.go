@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"bookstore-api/config"
+	"bookstore-api/model"
+	"bookstore-api/password"
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// CreateUser hashes with bcrypt like the repository does, so a password the
+// policy lets through but bcrypt refuses fails the request
+func (m *memoryUsers) CreateUser(ctx context.Context, user *model.User) (int, error){
+	if _, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.MinCost); err != nil{
+		return 0, err
+	}
+	id := int64(len(m.users) + 1)
+	m.users[id] = model.User{ID: id, Name: user.Name, Email: user.Email, Role: model.RoleUser}
+	m.passwords[id] = user.Password
+	return int(id), nil
+}
+
+func TestRegisterRejectsPasswordsTooLongForBcrypt(t *testing.T){
+	gin.SetMode(gin.TestMode)
+	policy := password.NewPolicy(8, 128)
+	policy.MaxBytes = password.BcryptMaxBytes
+	handler := NewUserHandler(newMemoryUsers(), newTestTokens(t), &memoryMailer{}, policy, config.Default().Auth)
+
+	router := gin.New()
+	router.POST("/v1/register", handler.RegisterUserHandler)
+	server := validateContract(t, router)
+
+	cases := []struct{
+		name		string
+		password	string
+		code		int
+	}{
+		{"72 bytes", strings.Repeat("a", 72), http.StatusCreated},
+		{"73 characters", strings.Repeat("b", 73), http.StatusBadRequest},
+		{"40 characters of 80 bytes", strings.Repeat("é", 40), http.StatusBadRequest},
+	}
+
+	for i, tc := range cases{
+		body := `{"name": "Reader", "email": "reader` + string(rune('a' + i)) + `@example.com", "password": "` + tc.password + `"}`
+		recorder := serveJSON(server, http.MethodPost, "/v1/register", "", body)
+		if recorder.Code != tc.code{
+			t.Errorf("%s: expected status code %d but got %d: %s", tc.name, tc.code, recorder.Code, recorder.Body.String())
+		}
+	}
+}
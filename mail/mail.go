@@ -0,0 +1,23 @@
+package mail
+
+import "log/slog"
+
+// Sender delivers transactional emails such as verification links
+type Sender interface {
+	Send(to, subject, body string) error
+}
+
+// LogSender writes emails to the application log. It is used until a real
+// mail provider is configured and keeps local development self-contained.
+type LogSender struct {
+	logger *slog.Logger
+}
+
+func NewLogSender(logger *slog.Logger) *LogSender {
+	return &LogSender{logger: logger}
+}
+
+func (s *LogSender) Send(to, subject, body string) error {
+	s.logger.Info("email sent", "to", to, "subject", subject, "body", body)
+	return nil
+}
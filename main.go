@@ -1,74 +1,515 @@
 package main
 
 import (
+	"bookstore-api/auth"
+	"bookstore-api/config"
 	"bookstore-api/handler"
+	"bookstore-api/logging"
+	"bookstore-api/mail"
+	"bookstore-api/metrics"
+	"bookstore-api/migration"
+	"bookstore-api/oidc"
+	"bookstore-api/outbox"
+	"bookstore-api/password"
+	"bookstore-api/ratelimit"
 	"bookstore-api/repository"
+	"bookstore-api/tracing"
+	"context"
 	"database/sql"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
+	"net/http"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	_ "github.com/jackc/pgx/v5/stdlib"
-	"github.com/joho/godotenv"
 )
 
-func LoggerMiddleware() gin.HandlerFunc{
-	return func (c *gin.Context){
-		startTime := time.Now()
-		c.Next()
-		duration := time.Since(startTime)
-		log.Printf("Request: %s %s - Status: %d - Duration:%s", c.Request.Method, c.Request.RequestURI, c.Writer.Status(), duration)
+// tokenIssuer is the iss claim of every token and must be expected by downstream verifiers
+const tokenIssuer = "bookstore-api"
+
+// loadKeySet reads the signing keys from the configured key directory. Without a key
+// directory an ephemeral key is generated, which means tokens do not survive a restart.
+func loadKeySet(cfg config.Auth) (*auth.KeySet, error){
+	if cfg.KeysDir == ""{
+		slog.Warn("JWT_KEYS_DIR not set, generating an ephemeral signing key")
+		key, err := auth.GenerateKey("ephemeral")
+		if err != nil{
+			return nil, err
+		}
+		return auth.NewKeySet([]*auth.Key{key}, "")
+	}
+	return auth.LoadKeySet(cfg.KeysDir, cfg.ActiveKID)
+}
+
+// reloadKeysOnSignal reloads the key directory on SIGHUP so keys can be rotated
+// without a restart. It returns once ctx is cancelled.
+func reloadKeysOnSignal(ctx context.Context, cfg config.Auth, tokens *auth.TokenManager){
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	for{
+		select{
+		case <-ctx.Done():
+			return
+		case <-signals:
+			keys, err := loadKeySet(cfg)
+			if err != nil{
+				slog.Error("failed to reload signing keys, keeping current keys", "error", err)
+				continue
+			}
+			tokens.SetKeys(keys)
+			slog.Info("reloaded signing keys", "active_kid", keys.Active().ID)
+		}
+	}
+}
+
+// cleanupInterval is how often expired idempotency keys, MFA challenges and
+// refilled rate limit buckets are deleted. All are ignored once expired,
+// deleting them only keeps the tables small.
+const cleanupInterval = time.Hour
+
+// deleteEvery calls deleteExpired every interval with the current time and
+// returns once ctx is cancelled
+func deleteEvery(ctx context.Context, interval time.Duration, name string, deleteExpired func(context.Context, time.Time) (int64, error)){
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for{
+		select{
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			deleted, err := deleteExpired(ctx, now)
+			if err != nil{
+				slog.Error("failed to delete expired "+name, "error", err)
+				continue
+			}
+			slog.Debug("deleted expired "+name, "count", deleted)
+		}
+	}
+}
+
+// newRateLimiter builds the rate limit middleware for the configured store
+func newRateLimiter(ctx context.Context, cfg config.RateLimit, db *repository.DB, bg *workers) (gin.HandlerFunc, error){
+	rules, err := ratelimit.ParseRules(cfg.Default, cfg.Routes)
+	if err != nil{
+		return nil, err
+	}
+
+	var store ratelimit.Store = ratelimit.NewMemoryStore()
+	if cfg.Store == "postgres"{
+		repo := repository.NewRateLimitRepository(db)
+		bg.Go("rate limit bucket cleanup", func(){
+			deleteEvery(ctx, cleanupInterval, "rate limit buckets", repo.DeleteFullRateLimitBuckets)
+		})
+		store = repo
+	}
+	return handler.RateLimit(store, rules), nil
+}
+
+// newOutboxSink builds the sink book change events are delivered to
+func newOutboxSink(cfg config.Outbox, logger *slog.Logger) outbox.Sink{
+	if cfg.Sink == "webhook"{
+		return outbox.WebhookSink{
+			URL: cfg.WebhookURL,
+			Secret: cfg.WebhookSecret,
+			Client: &http.Client{Timeout: cfg.DeliveryTimeout.Duration},
+		}
+	}
+	return outbox.LogSink{Logger: logger}
+}
+
+// startOutbox delivers the book change events recorded in the outbox and
+// deletes them once they are older than the retention
+func startOutbox(ctx context.Context, cfg config.Outbox, db *repository.DB, logger *slog.Logger, bg *workers){
+	repo := repository.NewOutboxRepository(db)
+	dispatcher := outbox.NewDispatcher(repo, newOutboxSink(cfg, logger), outbox.Options{
+		BatchSize: cfg.BatchSize,
+		PollInterval: cfg.PollInterval.Duration,
+		DeliveryTimeout: cfg.DeliveryTimeout.Duration,
+		MaxBackoff: cfg.MaxBackoff.Duration,
+	})
+	bg.Go("outbox dispatcher", func(){
+		dispatcher.Run(ctx)
+	})
+	bg.Go("outbox cleanup", func(){
+		deleteEvery(ctx, cleanupInterval, "delivered outbox events", func(ctx context.Context, now time.Time) (int64, error){
+			return repo.DeleteDeliveredOutboxEvents(ctx, now.Add(-cfg.Retention.Duration))
+		})
+	})
+}
+
+// maxListenBackoff caps the wait between attempts to reconnect the book change listener
+const maxListenBackoff = 30 * time.Second
+
+// newBookStore puts the configured cache in front of the book repository
+func newBookStore(ctx context.Context, cfg *config.Config, repo repository.BookStore, bg *workers) repository.BookStore{
+	if cfg.BookCache.Size == 0{
+		return repo
+	}
+
+	books := repository.NewCachedBookStore(repo, cfg.BookCache.Size, cfg.BookCache.TTL.Duration, metrics.CacheObserver{})
+	if cfg.BookCache.Notify{
+		bg.Go("book change listener", func(){
+			listenBookChanges(ctx, cfg.Database.URL, books)
+		})
+	}
+	return books
+}
+
+// listenBookChanges drops cached books as soon as another instance changes
+// them. A lost connection is retried with backoff until ctx is cancelled;
+// meanwhile cached books still expire after their TTL.
+func listenBookChanges(ctx context.Context, databaseURL string, books *repository.CachedBookStore){
+	backoff := time.Second
+	for{
+		err := repository.ListenBookChanges(ctx, databaseURL, func(){
+			// Changes made while nobody listened were missed
+			books.Purge()
+			backoff = time.Second
+		}, books.Invalidate)
+		if ctx.Err() != nil{
+			return
+		}
+		slog.Warn("book change listener failed, reconnecting", "error", err, "retry_in", backoff)
+
+		select{
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(2 * backoff, maxListenBackoff)
+	}
+}
+
+// openReplicas routes the book reads of primary to the configured replicas
+func openReplicas(cfg config.Database, primary repository.BookStore) (*repository.ReplicatedBookStore, func(), error){
+	var replicas []*repository.Replica
+	var closers []func()
+	closeAll := func(){
+		for _, closeReplica := range closers{
+			closeReplica()
+		}
+	}
+	for _, url := range cfg.ReplicaURLs{
+		replica, closeReplica, err := repository.OpenReplica(cfg, url)
+		if err != nil{
+			closeAll()
+			return nil, nil, err
+		}
+		replicas = append(replicas, replica)
+		closers = append(closers, closeReplica)
+	}
+	return repository.NewReplicatedBookStore(primary, cfg.ReplicaMaxLag.Duration, replicas...), closeAll, nil
+}
+
+// checkReplicasEvery checks the replicas right away and then every interval,
+// logging whenever their state changes, until ctx is cancelled
+func checkReplicasEvery(ctx context.Context, interval time.Duration, books *repository.ReplicatedBookStore){
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	previous := ""
+	for{
+		checkCtx, cancel := context.WithTimeout(ctx, interval)
+		err := books.CheckReplicas(checkCtx)
+		cancel()
+		if state := fmt.Sprint(err); state != previous{
+			previous = state
+			if err != nil{
+				slog.Warn("database replicas out of rotation, reading from the primary instead", "error", err)
+			} else {
+				slog.Info("all database replicas in rotation")
+			}
+		}
+
+		select{
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// newPasswordHasher builds the hasher for the configured algorithm. Hashes of
+// the other algorithm are still accepted and upgraded on login.
+func newPasswordHasher(cfg config.Password) (*password.Manager, error){
+	bcryptHasher, err := password.NewBcryptHasher(cfg.BcryptCost)
+	if err != nil{
+		return nil, err
+	}
+
+	params := password.DefaultArgon2idParams
+	params.MemoryKiB = uint32(cfg.Argon2MemoryKiB)
+	params.Iterations = uint32(cfg.Argon2Iterations)
+	params.Parallelism = uint8(cfg.Argon2Parallelism)
+	argon2idHasher, err := password.NewArgon2idHasher(params)
+	if err != nil{
+		return nil, err
+	}
+
+	if cfg.Algorithm == "argon2id"{
+		return password.NewManager(argon2idHasher, bcryptHasher), nil
 	}
+	return password.NewManager(bcryptHasher, argon2idHasher), nil
+}
+
+// newPasswordPolicy builds the policy enforced when a password is chosen
+func newPasswordPolicy(cfg config.Password) (*password.Policy, error){
+	policy := password.NewPolicy(cfg.MinLength, cfg.MaxLength)
+	if cfg.Algorithm == "bcrypt"{
+		policy.MaxBytes = password.BcryptMaxBytes
+	}
+
+	if cfg.BreachedList != ""{
+		if err := policy.LoadBreachedList(cfg.BreachedList); err != nil{
+			return nil, err
+		}
+		slog.Info("loaded breached password list", "entries", policy.BreachedCount())
+	}
+	return policy, nil
 }
 
 func main(){
-	err := godotenv.Load()
+	os.Exit(run())
+}
+
+// migrationsApplied fails readiness while the database lags behind the
+// migrations embedded in this binary
+func migrationsApplied(db *sql.DB) func(context.Context) error{
+	return func(ctx context.Context) error{
+		pending, err := migration.Pending(ctx, db)
+		if err != nil{
+			return err
+		}
+		if len(pending) > 0{
+			return fmt.Errorf("%d pending migrations, starting with %s", len(pending), pending[0].Name)
+		}
+		return nil
+	}
+}
+
+// run starts the API and blocks until it has shut down. It returns the process
+// exit code so deferred cleanup runs before the process exits.
+func run() int{
+	// Until the configured level is known, log JSON at the info level
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, nil)))
+
+	cfg, err := config.Load()
+	if err != nil{
+		slog.Error("invalid configuration", "error", err)
+		return exitConfig
+	}
+
+	logger, err := logging.New(os.Stdout, cfg.Log.Level)
+	if err != nil{
+		slog.Error("invalid configuration", "error", err)
+		return exitConfig
+	}
+	// The standard log package, used by some libraries, is routed through slog as well
+	slog.SetDefault(logger)
+
+	// SIGINT and SIGTERM (docker stop) start a graceful shutdown. Signal handling
+	// is reset once the first arrives, so a second one terminates immediately.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	context.AfterFunc(ctx, stop)
+
+	// Background workers get their own context: they must keep running while
+	// in-flight requests are drained and are stopped afterwards
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	var bg workers
+
+	if cfg.Log.Level != "debug"{
+		gin.SetMode(gin.ReleaseMode)
+	}
+
+	shutdownTracing, err := tracing.Setup(ctx, cfg.Tracing)
+	if err != nil{
+		slog.Error("failed to set up tracing", "error", err)
+		return exitConfig
+	}
+	defer func(){
+		// Flush buffered spans; ctx is already cancelled at this point
+		flushCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout.Duration)
+		defer cancel()
+		if err := shutdownTracing(flushCtx); err != nil{
+			slog.Error("failed to flush traces", "error", err)
+		}
+	}()
+
+	db, err := repository.OpenDB(cfg.Database)
 	if err != nil{
-		log.Println("Error loading .env file, proceeding with system environment variables")
+		slog.Error("failed to connect to the database", "error", err)
+		return exitUnavailable
 	}
-	connStr := os.Getenv("DATABASE_URL")
-	if connStr == ""{
-		log.Fatal("DATABASE_URL environment variable not set")
+	defer func(){
+		if err := db.Close(); err != nil{
+			slog.Error("failed to close the database", "error", err)
+		}
+	}()
+
+	slog.Info("connected to the database")
+
+	db.ObserveQueries(metrics.QueryObserver{})
+	if err := metrics.RegisterDB(db.DB, "primary"); err != nil{
+		slog.Error("failed to register database metrics", "error", err)
+		return exitError
 	}
 
-	db, err := sql.Open("pgx", connStr)
-	if err != nil {
-		log.Fatalf("Faild to connect to the database: %v", err)
+	err = migration.Up(db.DB)
+	if err != nil{
+		slog.Error("failed to run database migrations", "error", err)
+		return exitUnavailable
 	}
-	defer db.Close()
 
-	err = db.Ping()
+	keys, err := loadKeySet(cfg.Auth)
 	if err != nil{
-		log.Fatalf("Failed to ping the database: %v", err)
+		slog.Error("failed to load signing keys", "error", err)
+		return exitConfig
 	}
+	tokens := auth.NewTokenManager(keys, tokenIssuer)
+	bg.Go("signing key reloader", func(){
+		reloadKeysOnSignal(workerCtx, cfg.Auth, tokens)
+	})
 
-	fmt.Println("Successfully connected to the database!")
+	healthChecks := []handler.HealthCheck{
+		{Name: "database", Check: db.PingContext},
+		{Name: "migrations", Check: migrationsApplied(db.DB)},
+	}
 
 	// For Books
-	bookRepo := repository.NewBookRepository(db)
-	bookHandler := handler.NewBookHandler(bookRepo)
+	var bookRepo repository.BookStore = repository.NewBookRepository(db)
+	if cfg.Database.Driver == "pgxpool"{
+		pool, err := repository.OpenPool(cfg.Database)
+		if err != nil{
+			slog.Error("failed to open the pgx connection pool", "error", err)
+			return exitUnavailable
+		}
+		defer pool.Close()
+		pool.ObserveQueries(metrics.QueryObserver{})
+		healthChecks = append(healthChecks, handler.HealthCheck{Name: "database_pool", Check: pool.Ping})
+		bookRepo = repository.NewPgxBookRepository(pool)
+	}
+	if len(cfg.Database.ReplicaURLs) > 0{
+		replicated, closeReplicas, err := openReplicas(cfg.Database, bookRepo)
+		if err != nil{
+			slog.Error("invalid database replica", "error", err)
+			return exitConfig
+		}
+		defer closeReplicas()
+		bg.Go("replica health check", func(){
+			checkReplicasEvery(workerCtx, cfg.Database.ReplicaCheckInterval.Duration, replicated)
+		})
+		bookRepo = replicated
+	}
+	bookHandler := handler.NewBookHandler(newBookStore(workerCtx, cfg, bookRepo, &bg))
+	startOutbox(workerCtx, cfg.Outbox, db, logger, &bg)
 	
+	mailer := mail.NewLogSender(logger)
+
+	hasher, err := newPasswordHasher(cfg.Password)
+	if err != nil{
+		slog.Error("invalid password hashing configuration", "error", err)
+		return exitConfig
+	}
+	policy, err := newPasswordPolicy(cfg.Password)
+	if err != nil{
+		slog.Error("invalid password policy", "error", err)
+		return exitConfig
+	}
+
 	// For Users
-	userRepo := repository.NewUserRepository(db)
-	userHandler := handler.NewUserHandler(userRepo)
+	userRepo := repository.NewUserRepository(db, hasher)
+	userHandler := handler.NewUserHandler(userRepo, tokens, mailer, policy, cfg.Auth)
+	jwksHandler := handler.NewJWKSHandler(tokens)
 
-	router := gin.Default()
-	router.Use(LoggerMiddleware())
+	// For Admins
+	auditRepo := repository.NewAuditRepository(db)
+	adminHandler := handler.NewAdminHandler(userRepo, auditRepo, tokens, mailer, cfg.Auth)
 
-	// Book routes
-	router.POST("/books", bookHandler.CreateBookHandler)
-	router.GET("/books", bookHandler.GetBooksHandler)
-	router.GET("/books/:id", bookHandler.GetBookByIDHandler)
-	router.PUT("/books/:id", bookHandler.UpdateBookHandler)
-	router.DELETE("/books/:id", bookHandler.DeleteBookHandler)
+	// For API keys
+	apiKeyRepo := repository.NewAPIKeyRepository(db)
+	apiKeyHandler := handler.NewAPIKeyHandler(apiKeyRepo)
 
-	// User routes
-	router.POST("/register", userHandler.RegisterUserHandler)
-	router.POST("/login", userHandler.LoginUserHandler)
+	authenticate := handler.AuthMiddleware(tokens, userRepo, apiKeyRepo)
 
+	// For Idempotency-Key retries
+	idempotencyRepo := repository.NewIdempotencyRepository(db)
+	idempotent := handler.Idempotency(idempotencyRepo, cfg.Idempotency.KeyTTL.Duration, cfg.Idempotency.LockTimeout.Duration)
+	bg.Go("idempotency key cleanup", func(){
+		deleteEvery(workerCtx, cleanupInterval, "idempotency keys", idempotencyRepo.DeleteExpiredIdempotencyKeys)
+	})
+	bg.Go("mfa challenge cleanup", func(){
+		deleteEvery(workerCtx, cleanupInterval, "MFA challenges", userRepo.DeleteExpiredMFAChallenges)
+	})
+
+	rateLimit, err := newRateLimiter(workerCtx, cfg.RateLimit, db, &bg)
+	if err != nil{
+		slog.Error("invalid rate limit configuration", "error", err)
+		return exitConfig
+	}
+
+	// Single sign-on is only enabled when an identity provider is configured
+	var oidcHandler *handler.OIDCHandler
+	if cfg.OIDC.Enabled(){
+		oidcClient := oidc.NewClient(oidc.Config{
+			IssuerURL: cfg.OIDC.Issuer,
+			ClientID: cfg.OIDC.ClientID,
+			ClientSecret: cfg.OIDC.ClientSecret,
+			RedirectURL: cfg.OIDC.RedirectURL,
+		}, nil)
+		oidcHandler = handler.NewOIDCHandler(oidcClient, userRepo, tokens, cfg.Auth)
+	}
+
+	router := gin.New()
+	// Without trusted proxies X-Forwarded-For is ignored, so clients cannot
+	// pick the IP address they are rate limited by
+	if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil{
+		slog.Error("invalid trusted proxies", "error", err)
+		return exitConfig
+	}
+	router.Use(handler.Tracing(), handler.RequestLogger(logger), handler.MetricsMiddleware(), handler.Recovery())
+	router.Use(
+		handler.SecurityHeaders(cfg.Server.HSTSMaxAge.Duration),
+		handler.CORS(cfg.CORS.AllowedOrigins),
+		handler.MaxBodySize(int64(cfg.Server.MaxBodyBytes)),
+		handler.Compress(),
+	)
+	if len(cfg.Database.ReplicaURLs) > 0{
+		router.Use(handler.ReadYourWrites(cfg.Database.ReadYourWritesWindow.Duration))
+	}
+
+	// Health probes for Docker and orchestrators
+	health := handler.NewHealthHandler(cfg.Server.HealthCheckTimeout.Duration, healthChecks...)
+
+	routes{
+		books: bookHandler,
+		users: userHandler,
+		jwks: jwksHandler,
+		admin: adminHandler,
+		apiKeys: apiKeyHandler,
+		oidc: oidcHandler,
+		health: health,
+		authenticate: authenticate,
+		idempotent: idempotent,
+		rateLimit: rateLimit,
+	}.register(router)
+
+	server := &http.Server{
+		Addr: cfg.Server.Addr,
+		Handler: router,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout.Duration,
+		ReadTimeout: cfg.Server.ReadTimeout.Duration,
+		WriteTimeout: cfg.Server.WriteTimeout.Duration,
+		IdleTimeout: cfg.Server.IdleTimeout.Duration,
+		ErrorLog: slog.NewLogLogger(logger.Handler(), slog.LevelWarn),
+	}
 
-	fmt.Println("Starting server on port 8080...")
-	router.Run(":8080")
+	return serve(ctx, server, &bg, stopWorkers, health.StartDraining, cfg.Server)
 }
\ No newline at end of file
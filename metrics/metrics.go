@@ -0,0 +1,156 @@
+// Package metrics holds the Prometheus collectors exported on /metrics
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "bookstore"
+
+// Registry holds every collector served by Handler. A dedicated registry keeps
+// the output independent of whatever other packages register globally.
+var Registry = prometheus.NewRegistry()
+
+var (
+	// HTTPRequests counts completed requests by method, route template and status
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Completed HTTP requests by method, route template and status code.",
+	}, []string{"method", "route", "status"})
+
+	// HTTPRequestDuration observes request latency by method, route template and status
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method, route template and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	// QueryDuration observes the latency of each repository method
+	QueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Latency of repository calls by repository and method.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"repository", "method"})
+
+	// BooksCreated counts books added through the API
+	BooksCreated = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "books_created_total",
+		Help:      "Books created through the API.",
+	})
+
+	// Registrations counts new user accounts
+	Registrations = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "user_registrations_total",
+		Help:      "User accounts registered.",
+	})
+
+	// Logins counts login attempts by result, succeeded or failed
+	Logins = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "logins_total",
+		Help:      "Login attempts by result. A login succeeds once an access token is issued.",
+	}, []string{"result"})
+
+	// RateLimited counts requests rejected with 429 by route template
+	RateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limited_requests_total",
+		Help:      "Requests rejected by the rate limiter by method and route template.",
+	}, []string{"method", "route"})
+
+	// CacheLookups counts in-process cache lookups by cache and result, hit or miss
+	CacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_lookups_total",
+		Help:      "In-process cache lookups by cache and result, hit or miss.",
+	}, []string{"cache", "result"})
+
+	// OutboxDeliveries counts outbox event deliveries by result, delivered or failed
+	OutboxDeliveries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "outbox_deliveries_total",
+		Help:      "Outbox event delivery attempts by result. Failed events are retried.",
+	}, []string{"result"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPRequestDuration,
+		QueryDuration,
+		BooksCreated,
+		Registrations,
+		Logins,
+		RateLimited,
+		CacheLookups,
+		OutboxDeliveries,
+	)
+	// Pre-initialise the result labels so both series are exported from the start
+	Logins.WithLabelValues("succeeded")
+	Logins.WithLabelValues("failed")
+	OutboxDeliveries.WithLabelValues("delivered")
+	OutboxDeliveries.WithLabelValues("failed")
+}
+
+// LoginSucceeded records a login that ended with an access token
+func LoginSucceeded() {
+	Logins.WithLabelValues("succeeded").Inc()
+}
+
+// LoginFailed records a login rejected because of wrong credentials or a wrong second factor
+func LoginFailed() {
+	Logins.WithLabelValues("failed").Inc()
+}
+
+// OutboxDelivered records an outbox event accepted by its sink
+func OutboxDelivered() {
+	OutboxDeliveries.WithLabelValues("delivered").Inc()
+}
+
+// OutboxFailed records a delivery attempt that will be retried
+func OutboxFailed() {
+	OutboxDeliveries.WithLabelValues("failed").Inc()
+}
+
+// RegisterDB exports the connection pool statistics of db under the given name
+func RegisterDB(db *sql.DB, name string) error {
+	return Registry.Register(collectors.NewDBStatsCollector(db, name))
+}
+
+// QueryObserver records repository call latency in QueryDuration
+type QueryObserver struct{}
+
+// ObserveQuery implements repository.QueryObserver
+func (QueryObserver) ObserveQuery(repository, method string, duration time.Duration) {
+	QueryDuration.WithLabelValues(repository, method).Observe(duration.Seconds())
+}
+
+// CacheObserver records cache lookups in CacheLookups
+type CacheObserver struct{}
+
+// ObserveCacheLookup implements repository.CacheObserver
+func (CacheObserver) ObserveCacheLookup(cache string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	CacheLookups.WithLabelValues(cache, result).Inc()
+}
+
+// Handler serves the registry in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
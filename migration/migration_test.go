@@ -0,0 +1,19 @@
+package migration
+
+import "testing"
+
+func TestAllIsOrderedAndUnique(t *testing.T) {
+	migrations, err := All()
+	if err != nil {
+		t.Fatalf("All() failed: %v", err)
+	}
+	if len(migrations) == 0 {
+		t.Fatalf("Expected embedded migrations but found none")
+	}
+
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version <= migrations[i-1].Version {
+			t.Errorf("Migration %s is not ordered after %s", migrations[i].Name, migrations[i-1].Name)
+		}
+	}
+}
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+	user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	idempotency_key VARCHAR(255) NOT NULL,
+	fingerprint CHAR(64) NOT NULL,
+	status_code INTEGER,
+	content_type TEXT,
+	response_body BYTEA,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	expires_at TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY (user_id, idempotency_key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires_at ON idempotency_keys(expires_at);
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS rate_limit_buckets (
+	bucket_key TEXT PRIMARY KEY,
+	tokens DOUBLE PRECISION NOT NULL,
+	allowed BOOLEAN NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL,
+	full_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_rate_limit_buckets_full_at ON rate_limit_buckets(full_at);
@@ -0,0 +1,23 @@
+ALTER TABLE books
+	ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+
+-- book_catalog holds the time the list of books last changed. Unlike the
+-- newest updated_at it also moves when a book is deleted.
+CREATE TABLE IF NOT EXISTS book_catalog (
+	id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+	modified_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO book_catalog (id) VALUES (TRUE) ON CONFLICT DO NOTHING;
+
+CREATE OR REPLACE FUNCTION touch_book_catalog() RETURNS TRIGGER AS $$
+BEGIN
+	UPDATE book_catalog SET modified_at = NOW();
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS books_touch_catalog ON books;
+CREATE TRIGGER books_touch_catalog AFTER INSERT OR UPDATE OR DELETE ON books
+	FOR EACH STATEMENT EXECUTE FUNCTION touch_book_catalog();
@@ -0,0 +1,12 @@
+-- Instances caching books listen on book_changes to drop a book as soon as
+-- any instance, or anyone else, updates or deletes it
+CREATE OR REPLACE FUNCTION notify_book_change() RETURNS TRIGGER AS $$
+BEGIN
+	PERFORM pg_notify('book_changes', OLD.id::text);
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS books_notify_change ON books;
+CREATE TRIGGER books_notify_change AFTER UPDATE OR DELETE ON books
+	FOR EACH ROW EXECUTE FUNCTION notify_book_change();
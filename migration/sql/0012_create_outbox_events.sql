@@ -0,0 +1,18 @@
+-- outbox_events records book changes in the transaction that makes them, for
+-- the dispatcher to deliver to other systems
+CREATE TABLE IF NOT EXISTS outbox_events (
+	id BIGSERIAL PRIMARY KEY,
+	book_id INTEGER NOT NULL,
+	event_type TEXT NOT NULL,
+	payload JSONB NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	attempts INTEGER NOT NULL DEFAULT 0,
+	-- when the event is due: after a failure the retry time, while it is
+	-- being delivered the end of the claim
+	next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	last_error TEXT,
+	delivered_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS outbox_events_pending ON outbox_events (book_id, id) WHERE delivered_at IS NULL;
+CREATE INDEX IF NOT EXISTS outbox_events_delivered_at ON outbox_events (delivered_at) WHERE delivered_at IS NOT NULL;
@@ -0,0 +1,4 @@
+-- tokens_valid_after invalidates every access token issued before it, set
+-- when a forced password reset is completed
+ALTER TABLE users
+	ADD COLUMN IF NOT EXISTS tokens_valid_after TIMESTAMPTZ;
@@ -0,0 +1,13 @@
+-- NOW() is the time the transaction started, so a transaction that started
+-- earlier but committed later could move modified_at backwards, and clients
+-- holding the newer Last-Modified were wrongly told nothing changed. The
+-- clock is read while the catalog row is locked, so the value only grows in
+-- commit order. The price is that book writes take turns on that row.
+CREATE OR REPLACE FUNCTION touch_book_catalog() RETURNS TRIGGER AS $$
+BEGIN
+	UPDATE book_catalog SET modified_at = GREATEST(modified_at, clock_timestamp());
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+ALTER TABLE books ALTER COLUMN updated_at SET DEFAULT clock_timestamp();
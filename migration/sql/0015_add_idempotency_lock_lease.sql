@@ -0,0 +1,4 @@
+-- A request that crashed never completes or releases its key. Its
+-- reservation only holds the key until locked_until, after which a retry may
+-- take it over. Reservations made before this migration can be taken at once.
+ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS locked_until TIMESTAMPTZ NOT NULL DEFAULT NOW();
@@ -0,0 +1,12 @@
+-- Attempts at each MFA challenge, keyed by the jti claim of the challenge
+-- token. A challenge is refused once used or after too many attempts, so a
+-- stolen password cannot be paired with guessed codes until the token expires.
+CREATE TABLE IF NOT EXISTS mfa_challenges (
+	id VARCHAR(64) PRIMARY KEY,
+	user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	used_at TIMESTAMPTZ,
+	expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_mfa_challenges_expires_at ON mfa_challenges(expires_at);
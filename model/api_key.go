@@ -0,0 +1,46 @@
+package model
+
+import "time"
+
+// Scopes that can be granted to an API key. Bearer tokens from a login carry every scope.
+// A scope is only added together with the routes that require it.
+const (
+	ScopeWriteBooks	= "write:books"
+	ScopeAccount	= "account"
+)
+
+// APIKeyScopes lists every scope an API key may be created with
+var APIKeyScopes = []string{ScopeWriteBooks, ScopeAccount}
+
+// APIKey is a long-lived credential for machine clients. Only a hash of the
+// secret is stored; the full key is shown once when it is created.
+type APIKey struct {
+	ID			int64		`json:"id"`
+	UserID		int64		`json:"user_id"`
+	Name		string		`json:"name"`
+	Prefix		string		`json:"prefix"`
+	KeyHash		string		`json:"-"`
+	Scopes		[]string	`json:"scopes"`
+	CreatedAt	time.Time	`json:"created_at"`
+	LastUsedAt	*time.Time	`json:"last_used_at"`
+	ExpiresAt	*time.Time	`json:"expires_at"`
+	RevokedAt	*time.Time	`json:"revoked_at"`
+}
+
+// HasScope reports whether the key was granted scope
+func (k APIKey) HasScope(scope string) bool{
+	for _, s := range k.Scopes{
+		if s == scope{
+			return true
+		}
+	}
+	return false
+}
+
+// Active reports whether the key can still be used at time now
+func (k APIKey) Active(now time.Time) bool{
+	if k.RevokedAt != nil{
+		return false
+	}
+	return k.ExpiresAt == nil || now.Before(*k.ExpiresAt)
+}
@@ -0,0 +1,13 @@
+package model
+
+import "time"
+
+// AuditEntry records a privileged action taken on behalf of or against a user
+type AuditEntry struct {
+	ID				int64			`json:"id"`
+	ActorID			int64			`json:"actor_id"`
+	Action			string			`json:"action"`
+	TargetUserID	int64			`json:"target_user_id"`
+	Details			map[string]any	`json:"details,omitempty"`
+	CreatedAt		time.Time		`json:"created_at"`
+}
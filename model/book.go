@@ -1,8 +1,12 @@
 package model
 
+import "time"
+
 type Book struct {
-	ID          int    `json:"id"`
-	Title       string `json:"title" binding:"required"`
-	Author      string `json:"author" binding:"required"`
-	Description string `json:"description"`
-}
\ No newline at end of file
+	ID          int       `json:"id"`
+	Title       string    `json:"title" binding:"required"`
+	Author      string    `json:"author" binding:"required"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
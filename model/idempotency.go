@@ -0,0 +1,25 @@
+package model
+
+import "time"
+
+// IdempotencyRecord is the outcome of a request sent with an Idempotency-Key.
+// StatusCode is 0 while the first request with the key is still in flight.
+type IdempotencyRecord struct {
+	UserID		int64
+	Key			string
+	// Fingerprint is a hash of the request, so a key reused for a different request is detected
+	Fingerprint	string
+	StatusCode	int
+	ContentType	string
+	Body		[]byte
+	ExpiresAt	time.Time
+	// LockedUntil ends the claim of the request in flight, so a retry can take
+	// over the key of a request that never finished. It also identifies the
+	// claim when the response is stored or the key released.
+	LockedUntil	time.Time
+}
+
+// Completed reports whether the response of the first request was stored
+func (r IdempotencyRecord) Completed() bool{
+	return r.StatusCode != 0
+}
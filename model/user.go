@@ -1,9 +1,27 @@
 package model
 
+import "time"
+
+// Roles a user can have
+const (
+	RoleUser	= "user"
+	RoleAdmin	= "admin"
+)
+
 type User struct {
 	ID			 			int64  `json:"id"`
 	Name		 			string `json:"name" binding:"required"` 
 	Email		 			string `json:"email" binding:"required,email"`
 	Password			string `json:"password,omitempty" binding:"required,min=6"`
 	PasswordHash 	string `json:"-"`
+	EmailVerified	bool   `json:"email_verified"`
+	TOTPSecret		string `json:"-"`
+	TOTPEnabled		bool   `json:"totp_enabled"`
+	TOTPLastStep	int64  `json:"-"`
+	Role			string `json:"role"`
+	Disabled		bool   `json:"disabled"`
+	PasswordResetRequired	bool `json:"password_reset_required"`
+	// TokensValidAfter rejects access tokens issued before it, nil when all are accepted
+	TokensValidAfter	*time.Time `json:"-"`
+	CreatedAt		time.Time `json:"created_at"`
 }
@@ -0,0 +1,28 @@
+package model
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestUserJSONOmitsSecrets(t *testing.T){
+	user := User{
+		ID: 1,
+		Name: "Reader",
+		Email: "reader@example.com",
+		PasswordHash: "$2a$10$hash",
+		TOTPSecret: "GEZDGNBVGY3TQOJQ",
+	}
+
+	body, err := json.Marshal(user)
+	if err != nil{
+		t.Fatalf("json.Marshal() failed: %v", err)
+	}
+
+	for _, secret := range []string{`"password"`, "$2a$10$hash", "GEZDGNBVGY3TQOJQ"}{
+		if strings.Contains(string(body), secret){
+			t.Errorf("Expected %q to be left out of the user JSON: %s", secret, body)
+		}
+	}
+}
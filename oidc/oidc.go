@@ -0,0 +1,310 @@
+// Package oidc implements the relying party side of the OpenID Connect
+// authorization code flow with PKCE.
+package oidc
+
+import (
+	"bookstore-api/auth"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrInvalidIDToken = errors.New("invalid id token")
+	ErrNonceMismatch  = errors.New("id token nonce does not match")
+)
+
+// Config describes the client registration at the identity provider
+type Config struct {
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// Discovery is the subset of the provider metadata the client uses
+type Discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Claims holds the verified ID token claims used to link or provision a user
+type Claims struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// Client talks to a single OpenID provider. Metadata and signing keys are
+// fetched lazily and cached; keys are refetched when an unknown kid shows up.
+type Client struct {
+	config Config
+	http   *http.Client
+
+	mu        sync.Mutex
+	discovery *Discovery
+	keys      map[string]auth.JSONWebKey
+}
+
+func NewClient(config Config, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "email", "profile"}
+	}
+	return &Client{config: config, http: httpClient}
+}
+
+// CallbackPath is the path of the redirect URL the provider sends the browser back to
+func (c *Client) CallbackPath() string {
+	redirect, err := url.Parse(c.config.RedirectURL)
+	if err != nil || redirect.Path == "" {
+		return "/"
+	}
+	return redirect.Path
+}
+
+// Discover fetches and caches the provider metadata
+func (c *Client) Discover(ctx context.Context) (*Discovery, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.discovery != nil {
+		return c.discovery, nil
+	}
+
+	var discovery Discovery
+	wellKnown := strings.TrimSuffix(c.config.IssuerURL, "/") + "/.well-known/openid-configuration"
+	if err := c.getJSON(ctx, wellKnown, &discovery); err != nil {
+		return nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+	if discovery.Issuer != c.config.IssuerURL {
+		return nil, fmt.Errorf("oidc discovery: issuer %q does not match configured %q", discovery.Issuer, c.config.IssuerURL)
+	}
+
+	c.discovery = &discovery
+	return c.discovery, nil
+}
+
+// NewPKCE returns a random code verifier and its S256 challenge (RFC 7636)
+func NewPKCE() (verifier string, challenge string, err error) {
+	verifier, err = randomString(32)
+	if err != nil {
+		return "", "", err
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// NewState returns a random value suitable for the state and nonce parameters
+func NewState() (string, error) {
+	return randomString(24)
+}
+
+func randomString(size int) (string, error) {
+	raw := make([]byte, size)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// AuthCodeURL builds the URL the user is redirected to for login
+func (c *Client) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	discovery, err := c.Discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", c.config.ClientID)
+	params.Set("redirect_uri", c.config.RedirectURL)
+	params.Set("scope", strings.Join(c.config.Scopes, " "))
+	params.Set("state", state)
+	params.Set("nonce", nonce)
+	params.Set("code_challenge", codeChallenge)
+	params.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return discovery.AuthorizationEndpoint + separator + params.Encode(), nil
+}
+
+// Exchange redeems the authorization code and returns the verified ID token claims
+func (c *Client) Exchange(ctx context.Context, code, codeVerifier, nonce string) (Claims, error) {
+	discovery, err := c.Discover(ctx)
+	if err != nil {
+		return Claims{}, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", c.config.RedirectURL)
+	form.Set("code_verifier", codeVerifier)
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Claims{}, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.SetBasicAuth(url.QueryEscape(c.config.ClientID), url.QueryEscape(c.config.ClientSecret))
+
+	response, err := c.http.Do(request)
+	if err != nil {
+		return Claims{}, fmt.Errorf("oidc token exchange: %w", err)
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(response.Body, 1<<20))
+	if err != nil {
+		return Claims{}, err
+	}
+	if response.StatusCode != http.StatusOK {
+		return Claims{}, fmt.Errorf("oidc token exchange: provider returned %d: %s", response.StatusCode, body)
+	}
+
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.Unmarshal(body, &tokens); err != nil {
+		return Claims{}, fmt.Errorf("oidc token exchange: %w", err)
+	}
+	if tokens.IDToken == "" {
+		return Claims{}, fmt.Errorf("oidc token exchange: response has no id_token")
+	}
+
+	return c.VerifyIDToken(ctx, tokens.IDToken, nonce)
+}
+
+// VerifyIDToken checks the signature against the provider JWKS and validates
+// issuer, audience, expiry and nonce
+func (c *Client) VerifyIDToken(ctx context.Context, rawIDToken, nonce string) (Claims, error) {
+	discovery, err := c.Discover(ctx)
+	if err != nil {
+		return Claims{}, err
+	}
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(rawIDToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return c.publicKey(ctx, kid, token.Method.Alg())
+	},
+		jwt.WithValidMethods([]string{"RS256", "ES256", "EdDSA"}),
+		jwt.WithIssuer(discovery.Issuer),
+		jwt.WithAudience(c.config.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return Claims{}, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	if tokenNonce, _ := claims["nonce"].(string); tokenNonce == "" || tokenNonce != nonce {
+		return Claims{}, ErrNonceMismatch
+	}
+
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		return Claims{}, fmt.Errorf("%w: missing sub", ErrInvalidIDToken)
+	}
+
+	result := Claims{Issuer: discovery.Issuer, Subject: subject}
+	result.Email, _ = claims["email"].(string)
+	result.Name, _ = claims["name"].(string)
+	// Some providers send email_verified as the string "true"
+	switch verified := claims["email_verified"].(type) {
+	case bool:
+		result.EmailVerified = verified
+	case string:
+		result.EmailVerified = verified == "true"
+	}
+	return result, nil
+}
+
+// publicKey returns the provider key for kid, refetching the JWKS once if it is unknown
+func (c *Client) publicKey(ctx context.Context, kid, alg string) (interface{}, error) {
+	c.mu.Lock()
+	jwk, ok := c.keys[kid]
+	c.mu.Unlock()
+
+	if !ok {
+		if err := c.refreshKeys(ctx); err != nil {
+			return nil, err
+		}
+		c.mu.Lock()
+		jwk, ok = c.keys[kid]
+		c.mu.Unlock()
+		if !ok {
+			return nil, fmt.Errorf("unknown key id %q", kid)
+		}
+	}
+
+	if jwk.Algorithm != "" && jwk.Algorithm != alg {
+		return nil, fmt.Errorf("key %q is for %s, not %s", kid, jwk.Algorithm, alg)
+	}
+	return jwk.PublicKey()
+}
+
+func (c *Client) refreshKeys(ctx context.Context) error {
+	discovery, err := c.Discover(ctx)
+	if err != nil {
+		return err
+	}
+
+	var set auth.JSONWebKeySet
+	if err := c.getJSON(ctx, discovery.JWKSURI, &set); err != nil {
+		return fmt.Errorf("oidc jwks: %w", err)
+	}
+
+	keys := make(map[string]auth.JSONWebKey, len(set.Keys))
+	for _, key := range set.Keys {
+		if key.Use == "" || key.Use == "sig" {
+			keys[key.KeyID] = key
+		}
+	}
+
+	c.mu.Lock()
+	c.keys = keys
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *Client) getJSON(ctx context.Context, target string, v interface{}) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+
+	response, err := c.http.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %d", target, response.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(response.Body, 1<<20)).Decode(v)
+}
@@ -0,0 +1,130 @@
+package oidc
+
+import (
+	"bookstore-api/oidc/oidctest"
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const redirectURL = "http://bookstore.test/auth/oidc/callback"
+
+func setupProvider(t *testing.T) (*oidctest.Provider, *Client) {
+	provider := oidctest.NewProvider("bookstore", "secret")
+	t.Cleanup(provider.Close)
+
+	client := NewClient(Config{
+		IssuerURL:    provider.Issuer(),
+		ClientID:     "bookstore",
+		ClientSecret: "secret",
+		RedirectURL:  redirectURL,
+	}, provider.Server.Client())
+	return provider, client
+}
+
+// authorize follows the login redirect and returns the code and state sent back to the client
+func authorize(t *testing.T, client *Client, state, nonce, challenge string) (string, string) {
+	t.Helper()
+	authURL, err := client.AuthCodeURL(context.Background(), state, nonce, challenge)
+	if err != nil {
+		t.Fatalf("AuthCodeURL() failed: %v", err)
+	}
+
+	httpClient := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	response, err := httpClient.Get(authURL)
+	if err != nil {
+		t.Fatalf("Authorization request failed: %v", err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusFound {
+		t.Fatalf("Expected redirect from authorization endpoint but got %d", response.StatusCode)
+	}
+
+	location, _ := url.Parse(response.Header.Get("Location"))
+	return location.Query().Get("code"), location.Query().Get("state")
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	_, client := setupProvider(t)
+
+	verifier, challenge, _ := NewPKCE()
+	code, state := authorize(t, client, "state-1", "nonce-1", challenge)
+	if state != "state-1" {
+		t.Errorf("Expected state to be returned unchanged but got %q", state)
+	}
+
+	claims, err := client.Exchange(context.Background(), code, verifier, "nonce-1")
+	if err != nil {
+		t.Fatalf("Exchange() failed: %v", err)
+	}
+
+	if claims.Subject != "mock-subject" || claims.Email != "staff@example.com" || !claims.EmailVerified {
+		t.Errorf("Unexpected claims: %+v", claims)
+	}
+}
+
+func TestExchangeRejectsWrongVerifierAndNonce(t *testing.T) {
+	_, client := setupProvider(t)
+
+	_, challenge, _ := NewPKCE()
+	code, _ := authorize(t, client, "state", "nonce", challenge)
+	otherVerifier, _, _ := NewPKCE()
+	if _, err := client.Exchange(context.Background(), code, otherVerifier, "nonce"); err == nil {
+		t.Errorf("Expected exchange with the wrong PKCE verifier to fail")
+	}
+
+	verifier, challenge, _ := NewPKCE()
+	code, _ = authorize(t, client, "state", "nonce", challenge)
+	if _, err := client.Exchange(context.Background(), code, verifier, "another-nonce"); !errors.Is(err, ErrNonceMismatch) {
+		t.Errorf("Expected ErrNonceMismatch but got %v", err)
+	}
+}
+
+func TestExchangeRejectsInvalidIDTokens(t *testing.T) {
+	provider, client := setupProvider(t)
+
+	cases := map[string]jwt.MapClaims{
+		"wrong audience": {"aud": "someone-else"},
+		"expired":        {"exp": time.Now().Add(-time.Hour).Unix()},
+		"missing sub":    {"sub": ""},
+	}
+
+	for name, override := range cases {
+		verifier, challenge, _ := NewPKCE()
+		code, _ := authorize(t, client, "state", "nonce", challenge)
+		provider.OverrideNextIDToken(override)
+
+		if _, err := client.Exchange(context.Background(), code, verifier, "nonce"); !errors.Is(err, ErrInvalidIDToken) {
+			t.Errorf("%s: expected ErrInvalidIDToken but got %v", name, err)
+		}
+	}
+}
+
+func TestDiscoveryRejectsIssuerMismatch(t *testing.T) {
+	provider, _ := setupProvider(t)
+
+	client := NewClient(Config{IssuerURL: provider.Issuer() + "/", ClientID: "bookstore"}, provider.Server.Client())
+	if _, err := client.Discover(context.Background()); err == nil {
+		t.Errorf("Expected discovery to fail for an unexpected issuer")
+	}
+}
+
+func TestCallbackPath(t *testing.T) {
+	cases := map[string]string{
+		"https://shop.example.com/v1/auth/oidc/callback": "/v1/auth/oidc/callback",
+		"https://shop.example.com":                       "/",
+		"":                                               "/",
+	}
+	for redirectURL, expected := range cases {
+		if got := NewClient(Config{RedirectURL: redirectURL}, nil).CallbackPath(); got != expected {
+			t.Errorf("CallbackPath() for %q = %q, expected %q", redirectURL, got, expected)
+		}
+	}
+}
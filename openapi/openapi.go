@@ -0,0 +1,53 @@
+// Package openapi embeds the OpenAPI 3 description of the API. The document is
+// maintained by hand in openapi.yaml next to this file and served as JSON.
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed openapi.yaml
+var source []byte
+
+var document = sync.OnceValues(func() ([]byte, error) {
+	var spec map[string]any
+	if err := yaml.Unmarshal(source, &spec); err != nil {
+		return nil, fmt.Errorf("openapi.yaml: %w", err)
+	}
+	return json.Marshal(spec)
+})
+
+// JSON returns the document encoded as JSON
+func JSON() ([]byte, error) {
+	return document()
+}
+
+// Methods lists the HTTP methods an OpenAPI path item may describe
+var Methods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// Operations returns every documented operation as "METHOD /path", with path
+// parameters written the OpenAPI way, e.g. "GET /books/{id}"
+func Operations() ([]string, error) {
+	var spec struct {
+		Paths map[string]map[string]any `yaml:"paths"`
+	}
+	if err := yaml.Unmarshal(source, &spec); err != nil {
+		return nil, fmt.Errorf("openapi.yaml: %w", err)
+	}
+
+	var operations []string
+	for path, item := range spec.Paths {
+		for _, method := range Methods {
+			if _, ok := item[method]; ok {
+				operations = append(operations, strings.ToUpper(method)+" "+path)
+			}
+		}
+	}
+	return operations, nil
+}
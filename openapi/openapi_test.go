@@ -0,0 +1,83 @@
+package openapi
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestJSONIsOpenAPI3(t *testing.T) {
+	spec, err := JSON()
+	if err != nil {
+		t.Fatalf("JSON() failed: %v", err)
+	}
+
+	var document map[string]any
+	if err := json.Unmarshal(spec, &document); err != nil {
+		t.Fatalf("Document is not valid JSON: %v", err)
+	}
+	if version, _ := document["openapi"].(string); !strings.HasPrefix(version, "3.") {
+		t.Errorf("Expected an OpenAPI 3 document, got version %v", document["openapi"])
+	}
+}
+
+// TestReferencesResolve catches typos in $ref, which would otherwise only show up in Swagger UI
+func TestReferencesResolve(t *testing.T) {
+	spec, err := JSON()
+	if err != nil {
+		t.Fatalf("JSON() failed: %v", err)
+	}
+	var document map[string]any
+	if err := json.Unmarshal(spec, &document); err != nil {
+		t.Fatalf("Document is not valid JSON: %v", err)
+	}
+
+	var walk func(node any)
+	walk = func(node any) {
+		switch value := node.(type) {
+		case map[string]any:
+			if ref, ok := value["$ref"].(string); ok && !resolves(document, ref) {
+				t.Errorf("Reference %s does not resolve", ref)
+			}
+			for _, child := range value {
+				walk(child)
+			}
+		case []any:
+			for _, child := range value {
+				walk(child)
+			}
+		}
+	}
+	walk(document)
+}
+
+func resolves(document map[string]any, ref string) bool {
+	path, ok := strings.CutPrefix(ref, "#/")
+	if !ok {
+		return false
+	}
+	var node any = document
+	for _, segment := range strings.Split(path, "/") {
+		object, ok := node.(map[string]any)
+		if !ok {
+			return false
+		}
+		if node, ok = object[segment]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func TestOperationsListsEveryMethod(t *testing.T) {
+	operations, err := Operations()
+	if err != nil {
+		t.Fatalf("Operations() failed: %v", err)
+	}
+	for _, expected := range []string{"GET /v1/books", "POST /v1/books", "DELETE /v1/books/{id}", "GET /.well-known/jwks.json"} {
+		if !slices.Contains(operations, expected) {
+			t.Errorf("Expected %s among the operations", expected)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package outbox
+
+import (
+	"bookstore-api/metrics"
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Options tune a Dispatcher
+type Options struct {
+	// BatchSize is the number of events claimed at once
+	BatchSize int
+	// PollInterval is the wait between polls that found nothing to deliver
+	PollInterval time.Duration
+	// DeliveryTimeout bounds a single delivery
+	DeliveryTimeout time.Duration
+	// MaxBackoff caps the wait before retrying a failed event. The wait
+	// starts at a second and doubles with every attempt.
+	MaxBackoff time.Duration
+}
+
+// Dispatcher moves events from the outbox to a sink. Several instances may
+// run against the same table: each claims its own events.
+//
+// A failing event is retried until it is delivered, and holds back the later
+// events of its book meanwhile, so a consumer never sees a book's changes out
+// of order. Events of other books are not held up.
+type Dispatcher struct {
+	store Store
+	sink  Sink
+	opts  Options
+	now   func() time.Time
+}
+
+func NewDispatcher(store Store, sink Sink, opts Options) *Dispatcher {
+	return &Dispatcher{store: store, sink: sink, opts: opts, now: time.Now}
+}
+
+// Run dispatches events until ctx is cancelled. After a batch it polls again
+// right away, so a backlog is worked off without waiting.
+func (d *Dispatcher) Run(ctx context.Context) {
+	for {
+		delivered, err := d.DispatchOnce(ctx)
+		if err != nil && ctx.Err() == nil {
+			slog.Error("failed to claim outbox events", "error", err)
+		}
+		if delivered > 0 && err == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(d.opts.PollInterval):
+		}
+	}
+}
+
+// DispatchOnce claims one batch and delivers it. It returns the number of
+// events claimed.
+func (d *Dispatcher) DispatchOnce(ctx context.Context) (int, error) {
+	// The claim outlasts the deliveries, which run concurrently, so no other
+	// instance takes an event over while it is still being delivered
+	lease := 2 * d.opts.DeliveryTimeout
+	events, err := d.store.ClaimOutboxEvents(ctx, d.now(), lease, d.opts.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	// A batch holds at most one event per book, so delivering it concurrently
+	// keeps the order within each book
+	var wg sync.WaitGroup
+	for _, event := range events {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.deliver(ctx, event)
+		}()
+	}
+	wg.Wait()
+	return len(events), nil
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, event Event) {
+	deliverCtx, cancel := context.WithTimeout(ctx, d.opts.DeliveryTimeout)
+	err := d.sink.Deliver(deliverCtx, event)
+	cancel()
+
+	// Record the outcome even when shutting down, or the event waits for its lease
+	ctx = context.WithoutCancel(ctx)
+	if err == nil {
+		metrics.OutboxDelivered()
+		if err := d.store.MarkOutboxEventDelivered(ctx, event.ID, d.now()); err != nil {
+			// The event is delivered again once its claim expires
+			slog.Error("failed to mark outbox event delivered", "event_id", event.ID, "error", err)
+		}
+		return
+	}
+
+	metrics.OutboxFailed()
+	next := d.now().Add(d.backoff(event.Attempt))
+	slog.Warn("outbox event delivery failed", "event_id", event.ID, "type", event.Type,
+		"book_id", event.BookID, "attempt", event.Attempt, "retry_at", next, "error", err)
+	if err := d.store.RescheduleOutboxEvent(ctx, event.ID, next, err.Error()); err != nil {
+		slog.Error("failed to reschedule outbox event", "event_id", event.ID, "error", err)
+	}
+}
+
+// backoff is the wait after the given failed attempt: 1s, 2s, 4s, ... up to MaxBackoff
+func (d *Dispatcher) backoff(attempt int) time.Duration {
+	wait := time.Second
+	for i := 1; i < attempt && wait < d.opts.MaxBackoff; i++ {
+		wait *= 2
+	}
+	return min(wait, d.opts.MaxBackoff)
+}
@@ -0,0 +1,204 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryStore is an outbox table in memory with the claim rules of the
+// Postgres one: only the oldest undelivered event of a book is claimable
+type memoryStore struct {
+	mu     sync.Mutex
+	events []*storedEvent
+}
+
+type storedEvent struct {
+	Event
+	due       time.Time
+	delivered bool
+	lastError string
+}
+
+func (s *memoryStore) add(eventType string, bookID int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, &storedEvent{Event: Event{ID: int64(len(s.events) + 1), Type: eventType, BookID: bookID}})
+}
+
+func (s *memoryStore) ClaimOutboxEvents(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var claimed []Event
+	blocked := map[int]bool{}
+	for _, event := range s.events {
+		if event.delivered {
+			continue
+		}
+		if !blocked[event.BookID] && !event.due.After(now) && len(claimed) < limit {
+			event.due = now.Add(lease)
+			event.Attempt++
+			claimed = append(claimed, event.Event)
+		}
+		blocked[event.BookID] = true
+	}
+	return claimed, nil
+}
+
+func (s *memoryStore) MarkOutboxEventDelivered(ctx context.Context, id int64, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events[id-1].delivered = true
+	return nil
+}
+
+func (s *memoryStore) RescheduleOutboxEvent(ctx context.Context, id int64, next time.Time, lastError string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events[id-1].due = next
+	s.events[id-1].lastError = lastError
+	return nil
+}
+
+func newTestDispatcher(store Store, sink Sink, now *time.Time) *Dispatcher {
+	d := NewDispatcher(store, sink, Options{
+		BatchSize:       10,
+		PollInterval:    time.Millisecond,
+		DeliveryTimeout: time.Second,
+		MaxBackoff:      time.Minute,
+	})
+	d.now = func() time.Time { return *now }
+	return d
+}
+
+func TestDispatcherKeepsTheOrderOfEachBook(t *testing.T) {
+	store := &memoryStore{}
+	store.add(BookCreated, 1)
+	store.add(BookCreated, 2)
+	store.add(BookUpdated, 1)
+	store.add(BookDeleted, 1)
+	store.add(BookUpdated, 2)
+
+	sink := &MemorySink{}
+	now := time.Now()
+	d := newTestDispatcher(store, sink, &now)
+
+	// Each batch holds the next event of every book
+	for _, expected := range []int{2, 2, 1, 0} {
+		claimed, err := d.DispatchOnce(context.Background())
+		if err != nil {
+			t.Fatalf("DispatchOnce() failed: %v", err)
+		}
+		if claimed != expected {
+			t.Fatalf("Expected %d events in the batch, got %d", expected, claimed)
+		}
+	}
+
+	byBook := map[int][]string{}
+	for _, event := range sink.Events() {
+		byBook[event.BookID] = append(byBook[event.BookID], event.Type)
+	}
+	if got := byBook[1]; len(got) != 3 || got[0] != BookCreated || got[1] != BookUpdated || got[2] != BookDeleted {
+		t.Errorf("Unexpected events of book 1: %v", got)
+	}
+	if got := byBook[2]; len(got) != 2 || got[0] != BookCreated || got[1] != BookUpdated {
+		t.Errorf("Unexpected events of book 2: %v", got)
+	}
+}
+
+func TestDispatcherRetriesFailedEvents(t *testing.T) {
+	store := &memoryStore{}
+	store.add(BookCreated, 1)
+	store.add(BookUpdated, 1)
+	store.add(BookCreated, 2)
+
+	failures := 2
+	sink := &MemorySink{Fail: func(event Event) error {
+		if event.BookID == 1 && failures > 0 {
+			failures--
+			return errors.New("webhook answered 503 Service Unavailable")
+		}
+		return nil
+	}}
+	now := time.Now()
+	d := newTestDispatcher(store, sink, &now)
+	ctx := context.Background()
+
+	d.DispatchOnce(ctx)
+	if events := sink.Events(); len(events) != 1 || events[0].BookID != 2 {
+		t.Fatalf("Expected only book 2 to be delivered, got %v", events)
+	}
+	if store.events[0].lastError == "" || !store.events[0].due.Equal(now.Add(time.Second)) {
+		t.Fatalf("Expected the first failure to be retried after 1s, got %+v", store.events[0])
+	}
+
+	// Neither the failed event nor the later event of its book is due yet
+	if claimed, _ := d.DispatchOnce(ctx); claimed != 0 {
+		t.Fatalf("Expected nothing to be due, got %d events", claimed)
+	}
+
+	now = now.Add(time.Second)
+	d.DispatchOnce(ctx)
+	if !store.events[0].due.Equal(now.Add(2 * time.Second)) {
+		t.Fatalf("Expected the second failure to be retried after 2s, got %s", store.events[0].due.Sub(now))
+	}
+
+	now = now.Add(2 * time.Second)
+	d.DispatchOnce(ctx)
+	d.DispatchOnce(ctx)
+
+	events := sink.Events()
+	if len(events) != 3 || events[1].Type != BookCreated || events[2].Type != BookUpdated {
+		t.Fatalf("Expected book 1 to be delivered in order after the retries, got %v", events)
+	}
+	if events[1].Attempt != 3 {
+		t.Errorf("Expected the event to be delivered on the third attempt, got %d", events[1].Attempt)
+	}
+}
+
+func TestDispatcherRunStopsWithContext(t *testing.T) {
+	store := &memoryStore{}
+	store.add(BookCreated, 1)
+	sink := &MemorySink{}
+	now := time.Now()
+	d := newTestDispatcher(store, sink, &now)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		d.Run(ctx)
+		close(done)
+	}()
+
+	deadline := time.After(time.Second)
+	for len(sink.Events()) == 0 {
+		select {
+		case <-deadline:
+			t.Fatal("Expected the event to be delivered")
+		case <-time.After(time.Millisecond):
+		}
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected Run to return once the context is cancelled")
+	}
+}
+
+func TestBackoffIsCapped(t *testing.T) {
+	d := NewDispatcher(nil, nil, Options{MaxBackoff: 10 * time.Second})
+
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second}
+	for i, wait := range expected {
+		if got := d.backoff(i + 1); got != wait {
+			t.Errorf("Attempt %d: expected %s, got %s", i+1, wait, got)
+		}
+	}
+	if got := d.backoff(1000); got != 10*time.Second {
+		t.Errorf("Expected a large attempt to be capped at 10s, got %s", got)
+	}
+}
@@ -0,0 +1,47 @@
+// Package outbox delivers the domain events that repositories record in the
+// outbox_events table, in the same transaction as the change they describe.
+// Delivery is at least once: consumers must tolerate an event arriving twice
+// and can recognise it by its ID.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// Event types of book changes. Data holds the book as returned by the API,
+// for BookDeleted as it was before the delete.
+const (
+	BookCreated = "BookCreated"
+	BookUpdated = "BookUpdated"
+	BookDeleted = "BookDeleted"
+)
+
+// Event is one change recorded in the outbox
+type Event struct {
+	// ID increases with every event and is stable across redeliveries
+	ID         int64           `json:"id"`
+	Type       string          `json:"type"`
+	BookID     int             `json:"book_id"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Data       json.RawMessage `json:"data"`
+	// Attempt counts the deliveries of this event, starting at 1
+	Attempt int `json:"-"`
+}
+
+// Sink receives events. An error makes the dispatcher retry the event later.
+type Sink interface {
+	Deliver(ctx context.Context, event Event) error
+}
+
+// Store is the outbox table
+type Store interface {
+	// ClaimOutboxEvents reserves up to limit events due at now for lease. Only
+	// the oldest undelivered event of each book is claimed, so events of one
+	// book are delivered in order.
+	ClaimOutboxEvents(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]Event, error)
+	MarkOutboxEventDelivered(ctx context.Context, id int64, now time.Time) error
+	// RescheduleOutboxEvent makes a failed event due again at next
+	RescheduleOutboxEvent(ctx context.Context, id int64, next time.Time, lastError string) error
+}
@@ -0,0 +1,114 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// Headers of webhook deliveries
+const (
+	EventHeader     = "X-Bookstore-Event"
+	DeliveryHeader  = "X-Bookstore-Delivery"
+	SignatureHeader = "X-Bookstore-Signature"
+)
+
+// LogSink writes every event to a logger, e.g. to follow changes without a consumer
+type LogSink struct {
+	Logger *slog.Logger
+}
+
+func (s LogSink) Deliver(ctx context.Context, event Event) error {
+	s.Logger.InfoContext(ctx, "book event",
+		"event_id", event.ID, "type", event.Type, "book_id", event.BookID, "data", string(event.Data))
+	return nil
+}
+
+// WebhookSink posts every event as JSON to a URL. Any status other than 2xx
+// counts as a failure.
+//
+// With a secret, each request carries an X-Bookstore-Signature of
+// "sha256=" and the hex HMAC-SHA256 of the body, so the receiver can check it
+// came from the API.
+type WebhookSink struct {
+	URL    string
+	Secret string
+	Client *http.Client
+}
+
+func (s WebhookSink) Deliver(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, event.Type)
+	req.Header.Set(DeliveryHeader, strconv.FormatInt(event.ID, 10))
+	if s.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(s.Secret, body))
+	}
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// Reading the body lets the connection be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
+
+// Sign is the X-Bookstore-Signature of a webhook body
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// MemorySink keeps delivered events in memory, for tests
+type MemorySink struct {
+	mu     sync.Mutex
+	events []Event
+	// Fail, when set, is returned instead of accepting an event
+	Fail func(Event) error
+}
+
+func (s *MemorySink) Deliver(ctx context.Context, event Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Fail != nil {
+		if err := s.Fail(event); err != nil {
+			return err
+		}
+	}
+	s.events = append(s.events, event)
+	return nil
+}
+
+// Events returns the delivered events in the order they arrived
+func (s *MemorySink) Events() []Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Event(nil), s.events...)
+}
@@ -0,0 +1,67 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWebhookSinkPostsSignedEvents(t *testing.T) {
+	var received *http.Request
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	event := Event{
+		ID:         42,
+		Type:       BookUpdated,
+		BookID:     7,
+		OccurredAt: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		Data:       json.RawMessage(`{"id":7,"title":"Dune"}`),
+	}
+	sink := WebhookSink{URL: server.URL, Secret: "s3cret", Client: server.Client()}
+	if err := sink.Deliver(context.Background(), event); err != nil {
+		t.Fatalf("Deliver() failed: %v", err)
+	}
+
+	if received.Method != http.MethodPost || received.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("Expected a JSON POST, got %s %s", received.Method, received.Header.Get("Content-Type"))
+	}
+	if received.Header.Get(EventHeader) != BookUpdated || received.Header.Get(DeliveryHeader) != "42" {
+		t.Errorf("Unexpected event headers %v", received.Header)
+	}
+	if received.Header.Get(SignatureHeader) != Sign("s3cret", body) {
+		t.Errorf("Expected the body to be signed, got %q", received.Header.Get(SignatureHeader))
+	}
+
+	var decoded Event
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		t.Fatalf("Failed to decode the body: %v", err)
+	}
+	if decoded.ID != 42 || decoded.BookID != 7 || string(decoded.Data) != string(event.Data) || !decoded.OccurredAt.Equal(event.OccurredAt) {
+		t.Errorf("Unexpected body %s", body)
+	}
+}
+
+func TestWebhookSinkFailsOnErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(SignatureHeader) != "" {
+			t.Error("Expected no signature without a secret")
+		}
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	sink := WebhookSink{URL: server.URL}
+	if err := sink.Deliver(context.Background(), Event{ID: 1, Type: BookCreated}); err == nil {
+		t.Error("Expected an error for a 503 response")
+	}
+}
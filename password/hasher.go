@@ -0,0 +1,211 @@
+// Package password hashes and verifies user passwords and enforces the password policy.
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrMismatch      = errors.New("password does not match")
+	ErrUnknownFormat = errors.New("unknown password hash format")
+)
+
+// Hasher produces self-describing hashes: the algorithm and its parameters are
+// encoded in the hash so they can be verified after the configuration changes.
+type Hasher interface {
+	Hash(password string) (string, error)
+	// Verify returns ErrMismatch for a wrong password and ErrUnknownFormat if
+	// the hash was not produced by this algorithm
+	Verify(encoded, password string) error
+	// Outdated reports whether a hash of this algorithm uses weaker parameters than configured
+	Outdated(encoded string) bool
+	// Recognizes reports whether encoded was produced by this algorithm
+	Recognizes(encoded string) bool
+}
+
+// BcryptHasher hashes with bcrypt at a configurable cost
+type BcryptHasher struct {
+	Cost int
+}
+
+func NewBcryptHasher(cost int) (*BcryptHasher, error) {
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return nil, fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	return &BcryptHasher{Cost: cost}, nil
+}
+
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashed), nil
+}
+
+func (h *BcryptHasher) Verify(encoded, password string) error {
+	if !h.Recognizes(encoded) {
+		return ErrUnknownFormat
+	}
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return ErrMismatch
+	}
+	return err
+}
+
+func (h *BcryptHasher) Outdated(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost < h.Cost
+}
+
+func (h *BcryptHasher) Recognizes(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+// Argon2idParams are the tunable argon2id parameters (RFC 9106)
+type Argon2idParams struct {
+	MemoryKiB   uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2idParams follow the second recommended option of RFC 9106 section 4
+var DefaultArgon2idParams = Argon2idParams{
+	MemoryKiB:   64 * 1024,
+	Iterations:  3,
+	Parallelism: 4,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// Argon2idHasher hashes with argon2id and encodes hashes in the PHC string
+// format: $argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>
+type Argon2idHasher struct {
+	Params Argon2idParams
+}
+
+func NewArgon2idHasher(params Argon2idParams) (*Argon2idHasher, error) {
+	if params.MemoryKiB < 8*uint32(params.Parallelism) || params.Iterations < 1 || params.Parallelism < 1 {
+		return nil, errors.New("invalid argon2id parameters")
+	}
+	if params.SaltLength < 8 || params.KeyLength < 16 {
+		return nil, errors.New("argon2id salt must be at least 8 bytes and key at least 16 bytes")
+	}
+	return &Argon2idHasher{Params: params}, nil
+}
+
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.Params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	p := h.Params
+	key := argon2.IDKey([]byte(password), salt, p.Iterations, p.MemoryKiB, p.Parallelism, p.KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, p.MemoryKiB, p.Iterations, p.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (h *Argon2idHasher) Verify(encoded, password string) error {
+	params, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return err
+	}
+
+	computed := argon2.IDKey([]byte(password), salt, params.Iterations, params.MemoryKiB, params.Parallelism, uint32(len(key)))
+	if subtle.ConstantTimeCompare(computed, key) != 1 {
+		return ErrMismatch
+	}
+	return nil
+}
+
+func (h *Argon2idHasher) Outdated(encoded string) bool {
+	params, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return true
+	}
+	return params.MemoryKiB < h.Params.MemoryKiB ||
+		params.Iterations < h.Params.Iterations ||
+		params.Parallelism < h.Params.Parallelism ||
+		uint32(len(salt)) < h.Params.SaltLength ||
+		uint32(len(key)) < h.Params.KeyLength
+}
+
+func (h *Argon2idHasher) Recognizes(encoded string) bool {
+	return strings.HasPrefix(encoded, "$argon2id$")
+}
+
+func decodeArgon2id(encoded string) (Argon2idParams, []byte, []byte, error) {
+	var params Argon2idParams
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, ErrUnknownFormat
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, ErrUnknownFormat
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.MemoryKiB, &params.Iterations, &params.Parallelism); err != nil {
+		return params, nil, nil, ErrUnknownFormat
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, ErrUnknownFormat
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, ErrUnknownFormat
+	}
+	return params, salt, key, nil
+}
+
+// Manager hashes new passwords with the preferred hasher and verifies hashes
+// produced by any supported hasher, reporting when a hash should be upgraded
+type Manager struct {
+	preferred Hasher
+	legacy    []Hasher
+}
+
+// NewManager uses preferred for new hashes. Hashes of the other algorithms
+// are still accepted and flagged for rehashing.
+func NewManager(preferred Hasher, legacy ...Hasher) *Manager {
+	return &Manager{preferred: preferred, legacy: legacy}
+}
+
+func (m *Manager) Hash(password string) (string, error) {
+	return m.preferred.Hash(password)
+}
+
+// Verify checks password against encoded. needsRehash is true when the
+// password matched but the hash uses another algorithm or weaker parameters.
+func (m *Manager) Verify(encoded, password string) (needsRehash bool, err error) {
+	if m.preferred.Recognizes(encoded) {
+		if err := m.preferred.Verify(encoded, password); err != nil {
+			return false, err
+		}
+		return m.preferred.Outdated(encoded), nil
+	}
+
+	for _, hasher := range m.legacy {
+		if hasher.Recognizes(encoded) {
+			if err := hasher.Verify(encoded, password); err != nil {
+				return false, err
+			}
+			return true, nil
+		}
+	}
+	return false, ErrUnknownFormat
+}
@@ -0,0 +1,149 @@
+package password
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fastArgon2id keeps the tests quick while exercising the real algorithm
+var fastArgon2id = Argon2idParams{MemoryKiB: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func TestArgon2idHashAndVerify(t *testing.T) {
+	hasher, err := NewArgon2idHasher(fastArgon2id)
+	if err != nil {
+		t.Fatalf("NewArgon2idHasher() failed: %v", err)
+	}
+
+	encoded, err := hasher.Hash("correct horse battery staple")
+	if err != nil {
+		t.Fatalf("Hash() failed: %v", err)
+	}
+	if !strings.HasPrefix(encoded, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Errorf("Unexpected encoding: %s", encoded)
+	}
+
+	if err := hasher.Verify(encoded, "correct horse battery staple"); err != nil {
+		t.Errorf("Expected password to verify, got: %v", err)
+	}
+	if err := hasher.Verify(encoded, "wrong password"); !errors.Is(err, ErrMismatch) {
+		t.Errorf("Expected ErrMismatch, got: %v", err)
+	}
+	if err := hasher.Verify("$2a$10$notargon", "x"); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("Expected ErrUnknownFormat, got: %v", err)
+	}
+}
+
+func TestManagerFlagsOutdatedHashes(t *testing.T) {
+	oldBcrypt, _ := NewBcryptHasher(4)
+	newBcrypt, _ := NewBcryptHasher(5)
+	argon, _ := NewArgon2idHasher(fastArgon2id)
+	strongerParams := fastArgon2id
+	strongerParams.Iterations = 2
+	strongerArgon, _ := NewArgon2idHasher(strongerParams)
+
+	bcryptHash, _ := oldBcrypt.Hash("secret-password")
+	argonHash, _ := argon.Hash("secret-password")
+
+	cases := []struct {
+		name        string
+		manager     *Manager
+		encoded     string
+		needsRehash bool
+	}{
+		{"same bcrypt cost", NewManager(oldBcrypt), bcryptHash, false},
+		{"higher bcrypt cost", NewManager(newBcrypt), bcryptHash, true},
+		{"bcrypt to argon2id", NewManager(argon, oldBcrypt), bcryptHash, true},
+		{"same argon2id params", NewManager(argon, oldBcrypt), argonHash, false},
+		{"stronger argon2id params", NewManager(strongerArgon), argonHash, true},
+	}
+
+	for _, tc := range cases {
+		needsRehash, err := tc.manager.Verify(tc.encoded, "secret-password")
+		if err != nil {
+			t.Errorf("%s: Verify() failed: %v", tc.name, err)
+			continue
+		}
+		if needsRehash != tc.needsRehash {
+			t.Errorf("%s: expected needsRehash=%v but got %v", tc.name, tc.needsRehash, needsRehash)
+		}
+	}
+
+	if _, err := NewManager(argon).Verify(bcryptHash, "secret-password"); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("Expected ErrUnknownFormat when bcrypt is not accepted, got: %v", err)
+	}
+	if _, err := NewManager(argon, oldBcrypt).Verify("!", "secret-password"); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("Expected ErrUnknownFormat for an unusable hash, got: %v", err)
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	list := filepath.Join(t.TempDir(), "breached.txt")
+	content := "# test list\n" +
+		"password123\n" +
+		"5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8:3861493\n" // SHA-1 of "password"
+	if err := os.WriteFile(list, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write list: %v", err)
+	}
+
+	policy := NewPolicy(8, 64)
+	if err := policy.LoadBreachedList(list); err != nil {
+		t.Fatalf("LoadBreachedList() failed: %v", err)
+	}
+	if policy.BreachedCount() != 2 {
+		t.Fatalf("Expected 2 breached entries but got %d", policy.BreachedCount())
+	}
+
+	cases := []struct {
+		password string
+		expected error
+	}{
+		{"short", ErrTooShort},
+		{strings.Repeat("a", 65), ErrTooLong},
+		{"password", ErrBreached},
+		{"password123", ErrBreached},
+		{"reader@example.com", ErrContainsInput},
+		{"a long and unusual passphrase", nil},
+	}
+
+	for _, tc := range cases {
+		err := policy.Validate(tc.password, "Reader", "reader@example.com")
+		if !errors.Is(err, tc.expected) {
+			t.Errorf("Validate(%q): expected %v but got %v", tc.password, tc.expected, err)
+		}
+	}
+}
+
+func TestPolicyLimitsBytesForBcrypt(t *testing.T) {
+	policy := NewPolicy(8, 128)
+	policy.MaxBytes = BcryptMaxBytes
+	hasher, err := NewBcryptHasher(4)
+	if err != nil {
+		t.Fatalf("NewBcryptHasher() failed: %v", err)
+	}
+
+	cases := []struct {
+		password string
+		expected error
+	}{
+		{strings.Repeat("a", 72), nil},
+		{strings.Repeat("a", 73), ErrTooLong},
+		// 40 characters, but 80 bytes
+		{strings.Repeat("é", 40), ErrTooLong},
+	}
+
+	for _, tc := range cases {
+		err := policy.Validate(tc.password)
+		if !errors.Is(err, tc.expected) {
+			t.Errorf("Validate() of %d bytes: expected %v but got %v", len(tc.password), tc.expected, err)
+		}
+		// Whatever the policy accepts must hash
+		if err == nil {
+			if _, err := hasher.Hash(tc.password); err != nil {
+				t.Errorf("Hash() of an accepted password failed: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	ErrTooShort      = errors.New("password is too short")
+	ErrTooLong       = errors.New("password is too long")
+	ErrBreached      = errors.New("password appears in a list of breached passwords, choose another one")
+	ErrContainsInput = errors.New("password must not be your name or email address")
+)
+
+// sha1Line matches a line of the Have I Been Pwned hash list: <SHA-1 hex>[:count]
+var sha1Line = regexp.MustCompile(`^[0-9A-Fa-f]{40}(:\d+)?$`)
+
+// BcryptMaxBytes is the longest password bcrypt hashes; it rejects longer ones
+const BcryptMaxBytes = 72
+
+// Policy decides which passwords are acceptable for new or changed passwords
+type Policy struct {
+	MinLength int
+	MaxLength int
+	// MaxBytes limits the UTF-8 encoded length for hashers that cannot take
+	// longer passwords, 0 for no limit
+	MaxBytes int
+	// breached holds upper case SHA-1 hex digests of known breached passwords
+	breached map[string]struct{}
+}
+
+// NewPolicy creates a policy without a breached password list
+func NewPolicy(minLength, maxLength int) *Policy {
+	return &Policy{MinLength: minLength, MaxLength: maxLength, breached: map[string]struct{}{}}
+}
+
+// LoadBreachedList reads a local breached password list. Each line is either a
+// SHA-1 digest in the Have I Been Pwned format (HASH or HASH:COUNT) or a plain
+// text password. Empty lines and lines starting with # are ignored.
+func (p *Policy) LoadBreachedList(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if sha1Line.MatchString(line) {
+			digest, _, _ := strings.Cut(line, ":")
+			p.breached[strings.ToUpper(digest)] = struct{}{}
+			continue
+		}
+		p.breached[sha1Hex(line)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("breached password list %s: %w", path, err)
+	}
+	return nil
+}
+
+// BreachedCount returns the number of entries in the breached password list
+func (p *Policy) BreachedCount() int {
+	return len(p.breached)
+}
+
+// Validate checks a candidate password. userInputs are values such as the
+// name and email address that must not be used as the password.
+func (p *Policy) Validate(password string, userInputs ...string) error {
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		return fmt.Errorf("%w, use at least %d characters", ErrTooShort, p.MinLength)
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		return fmt.Errorf("%w, use at most %d characters", ErrTooLong, p.MaxLength)
+	}
+	if p.MaxBytes > 0 && len(password) > p.MaxBytes {
+		return fmt.Errorf("%w, use at most %d bytes", ErrTooLong, p.MaxBytes)
+	}
+
+	for _, input := range userInputs {
+		if input != "" && strings.EqualFold(strings.TrimSpace(input), password) {
+			return ErrContainsInput
+		}
+	}
+
+	if _, found := p.breached[sha1Hex(password)]; found {
+		return ErrBreached
+	}
+	return nil
+}
+
+func sha1Hex(value string) string {
+	sum := sha1.Sum([]byte(value))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
@@ -0,0 +1,140 @@
+// Package ratelimit implements token bucket rate limits. A bucket holds up to
+// Burst requests and refills continuously at Rate requests per second, so a
+// client can burst after being idle but is held to the rate over time.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit describes one token bucket
+type Limit struct {
+	Burst int
+	// Rate is the number of tokens added per second
+	Rate float64
+}
+
+// PerPeriod allows requests per period, starting with a full bucket
+func PerPeriod(requests int, period time.Duration) Limit {
+	return Limit{Burst: requests, Rate: float64(requests) / period.Seconds()}
+}
+
+// Parse reads a limit written as requests per period, e.g. "300/1m"
+func Parse(value string) (Limit, error) {
+	requests, period, ok := strings.Cut(value, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("%q is not a limit such as 300/1m", value)
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(requests))
+	if err != nil || count <= 0 {
+		return Limit{}, fmt.Errorf("%q must start with a positive number of requests", value)
+	}
+	duration, err := time.ParseDuration(strings.TrimSpace(period))
+	if err != nil || duration <= 0 {
+		return Limit{}, fmt.Errorf("%q must end with a positive period such as 1m", value)
+	}
+	return PerPeriod(count, duration), nil
+}
+
+// Window is the time an empty bucket takes to fill up again
+func (l Limit) Window() time.Duration {
+	return seconds(float64(l.Burst) / l.Rate)
+}
+
+// Result is the state of a bucket after a request took a token from it
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// ResetAfter is the time until the bucket is full again
+	ResetAfter time.Duration
+	// RetryAfter is the time until the next request is allowed, zero if it is allowed now
+	RetryAfter time.Duration
+}
+
+// NewResult describes a bucket that holds tokens after the request was counted
+func NewResult(limit Limit, tokens float64, allowed bool) Result {
+	result := Result{
+		Allowed:    allowed,
+		Limit:      limit.Burst,
+		Remaining:  int(math.Floor(tokens)),
+		ResetAfter: seconds((float64(limit.Burst) - tokens) / limit.Rate),
+	}
+	if tokens < 1 {
+		result.RetryAfter = seconds((1 - tokens) / limit.Rate)
+	}
+	return result
+}
+
+// refill returns the tokens in a bucket that held tokens elapsed ago, and
+// whether one of them can be taken
+func refill(limit Limit, tokens float64, elapsed time.Duration) (float64, bool) {
+	tokens = math.Min(float64(limit.Burst), tokens+elapsed.Seconds()*limit.Rate)
+	if tokens < 1 {
+		return tokens, false
+	}
+	return tokens - 1, true
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// Store keeps the buckets. MemoryStore limits each process on its own; a
+// shared store such as repository.RateLimitRepository applies one limit across
+// every instance of the API.
+type Store interface {
+	// Take counts a request against the bucket named key
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// Rules maps routes, written as "METHOD /path/:param", to their limit. Routes
+// without a rule of their own share the default bucket of the client.
+type Rules struct {
+	// Default applies to routes without a rule. A zero Default leaves them unlimited.
+	Default Limit
+	Routes  map[string]Limit
+}
+
+// For returns the limit of route and the name of the bucket it is counted in
+func (r Rules) For(route string) (Limit, string, bool) {
+	if limit, ok := r.Routes[route]; ok {
+		return limit, route, true
+	}
+	if r.Default.Burst > 0 {
+		return r.Default, "default", true
+	}
+	return Limit{}, "", false
+}
+
+// ParseRules reads the default limit and route rules written as
+// "METHOD /path=requests/period", e.g. "POST /v1/login=10/1m". An empty
+// defaultLimit leaves routes without a rule unlimited.
+func ParseRules(defaultLimit string, routes []string) (Rules, error) {
+	rules := Rules{Routes: map[string]Limit{}}
+	if defaultLimit != "" {
+		limit, err := Parse(defaultLimit)
+		if err != nil {
+			return Rules{}, err
+		}
+		rules.Default = limit
+	}
+	for _, rule := range routes {
+		route, value, ok := strings.Cut(rule, "=")
+		method, path, hasPath := strings.Cut(strings.TrimSpace(route), " ")
+		if !ok || !hasPath || !strings.HasPrefix(path, "/") {
+			return Rules{}, fmt.Errorf("%q is not a route rule such as \"POST /v1/login=10/1m\"", rule)
+		}
+		limit, err := Parse(value)
+		if err != nil {
+			return Rules{}, err
+		}
+		rules.Routes[strings.ToUpper(method)+" "+path] = limit
+	}
+	return rules, nil
+}
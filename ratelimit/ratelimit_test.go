@@ -0,0 +1,86 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreRefillsAtRate(t *testing.T) {
+	now := time.Date(2026, time.October, 19, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	limit := PerPeriod(3, time.Minute)
+	ctx := context.Background()
+
+	for i := 2; i >= 0; i-- {
+		result, _ := store.Take(ctx, "ip:10.0.0.5", limit)
+		if !result.Allowed || result.Remaining != i {
+			t.Fatalf("Expected request to be allowed with %d remaining, got %+v", i, result)
+		}
+	}
+
+	result, _ := store.Take(ctx, "ip:10.0.0.5", limit)
+	if result.Allowed {
+		t.Fatalf("Expected the fourth request to be limited")
+	}
+	if result.RetryAfter != 20*time.Second {
+		t.Errorf("Expected to retry after 20s, got %s", result.RetryAfter)
+	}
+	if result.ResetAfter != time.Minute {
+		t.Errorf("Expected the bucket to be full after 1m, got %s", result.ResetAfter)
+	}
+
+	// Other clients have their own bucket
+	if result, _ := store.Take(ctx, "ip:10.0.0.6", limit); !result.Allowed {
+		t.Errorf("Expected another client to be allowed")
+	}
+
+	now = now.Add(20 * time.Second)
+	if result, _ := store.Take(ctx, "ip:10.0.0.5", limit); !result.Allowed || result.Remaining != 0 {
+		t.Errorf("Expected one token to have refilled after 20s, got %+v", result)
+	}
+}
+
+func TestMemoryStoreForgetsFullBuckets(t *testing.T) {
+	now := time.Date(2026, time.October, 19, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	limit := PerPeriod(10, time.Minute)
+
+	store.Take(context.Background(), "ip:10.0.0.5", limit)
+	now = now.Add(2 * time.Minute)
+	store.Take(context.Background(), "ip:10.0.0.6", limit)
+
+	if _, ok := store.buckets["ip:10.0.0.5"]; ok {
+		t.Errorf("Expected the refilled bucket to be dropped")
+	}
+}
+
+func TestParseRules(t *testing.T) {
+	rules, err := ParseRules("300/1m", []string{"post /v1/login=10/1m", "GET /v1/books/:id = 5/1s"})
+	if err != nil {
+		t.Fatalf("ParseRules failed: %v", err)
+	}
+
+	if limit, bucket, _ := rules.For("POST /v1/login"); limit != PerPeriod(10, time.Minute) || bucket != "POST /v1/login" {
+		t.Errorf("Expected the login rule, got %+v in bucket %q", limit, bucket)
+	}
+	if limit, _, _ := rules.For("GET /v1/books/:id"); limit != PerPeriod(5, time.Second) {
+		t.Errorf("Expected 5 requests per second, got %+v", limit)
+	}
+	if limit, bucket, _ := rules.For("GET /v1/books"); limit != PerPeriod(300, time.Minute) || bucket != "default" {
+		t.Errorf("Expected the default limit, got %+v in bucket %q", limit, bucket)
+	}
+
+	for _, invalid := range [][]string{{"POST=10/1m"}, {"POST /v1/login"}, {"POST /v1/login=10"}, {"POST /v1/login=0/1m"}, {"POST /v1/login=10/0s"}} {
+		if _, err := ParseRules("", invalid); err == nil {
+			t.Errorf("Expected %q to be rejected", invalid[0])
+		}
+	}
+
+	unlimited, _ := ParseRules("", nil)
+	if _, _, ok := unlimited.For("GET /v1/books"); ok {
+		t.Errorf("Expected routes to be unlimited without a default")
+	}
+}
@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"bookstore-api/model"
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+var ErrVerificationNotFound = errors.New("verification token is invalid or expired")
+
+// UpdateName changes the display name of a user
+func (r *UserRepository) UpdateName(ctx context.Context, userID int64, name string) error{
+	ctx, done := r.db.startQuery(ctx, "UserRepository", "UpdateName")
+	defer done()
+
+	query := `UPDATE users SET name = $1 WHERE id = $2`
+
+	result, err := r.db.ExecContext(ctx, query, name, userID)
+	if err != nil{
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil{
+		return err
+	}
+
+	if rowsAffected == 0{
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// UpdatePassword hashes and stores a new password
+func (r *UserRepository) UpdatePassword(ctx context.Context, userID int64, password string) error{
+	hashedPassword, err := r.hasher.Hash(password)
+	if err != nil{
+		return err
+	}
+
+	ctx, done := r.db.startQuery(ctx, "UserRepository", "UpdatePassword")
+	defer done()
+
+	result, err := r.db.ExecContext(ctx, `UPDATE users SET password_hash = $1 WHERE id = $2`, hashedPassword, userID)
+	if err != nil{
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil{
+		return err
+	}
+
+	if rowsAffected == 0{
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// DeleteUser removes the account; related rows are removed by ON DELETE CASCADE
+func (r *UserRepository) DeleteUser(ctx context.Context, userID int64) error{
+	ctx, done := r.db.startQuery(ctx, "UserRepository", "DeleteUser")
+	defer done()
+
+	result, err := r.db.ExecContext(ctx, `DELETE FROM users WHERE id = $1`, userID)
+	if err != nil{
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil{
+		return err
+	}
+
+	if rowsAffected == 0{
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// CreateEmailChange stores a pending email change. Older pending changes for the user are discarded.
+func (r *UserRepository) CreateEmailChange(ctx context.Context, userID int64, newEmail string, tokenHash string, expiresAt time.Time) error{
+	ctx, done := r.db.startQuery(ctx, "UserRepository", "CreateEmailChange")
+	defer done()
+
+	var taken bool
+	err := r.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE email = $1)`, newEmail).Scan(&taken)
+	if err != nil{
+		return err
+	}
+	if taken{
+		return ErrMailExists
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil{
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM email_verifications WHERE user_id = $1`, userID); err != nil{
+		return err
+	}
+
+	query := `INSERT INTO email_verifications (user_id, new_email, token_hash, expires_at) VALUES ($1, $2, $3, $4)`
+	if _, err := tx.ExecContext(ctx, query, userID, newEmail, tokenHash, expiresAt); err != nil{
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ConfirmEmailChange applies the pending email change matching the token hash
+func (r *UserRepository) ConfirmEmailChange(ctx context.Context, tokenHash string) (model.User, error){
+	ctx, done := r.db.startQuery(ctx, "UserRepository", "ConfirmEmailChange")
+	defer done()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil{
+		return model.User{}, err
+	}
+	defer tx.Rollback()
+
+	var userID int64
+	var newEmail string
+	query := `DELETE FROM email_verifications WHERE token_hash = $1 AND expires_at > NOW() RETURNING user_id, new_email`
+	err = tx.QueryRowContext(ctx, query, tokenHash).Scan(&userID, &newEmail)
+	if err != nil{
+		if err == sql.ErrNoRows{
+			return model.User{}, ErrVerificationNotFound
+		}
+		return model.User{}, err
+	}
+
+	query = `UPDATE users SET email = $1, email_verified = TRUE WHERE id = $2 RETURNING ` + userColumns
+	user, err := scanUser(tx.QueryRowContext(ctx, query, newEmail, userID))
+	if err != nil{
+		// Someone may have registered the address while the change was pending
+		if strings.Contains(err.Error(), "unique constraint"){
+			return model.User{}, ErrMailExists
+		}
+		return model.User{}, err
+	}
+
+	if err := tx.Commit(); err != nil{
+		return model.User{}, err
+	}
+	return user, nil
+}
@@ -0,0 +1,141 @@
+package repository
+
+import (
+	"bookstore-api/auth"
+	"bookstore-api/model"
+	"bookstore-api/password"
+	"context"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// setupTestUsers returns a user repository on an emptied users table and its database
+func setupTestUsers(t *testing.T) (*UserRepository, *DB){
+	db := setupTestDB(t)
+	t.Cleanup(func(){ db.Close() })
+	db.Exec("DELETE FROM users")
+
+	hasher, err := password.NewBcryptHasher(bcrypt.MinCost)
+	if err != nil{
+		t.Fatalf("NewBcryptHasher() failed: %v", err)
+	}
+	users := NewDB(db, 0)
+	return NewUserRepository(users, password.NewManager(hasher)), users
+}
+
+func createTestUser(t *testing.T, repo *UserRepository, email, plaintext string) model.User{
+	t.Helper()
+	id, err := repo.CreateUser(context.Background(), &model.User{Name: "Reader", Email: email, Password: plaintext})
+	if err != nil{
+		t.Fatalf("CreateUser() failed: %v", err)
+	}
+	user, err := repo.GetUserByID(context.Background(), int64(id))
+	if err != nil{
+		t.Fatalf("GetUserByID() failed: %v", err)
+	}
+	return user
+}
+
+func TestEmailChangeIsAppliedOnceVerified(t *testing.T){
+	repo, _ := setupTestUsers(t)
+	ctx := context.Background()
+	user := createTestUser(t, repo, "reader@example.com", "my password")
+	createTestUser(t, repo, "taken@example.com", "my password")
+
+	if err := repo.CreateEmailChange(ctx, user.ID, "taken@example.com", auth.HashToken("taken"), time.Now().Add(time.Hour)); err != ErrMailExists{
+		t.Errorf("Expected ErrMailExists for a taken address, got %v", err)
+	}
+
+	tokenHash := auth.HashToken("verification token")
+	if err := repo.CreateEmailChange(ctx, user.ID, "new@example.com", tokenHash, time.Now().Add(time.Hour)); err != nil{
+		t.Fatalf("CreateEmailChange() failed: %v", err)
+	}
+	if pending, _ := repo.GetUserByID(ctx, user.ID); pending.Email != "reader@example.com"{
+		t.Fatalf("Expected the email to stay unchanged until verified, got %s", pending.Email)
+	}
+
+	confirmed, err := repo.ConfirmEmailChange(ctx, tokenHash)
+	if err != nil{
+		t.Fatalf("ConfirmEmailChange() failed: %v", err)
+	}
+	if confirmed.Email != "new@example.com" || !confirmed.EmailVerified{
+		t.Errorf("Expected the verified new email, got %+v", confirmed)
+	}
+
+	if _, err := repo.ConfirmEmailChange(ctx, tokenHash); err != ErrVerificationNotFound{
+		t.Errorf("Expected ErrVerificationNotFound for a reused token, got %v", err)
+	}
+}
+
+func TestExpiredEmailChangeIsRejected(t *testing.T){
+	repo, _ := setupTestUsers(t)
+	ctx := context.Background()
+	user := createTestUser(t, repo, "reader@example.com", "my password")
+
+	tokenHash := auth.HashToken("expired token")
+	if err := repo.CreateEmailChange(ctx, user.ID, "new@example.com", tokenHash, time.Now().Add(-time.Minute)); err != nil{
+		t.Fatalf("CreateEmailChange() failed: %v", err)
+	}
+	if _, err := repo.ConfirmEmailChange(ctx, tokenHash); err != ErrVerificationNotFound{
+		t.Errorf("Expected ErrVerificationNotFound for an expired token, got %v", err)
+	}
+	if unchanged, _ := repo.GetUserByID(ctx, user.ID); unchanged.Email != "reader@example.com"{
+		t.Errorf("Expected the email to be unchanged, got %s", unchanged.Email)
+	}
+}
+
+func TestUpdatePasswordAndDeleteUser(t *testing.T){
+	repo, _ := setupTestUsers(t)
+	ctx := context.Background()
+	user := createTestUser(t, repo, "reader@example.com", "old password")
+
+	if err := repo.UpdatePassword(ctx, user.ID, "brand new secret"); err != nil{
+		t.Fatalf("UpdatePassword() failed: %v", err)
+	}
+	if _, err := repo.Login(ctx, user.Email, "old password"); err != ErrInvalidPassword{
+		t.Errorf("Expected the old password to be rejected, got %v", err)
+	}
+	if _, err := repo.Login(ctx, user.Email, "brand new secret"); err != nil{
+		t.Errorf("Expected the new password to be accepted, got %v", err)
+	}
+
+	if err := repo.DeleteUser(ctx, user.ID); err != nil{
+		t.Fatalf("DeleteUser() failed: %v", err)
+	}
+	if _, err := repo.GetUserByID(ctx, user.ID); err != ErrUserNotFound{
+		t.Errorf("Expected ErrUserNotFound after the delete, got %v", err)
+	}
+	if err := repo.DeleteUser(ctx, user.ID); err != ErrUserNotFound{
+		t.Errorf("Expected ErrUserNotFound for a second delete, got %v", err)
+	}
+}
+
+func TestMFAChallengeAttemptsAreCounted(t *testing.T){
+	repo, _ := setupTestUsers(t)
+	ctx := context.Background()
+	user := createTestUser(t, repo, "reader@example.com", "my password")
+	expiresAt := time.Now().Add(time.Minute)
+
+	for expected := 1; expected <= 3; expected++{
+		attempts, err := repo.RecordMFAAttempt(ctx, "challenge", user.ID, expiresAt)
+		if err != nil || attempts != expected{
+			t.Fatalf("Expected attempt %d but got %d, %v", expected, attempts, err)
+		}
+	}
+
+	if consumed, err := repo.ConsumeMFAChallenge(ctx, "challenge"); err != nil || !consumed{
+		t.Fatalf("Expected the challenge to be consumed, got %v, %v", consumed, err)
+	}
+	if consumed, _ := repo.ConsumeMFAChallenge(ctx, "challenge"); consumed{
+		t.Error("Expected a challenge to be consumed only once")
+	}
+	if _, err := repo.RecordMFAAttempt(ctx, "challenge", user.ID, expiresAt); err != ErrMFAChallengeUsed{
+		t.Errorf("Expected ErrMFAChallengeUsed for a used challenge, got %v", err)
+	}
+
+	if deleted, err := repo.DeleteExpiredMFAChallenges(ctx, expiresAt.Add(time.Second)); err != nil || deleted != 1{
+		t.Errorf("Expected the expired challenge to be deleted, got %d, %v", deleted, err)
+	}
+}
@@ -0,0 +1,144 @@
+package repository
+
+import (
+	"bookstore-api/model"
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// likeEscaper makes search text match literally in a LIKE pattern
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// ListUsers returns a page of users ordered by id, optionally filtered by a
+// case-insensitive match on email or name, and the total number of matches
+func (r *UserRepository) ListUsers(ctx context.Context, search string, limit, offset int) ([]model.User, int, error){
+	ctx, done := r.db.startQuery(ctx, "UserRepository", "ListUsers")
+	defer done()
+
+	pattern := "%" + likeEscaper.Replace(search) + "%"
+
+	var total int
+	countQuery := `SELECT COUNT(*) FROM users WHERE $1 = '' OR email ILIKE $2 ESCAPE '\' OR name ILIKE $2 ESCAPE '\'`
+	if err := r.db.QueryRowContext(ctx, countQuery, search, pattern).Scan(&total); err != nil{
+		return nil, 0, err
+	}
+
+	query := `SELECT ` + userColumns + ` FROM users
+		WHERE $1 = '' OR email ILIKE $2 ESCAPE '\' OR name ILIKE $2 ESCAPE '\'
+		ORDER BY id LIMIT $3 OFFSET $4`
+	rows, err := r.db.QueryContext(ctx, query, search, pattern, limit, offset)
+	if err != nil{
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	users := make([]model.User, 0)
+	for rows.Next(){
+		user, err := scanUser(rows)
+		if err != nil{
+			return nil, 0, err
+		}
+		users = append(users, user)
+	}
+	return users, total, rows.Err()
+}
+
+// SetDisabled enables or disables an account
+func (r *UserRepository) SetDisabled(ctx context.Context, userID int64, disabled bool) error{
+	ctx, done := r.db.startQuery(ctx, "UserRepository", "SetDisabled")
+	defer done()
+
+	result, err := r.db.ExecContext(ctx, `UPDATE users SET disabled = $1 WHERE id = $2`, disabled, userID)
+	if err != nil{
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil{
+		return err
+	}
+
+	if rowsAffected == 0{
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// RequirePasswordReset blocks the account and stores a reset token until the
+// user picks a new password. API keys are revoked, as they may be what leaked.
+func (r *UserRepository) RequirePasswordReset(ctx context.Context, userID int64, tokenHash string, expiresAt time.Time) error{
+	ctx, done := r.db.startQuery(ctx, "UserRepository", "RequirePasswordReset")
+	defer done()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil{
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `UPDATE users SET password_reset_required = TRUE WHERE id = $1`, userID)
+	if err != nil{
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil{
+		return err
+	}
+	if rowsAffected == 0{
+		return ErrUserNotFound
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE api_keys SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`, userID); err != nil{
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM password_resets WHERE user_id = $1`, userID); err != nil{
+		return err
+	}
+
+	query := `INSERT INTO password_resets (user_id, token_hash, expires_at) VALUES ($1, $2, $3)`
+	if _, err := tx.ExecContext(ctx, query, userID, tokenHash, expiresAt); err != nil{
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ResetPassword sets a new password using a reset token and clears the reset
+// requirement. Access tokens issued before stay invalid.
+func (r *UserRepository) ResetPassword(ctx context.Context, tokenHash string, password string) error{
+	hashedPassword, err := r.hasher.Hash(password)
+	if err != nil{
+		return err
+	}
+
+	ctx, done := r.db.startQuery(ctx, "UserRepository", "ResetPassword")
+	defer done()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil{
+		return err
+	}
+	defer tx.Rollback()
+
+	var userID int64
+	query := `DELETE FROM password_resets WHERE token_hash = $1 AND expires_at > NOW() RETURNING user_id`
+	err = tx.QueryRowContext(ctx, query, tokenHash).Scan(&userID)
+	if err != nil{
+		if err == sql.ErrNoRows{
+			return ErrVerificationNotFound
+		}
+		return err
+	}
+
+	// The app clock stamps the iat of new tokens, so it stamps this too
+	query = `UPDATE users SET password_hash = $1, password_reset_required = FALSE, tokens_valid_after = $3 WHERE id = $2`
+	if _, err := tx.ExecContext(ctx, query, hashedPassword, userID, time.Now()); err != nil{
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"bookstore-api/auth"
+	"bookstore-api/model"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestForcedPasswordResetRevokesCredentials(t *testing.T){
+	repo, db := setupTestUsers(t)
+	keys := NewAPIKeyRepository(db)
+	ctx := context.Background()
+	user := createTestUser(t, repo, "reader@example.com", "leaked password")
+
+	key := model.APIKey{UserID: user.ID, Name: "script", Prefix: "bk_test", KeyHash: auth.HashToken("bk_test_secret"), Scopes: []string{model.ScopeWriteBooks}}
+	if err := keys.CreateAPIKey(ctx, &key); err != nil{
+		t.Fatalf("CreateAPIKey() failed: %v", err)
+	}
+
+	tokenHash := auth.HashToken("reset token")
+	if err := repo.RequirePasswordReset(ctx, user.ID, tokenHash, time.Now().Add(time.Hour)); err != nil{
+		t.Fatalf("RequirePasswordReset() failed: %v", err)
+	}
+	if pending, _ := repo.GetUserByID(ctx, user.ID); !pending.PasswordResetRequired{
+		t.Error("Expected the reset to be required")
+	}
+	if revoked, _ := keys.GetAPIKeyByPrefix(ctx, key.Prefix); revoked.RevokedAt == nil{
+		t.Error("Expected the API key to be revoked")
+	}
+
+	before := time.Now()
+	if err := repo.ResetPassword(ctx, tokenHash, "brand new secret"); err != nil{
+		t.Fatalf("ResetPassword() failed: %v", err)
+	}
+	reset, _ := repo.GetUserByID(ctx, user.ID)
+	if reset.PasswordResetRequired{
+		t.Error("Expected the reset requirement to be cleared")
+	}
+	if reset.TokensValidAfter == nil || reset.TokensValidAfter.Before(before.Truncate(time.Second)){
+		t.Errorf("Expected tokens issued before the reset to be invalidated, got %v", reset.TokensValidAfter)
+	}
+	if err := repo.ResetPassword(ctx, tokenHash, "another secret"); err != ErrVerificationNotFound{
+		t.Errorf("Expected ErrVerificationNotFound for a reused reset token, got %v", err)
+	}
+}
+
+func TestLikeEscaper(t *testing.T){
+	cases := map[string]string{
+		"reader":	"reader",
+		"a_b@x":	`a\_b@x`,
+		"100%":		`100\%`,
+		`back\slash`:	`back\\slash`,
+	}
+	for search, expected := range cases{
+		if got := likeEscaper.Replace(search); got != expected{
+			t.Errorf("%q: expected %q but got %q", search, expected, got)
+		}
+	}
+}
+
+func TestListUsersMatchesSearchLiterally(t *testing.T){
+	repo, _ := setupTestUsers(t)
+	ctx := context.Background()
+	createTestUser(t, repo, "a_b@example.com", "my password")
+	createTestUser(t, repo, "axb@example.com", "my password")
+
+	users, total, err := repo.ListUsers(ctx, "a_b@", 10, 0)
+	if err != nil{
+		t.Fatalf("ListUsers() failed: %v", err)
+	}
+	if total != 1 || len(users) != 1 || users[0].Email != "a_b@example.com"{
+		t.Errorf("Expected only a_b@example.com to match, got %d: %v", total, users)
+	}
+
+	if _, total, _ := repo.ListUsers(ctx, "%", 10, 0); total != 0{
+		t.Errorf("Expected a literal %% to match nobody, got %d", total)
+	}
+}
@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"bookstore-api/model"
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+var ErrAPIKeyNotFound = errors.New("api key not found")
+var ErrAPIKeyPrefixTaken = errors.New("api key prefix already exists")
+
+type APIKeyRepository struct {
+	db *DB
+}
+
+func NewAPIKeyRepository(db *DB) *APIKeyRepository{
+	return &APIKeyRepository{db: db}
+}
+
+const apiKeyColumns = `id, user_id, name, prefix, key_hash, scopes, created_at, last_used_at, expires_at, revoked_at`
+
+func scanAPIKey(row rowScanner) (model.APIKey, error){
+	var key model.APIKey
+	var scopes string
+	err := row.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &key.KeyHash, &scopes, &key.CreatedAt, &key.LastUsedAt, &key.ExpiresAt, &key.RevokedAt)
+	if err != nil{
+		if err == sql.ErrNoRows{
+			return key, ErrAPIKeyNotFound
+		}
+		return key, err
+	}
+	// Scopes are stored space separated, like an OAuth scope parameter
+	key.Scopes = strings.Fields(scopes)
+	return key, nil
+}
+
+// CreateAPIKey stores a new key and fills in its ID and creation time. It
+// returns ErrAPIKeyPrefixTaken when another key has the same random prefix.
+func (r *APIKeyRepository) CreateAPIKey(ctx context.Context, key *model.APIKey) error{
+	ctx, done := r.db.startQuery(ctx, "APIKeyRepository", "CreateAPIKey")
+	defer done()
+
+	query := `INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at`
+	err := r.db.QueryRowContext(ctx, query, key.UserID, key.Name, key.Prefix, key.KeyHash, strings.Join(key.Scopes, " "), key.ExpiresAt).Scan(&key.ID, &key.CreatedAt)
+	if err != nil && strings.Contains(err.Error(), `unique constraint "api_keys_prefix_key"`){
+		return ErrAPIKeyPrefixTaken
+	}
+	return err
+}
+
+// GetAPIKeyByPrefix looks up a key by the public part of the key string
+func (r *APIKeyRepository) GetAPIKeyByPrefix(ctx context.Context, prefix string) (model.APIKey, error){
+	ctx, done := r.db.startQuery(ctx, "APIKeyRepository", "GetAPIKeyByPrefix")
+	defer done()
+
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE prefix = $1`
+	return scanAPIKey(r.db.QueryRowContext(ctx, query, prefix))
+}
+
+// ListAPIKeys returns every key of a user, including revoked and expired ones
+func (r *APIKeyRepository) ListAPIKeys(ctx context.Context, userID int64) ([]model.APIKey, error){
+	ctx, done := r.db.startQuery(ctx, "APIKeyRepository", "ListAPIKeys")
+	defer done()
+
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE user_id = $1 ORDER BY id`
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil{
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make([]model.APIKey, 0)
+	for rows.Next(){
+		key, err := scanAPIKey(rows)
+		if err != nil{
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// RevokeAPIKey revokes a key owned by the user
+func (r *APIKeyRepository) RevokeAPIKey(ctx context.Context, userID int64, keyID int64) error{
+	ctx, done := r.db.startQuery(ctx, "APIKeyRepository", "RevokeAPIKey")
+	defer done()
+
+	query := `UPDATE api_keys SET revoked_at = NOW() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`
+
+	result, err := r.db.ExecContext(ctx, query, keyID, userID)
+	if err != nil{
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil{
+		return err
+	}
+
+	if rowsAffected == 0{
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// TouchAPIKey records that a key was used. Updates are limited to once a
+// minute so busy integrations do not write on every request.
+func (r *APIKeyRepository) TouchAPIKey(ctx context.Context, keyID int64, usedAt time.Time) error{
+	ctx, done := r.db.startQuery(ctx, "APIKeyRepository", "TouchAPIKey")
+	defer done()
+
+	query := `UPDATE api_keys SET last_used_at = $1
+		WHERE id = $2 AND (last_used_at IS NULL OR last_used_at < $1 - INTERVAL '1 minute')`
+	_, err := r.db.ExecContext(ctx, query, usedAt, keyID)
+	return err
+}
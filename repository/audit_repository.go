@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"bookstore-api/model"
+	"context"
+	"encoding/json"
+)
+
+type AuditRepository struct {
+	db *DB
+}
+
+func NewAuditRepository(db *DB) *AuditRepository{
+	return &AuditRepository{db: db}
+}
+
+// Record appends an entry to the audit log
+func (r *AuditRepository) Record(ctx context.Context, entry model.AuditEntry) error{
+	ctx, done := r.db.startQuery(ctx, "AuditRepository", "Record")
+	defer done()
+
+	var details []byte
+	if entry.Details != nil{
+		var err error
+		details, err = json.Marshal(entry.Details)
+		if err != nil{
+			return err
+		}
+	}
+
+	query := `INSERT INTO audit_log (actor_id, action, target_user_id, details) VALUES ($1, $2, $3, $4)`
+	_, err := r.db.ExecContext(ctx, query, entry.ActorID, entry.Action, entry.TargetUserID, details)
+	return err
+}
+
+// ListByTargetUser returns the audit entries about a user, newest first
+func (r *AuditRepository) ListByTargetUser(ctx context.Context, userID int64, limit int) ([]model.AuditEntry, error){
+	ctx, done := r.db.startQuery(ctx, "AuditRepository", "ListByTargetUser")
+	defer done()
+
+	query := `SELECT id, COALESCE(actor_id, 0), action, COALESCE(target_user_id, 0), details, created_at
+		FROM audit_log WHERE target_user_id = $1 ORDER BY id DESC LIMIT $2`
+	rows, err := r.db.QueryContext(ctx, query, userID, limit)
+	if err != nil{
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make([]model.AuditEntry, 0)
+	for rows.Next(){
+		var entry model.AuditEntry
+		var details []byte
+		if err := rows.Scan(&entry.ID, &entry.ActorID, &entry.Action, &entry.TargetUserID, &details, &entry.CreatedAt); err != nil{
+			return nil, err
+		}
+		if details != nil{
+			if err := json.Unmarshal(details, &entry.Details); err != nil{
+				return nil, err
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
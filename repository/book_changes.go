@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// bookChangesChannel is notified by the books_notify_change trigger with the ID
+// of every updated or deleted book
+const bookChangesChannel = "book_changes"
+
+// ListenBookChanges calls changed with the ID of every book updated or deleted
+// by anyone, using Postgres LISTEN/NOTIFY on a connection of its own.
+// listening is called once notifications are being received. Notifications
+// sent while no connection listens are lost, so callers that reconnect after
+// an error should assume anything changed in between.
+//
+// It blocks until ctx is cancelled or the connection fails.
+func ListenBookChanges(ctx context.Context, databaseURL string, listening func(), changed func(id int)) error{
+	conn, err := pgx.Connect(ctx, databaseURL)
+	if err != nil{
+		return err
+	}
+	defer conn.Close(context.WithoutCancel(ctx))
+
+	if _, err := conn.Exec(ctx, "LISTEN " + bookChangesChannel); err != nil{
+		return err
+	}
+	listening()
+
+	for{
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil{
+			return err
+		}
+		id, err := strconv.Atoi(notification.Payload)
+		if err != nil{
+			return fmt.Errorf("unexpected %s payload %q", bookChangesChannel, notification.Payload)
+		}
+		changed(id)
+	}
+}
@@ -2,38 +2,72 @@ package repository
 
 import (
 	"bookstore-api/model"
+	"bookstore-api/outbox"
+	"context"
 	"database/sql"
 	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
 )
 
 var ErrBookNotFound = errors.New("book not found")
 
+// BookStore is the set of book operations the handlers depend on, so they can
+// be served by BookRepository or a test double
+type BookStore interface {
+	CreateBook(ctx context.Context, book model.Book) (model.Book, error)
+	GetBooks(ctx context.Context) ([]model.Book, error)
+	GetBookByID(ctx context.Context, id int) (model.Book, error)
+	UpdateBook(ctx context.Context, id int, book model.Book) (model.Book, error)
+	DeleteBook(ctx context.Context, id int) error
+	// BooksModifiedAt is the last time a book was created, updated or deleted
+	BooksModifiedAt(ctx context.Context) (time.Time, error)
+}
+
 type BookRepository struct {
-	db *sql.DB 
+	db *DB
 }
 
-func NewBookRepository(db *sql.DB) *BookRepository{
+func NewBookRepository(db *DB) *BookRepository{
 	return &BookRepository{db: db}
 }
 
-func (r *BookRepository) CreateBook(book model.Book) (int, error){
-	var bookID int
-
-	query := `INSERT INTO books (title, author, description) VALUES ($1, $2, $3) RETURNING id`
-
-	err := r.db.QueryRow(query, book.Title, book.Author, book.Description).Scan(&bookID)
+const bookColumns = `id, title, author, description, created_at, updated_at`
+
+// The book statements are shared with PgxBookRepository
+const (
+	insertBookQuery = `INSERT INTO books (title, author, description) VALUES ($1, $2, $3) RETURNING ` + bookColumns
+	selectBooksQuery = `SELECT ` + bookColumns + ` FROM books ORDER BY id`
+	selectBookQuery = `SELECT ` + bookColumns + ` FROM books WHERE id = $1`
+	updateBookQuery = `UPDATE books SET title = $1, author = $2, description = $3, updated_at = clock_timestamp()
+		WHERE id = $4 RETURNING ` + bookColumns
+	deleteBookQuery = `DELETE FROM books WHERE id = $1 RETURNING ` + bookColumns
+	booksModifiedAtQuery = `SELECT modified_at FROM book_catalog`
+)
 
-	if(err != nil){
-		return 0, err
+func scanBook(row rowScanner) (model.Book, error){
+	var book model.Book
+	err := row.Scan(&book.ID, &book.Title, &book.Author, &book.Description, &book.CreatedAt, &book.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) || errors.Is(err, pgx.ErrNoRows){
+		return book, ErrBookNotFound
 	}
+	return book, err
+}
+
+// CreateBook stores a new book and returns it with its ID and timestamps
+func (r *BookRepository) CreateBook(ctx context.Context, book model.Book) (model.Book, error){
+	ctx, done := r.db.startQuery(ctx, "BookRepository", "CreateBook")
+	defer done()
 
-	return bookID, nil
+	return r.writeBook(ctx, outbox.BookCreated, insertBookQuery, book.Title, book.Author, book.Description)
 }
 
-func (r *BookRepository) GetBooks() ([]model.Book, error){
+func (r *BookRepository) GetBooks(ctx context.Context) ([]model.Book, error){
+	ctx, done := r.db.startQuery(ctx, "BookRepository", "GetBooks")
+	defer done()
 
-	query := `SELECT * FROM books`
-	rows, err := r.db.Query(query)
+	rows, err := r.db.QueryContext(ctx, selectBooksQuery)
 	if err != nil{
 		return nil, err
 	}
@@ -43,71 +77,70 @@ func (r *BookRepository) GetBooks() ([]model.Book, error){
 	books := make([]model.Book, 0)
 
 	for rows.Next(){
-		var book model.Book
-
-		if err := rows.Scan(&book.ID, &book.Title, &book.Author, &book.Description); err != nil{
+		book, err := scanBook(rows)
+		if err != nil{
 			return nil, err
 		}
 
 		books = append(books, book)
 	}
-	return books, nil
+	return books, rows.Err()
 }
 
-func (r *BookRepository) GetBookByID(id int) (model.Book, error){
-	var book model.Book
+func (r *BookRepository) GetBookByID(ctx context.Context, id int) (model.Book, error){
+	ctx, done := r.db.startQuery(ctx, "BookRepository", "GetBookByID")
+	defer done()
 
-	query := `SELECT * FROM books WHERE id = $1`
+	return scanBook(r.db.QueryRowContext(ctx, selectBookQuery, id))
+}
 
-	err := r.db.QueryRow(query, id).Scan(&book.ID, &book.Title, &book.Author, &book.Description)
-	if(err != nil){
-		if err == sql.ErrNoRows{
-			return book, ErrBookNotFound
-		}
-		return book, err
-	}
+// UpdateBook replaces the fields of a book and returns it with its new updated_at
+func (r *BookRepository) UpdateBook(ctx context.Context, id int, book model.Book) (model.Book, error){
+	ctx, done := r.db.startQuery(ctx, "BookRepository", "UpdateBook")
+	defer done()
 
-	return book, nil
+	return r.writeBook(ctx, outbox.BookUpdated, updateBookQuery, book.Title, book.Author, book.Description, id)
 }
 
-func (r *BookRepository) UpdateBook(id int, book model.Book) error{
-	query := `UPDATE books SET title = $1, author = $2, description = $3 WHERE id = $4`
+func (r *BookRepository) DeleteBook(ctx context.Context, id int) error{
+	ctx, done := r.db.startQuery(ctx, "BookRepository", "DeleteBook")
+	defer done()
 
-	result, err := r.db.Exec(query, book.Title, book.Author, book.Description, id)
+	_, err := r.writeBook(ctx, outbox.BookDeleted, deleteBookQuery, id)
+	return err
+}
 
+// writeBook runs a statement returning the changed book and records the
+// change as eventType in the outbox, in one transaction, so an event exists
+// exactly when the change was committed
+func (r *BookRepository) writeBook(ctx context.Context, eventType, query string, args ...any) (model.Book, error){
+	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil{
-		return err
+		return model.Book{}, err
 	}
+	defer tx.Rollback()
 
-	rowsAffected, err := result.RowsAffected()
-
+	book, err := scanBook(tx.QueryRowContext(ctx, query, args...))
 	if err != nil{
-		return err
-	}
-
-	if rowsAffected == 0{
-		return ErrBookNotFound
+		return model.Book{}, err
 	}
-
-	return nil
-}
-
-func (r *BookRepository) DeleteBook(id int) error{
-	query := `DELETE FROM books WHERE id = $1`
-
-	result, err := r.db.Exec(query, id)
+	eventArgs, err := bookEventArgs(eventType, book)
 	if err != nil{
-		return err
+		return model.Book{}, err
 	}
-
-	rowsAffected, err := result.RowsAffected()
-	if err != nil{
-		return err
+	if _, err := tx.ExecContext(ctx, insertOutboxEventQuery, eventArgs...); err != nil{
+		return model.Book{}, err
 	}
+	return book, tx.Commit()
+}
 
-	if rowsAffected == 0{
-		return ErrBookNotFound
-	}
+// BooksModifiedAt reads the time kept up to date by the books_touch_catalog
+// trigger, which unlike the newest updated_at also moves on deletes
+func (r *BookRepository) BooksModifiedAt(ctx context.Context) (time.Time, error){
+	ctx, done := r.db.startQuery(ctx, "BookRepository", "BooksModifiedAt")
+	defer done()
 
-	return nil
-}
\ No newline at end of file
+	var modifiedAt time.Time
+	err := r.db.QueryRowContext(ctx, booksModifiedAtQuery).Scan(&modifiedAt)
+	return modifiedAt, err
+}
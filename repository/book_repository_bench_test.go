@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"bookstore-api/config"
+	"bookstore-api/model"
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+)
+
+// benchmarkBooks is the number of books GetBooks returns in the benchmarks
+const benchmarkBooks = 100
+
+// setupBenchmarkStores seeds the test database and returns the same books
+// through database/sql and through a pgx pool, both with the default settings
+// of the API. Run with: go test ./repository -run '^$' -bench . -benchmem
+func setupBenchmarkStores(b *testing.B) (map[string]BookStore, int){
+	db, err := sql.Open("pgx", testDatabaseURL)
+	if err != nil || db.Ping() != nil{
+		b.Skip("The benchmarks need the test database")
+	}
+	db.Close()
+
+	cfg := config.Default().Database
+	cfg.URL = testDatabaseURL
+	sqlDB, err := OpenDB(cfg)
+	if err != nil{
+		b.Fatalf("OpenDB() failed: %v", err)
+	}
+	b.Cleanup(func(){ sqlDB.Close() })
+	pool := setupTestPool(b)
+	b.Cleanup(pool.Close)
+
+	stdlibStore := NewBookRepository(sqlDB)
+	var id int
+	for i := range benchmarkBooks{
+		book, err := stdlibStore.CreateBook(context.Background(), model.Book{
+			Title: fmt.Sprintf("Book %d", i),
+			Author: "Benchmark Author",
+			Description: "A book to benchmark the repositories with",
+		})
+		if err != nil{
+			b.Fatalf("CreateBook() failed: %v", err)
+		}
+		id = book.ID
+	}
+
+	return map[string]BookStore{
+		"database/sql": stdlibStore,
+		"pgxpool": NewPgxBookRepository(pool),
+	}, id
+}
+
+func BenchmarkGetBooks(b *testing.B){
+	stores, _ := setupBenchmarkStores(b)
+	for _, name := range []string{"database/sql", "pgxpool"}{
+		b.Run(name, func(b *testing.B){
+			ctx := context.Background()
+			for b.Loop(){
+				if _, err := stores[name].GetBooks(ctx); err != nil{
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkGetBookByID(b *testing.B){
+	stores, id := setupBenchmarkStores(b)
+	for _, name := range []string{"database/sql", "pgxpool"}{
+		b.Run(name, func(b *testing.B){
+			ctx := context.Background()
+			b.RunParallel(func(pb *testing.PB){
+				for pb.Next(){
+					if _, err := stores[name].GetBookByID(ctx, id); err != nil{
+						b.Fatal(err)
+					}
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"bookstore-api/cache"
+	"bookstore-api/model"
+	"context"
+	"strconv"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// CacheObserver receives the result of every cache lookup, for example to
+// export hit rates
+type CacheObserver interface {
+	ObserveCacheLookup(cache string, hit bool)
+}
+
+// CachedBookStore serves GetBookByID from an in-process LRU cache in front of
+// another BookStore. Concurrent misses for the same book share one query.
+// Books updated or deleted through this store are dropped right away; changes
+// made elsewhere are seen once the entry expires, or sooner when Invalidate is
+// fed from ListenBookChanges.
+//
+// Misses are loaded with ReadFromPrimary, so a book cached after Invalidate is
+// never older than the change that invalidated it, even in front of a
+// ReplicatedBookStore with lagging replicas. Reads marked with ReadFromPrimary
+// bypass the cache and go to the primary on their own.
+type CachedBookStore struct {
+	BookStore
+	books		*cache.LRU[int, model.Book]
+	loads		singleflight.Group
+	observer	CacheObserver
+}
+
+// NewCachedBookStore caches up to size books of store for ttl each. observer may be nil.
+func NewCachedBookStore(store BookStore, size int, ttl time.Duration, observer CacheObserver) *CachedBookStore{
+	return &CachedBookStore{BookStore: store, books: cache.New[int, model.Book](size, ttl), observer: observer}
+}
+
+func (s *CachedBookStore) GetBookByID(ctx context.Context, id int) (model.Book, error){
+	// The cache may miss a change made through another instance, which the
+	// caller must see
+	if readsFromPrimary(ctx){
+		return s.BookStore.GetBookByID(ctx, id)
+	}
+
+	if book, ok := s.books.Get(id); ok{
+		s.observe(true)
+		return book, nil
+	}
+	s.observe(false)
+
+	// The shared query must not fail for everyone when the caller that started
+	// it goes away, so it only keeps the caller's values. The query timeout
+	// still bounds it.
+	loadCtx := ReadFromPrimary(context.WithoutCancel(ctx))
+	result := s.loads.DoChan(strconv.Itoa(id), func() (any, error){
+		generation := s.books.Generation()
+		book, err := s.BookStore.GetBookByID(loadCtx, id)
+		if err == nil{
+			s.books.AddIfGeneration(id, book, generation)
+		}
+		return book, err
+	})
+
+	select{
+	case <-ctx.Done():
+		return model.Book{}, ctx.Err()
+	case loaded := <-result:
+		return loaded.Val.(model.Book), loaded.Err
+	}
+}
+
+func (s *CachedBookStore) UpdateBook(ctx context.Context, id int, book model.Book) (model.Book, error){
+	// Even a failed update may have been committed
+	defer s.Invalidate(id)
+	return s.BookStore.UpdateBook(ctx, id, book)
+}
+
+func (s *CachedBookStore) DeleteBook(ctx context.Context, id int) error{
+	defer s.Invalidate(id)
+	return s.BookStore.DeleteBook(ctx, id)
+}
+
+// Invalidate drops the cached book. A lookup of the book already in flight is
+// not shared with later callers and does not store its result.
+func (s *CachedBookStore) Invalidate(id int){
+	s.books.Remove(id)
+	s.loads.Forget(strconv.Itoa(id))
+}
+
+// Purge drops every cached book, e.g. after changes may have been missed
+func (s *CachedBookStore) Purge(){
+	s.books.Purge()
+}
+
+func (s *CachedBookStore) observe(hit bool){
+	if s.observer != nil{
+		s.observer.ObserveCacheLookup("books", hit)
+	}
+}
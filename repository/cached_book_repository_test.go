@@ -0,0 +1,184 @@
+package repository
+
+import (
+	"bookstore-api/model"
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingBooks is a BookStore holding one book that counts its lookups. A
+// lookup blocks while release is set and not yet closed.
+type countingBooks struct {
+	BookStore
+	lookups	atomic.Int32
+	title	atomic.Value
+	release	chan struct{}
+}
+
+func newCountingBooks(title string) *countingBooks{
+	books := &countingBooks{}
+	books.title.Store(title)
+	return books
+}
+
+func (b *countingBooks) GetBookByID(ctx context.Context, id int) (model.Book, error){
+	b.lookups.Add(1)
+	title := b.title.Load().(string)
+	if b.release != nil{
+		<-b.release
+	}
+	if id != 1{
+		return model.Book{}, ErrBookNotFound
+	}
+	return model.Book{ID: 1, Title: title}, nil
+}
+
+func (b *countingBooks) UpdateBook(ctx context.Context, id int, book model.Book) (model.Book, error){
+	b.title.Store(book.Title)
+	book.ID = id
+	return book, nil
+}
+
+type countingObserver struct {
+	hits, misses atomic.Int32
+}
+
+func (o *countingObserver) ObserveCacheLookup(cache string, hit bool){
+	if hit{
+		o.hits.Add(1)
+	} else {
+		o.misses.Add(1)
+	}
+}
+
+func TestCachedBookStoreServesRepeatedLookups(t *testing.T){
+	books := newCountingBooks("Dune")
+	observer := &countingObserver{}
+	cached := NewCachedBookStore(books, 10, time.Minute, observer)
+
+	for range 3{
+		book, err := cached.GetBookByID(context.Background(), 1)
+		if err != nil || book.Title != "Dune"{
+			t.Fatalf("GetBookByID() = %+v, %v", book, err)
+		}
+	}
+	if books.lookups.Load() != 1{
+		t.Errorf("Expected 1 query but got %d", books.lookups.Load())
+	}
+	if observer.hits.Load() != 2 || observer.misses.Load() != 1{
+		t.Errorf("Expected 2 hits and 1 miss but got %d and %d", observer.hits.Load(), observer.misses.Load())
+	}
+
+	// Missing books are not cached
+	for range 2{
+		if _, err := cached.GetBookByID(context.Background(), 2); err != ErrBookNotFound{
+			t.Fatalf("Expected ErrBookNotFound but got %v", err)
+		}
+	}
+	if books.lookups.Load() != 3{
+		t.Errorf("Expected every lookup of a missing book to query but got %d queries", books.lookups.Load())
+	}
+}
+
+func TestCachedBookStoreCollapsesConcurrentMisses(t *testing.T){
+	books := newCountingBooks("Dune")
+	books.release = make(chan struct{})
+	cached := NewCachedBookStore(books, 10, time.Minute, nil)
+
+	var wg sync.WaitGroup
+	for range 10{
+		wg.Add(1)
+		go func(){
+			defer wg.Done()
+			if book, err := cached.GetBookByID(context.Background(), 1); err != nil || book.Title != "Dune"{
+				t.Errorf("GetBookByID() = %+v, %v", book, err)
+			}
+		}()
+	}
+	// Give every goroutine time to join the query before it returns
+	time.Sleep(50 * time.Millisecond)
+	close(books.release)
+	wg.Wait()
+
+	if books.lookups.Load() != 1{
+		t.Errorf("Expected concurrent misses to share 1 query but got %d", books.lookups.Load())
+	}
+}
+
+func TestCachedBookStoreInvalidatesChangedBooks(t *testing.T){
+	books := newCountingBooks("Dune")
+	cached := NewCachedBookStore(books, 10, time.Minute, nil)
+	cached.GetBookByID(context.Background(), 1)
+
+	if _, err := cached.UpdateBook(context.Background(), 1, model.Book{Title: "Dune Messiah"}); err != nil{
+		t.Fatalf("UpdateBook() failed: %v", err)
+	}
+	if book, _ := cached.GetBookByID(context.Background(), 1); book.Title != "Dune Messiah"{
+		t.Errorf("Expected the updated title but got %q", book.Title)
+	}
+
+	// A change another instance reports while the old version is being loaded
+	books.release = make(chan struct{})
+	cached.Invalidate(1)
+	loaded := make(chan model.Book)
+	go func(){
+		book, _ := cached.GetBookByID(context.Background(), 1)
+		loaded <- book
+	}()
+	time.Sleep(10 * time.Millisecond)
+	books.title.Store("Children of Dune")
+	cached.Invalidate(1)
+	close(books.release)
+	<-loaded
+
+	if book, _ := cached.GetBookByID(context.Background(), 1); book.Title != "Children of Dune"{
+		t.Errorf("Expected the stale load to be discarded but got %q", book.Title)
+	}
+}
+
+func TestCachedBookStoreStopsWaitingWhenCallerGivesUp(t *testing.T){
+	books := newCountingBooks("Dune")
+	books.release = make(chan struct{})
+	defer close(books.release)
+	cached := NewCachedBookStore(books, 10, time.Minute, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10 * time.Millisecond)
+	defer cancel()
+	if _, err := cached.GetBookByID(ctx, 1); err != context.DeadlineExceeded{
+		t.Errorf("Expected the caller's deadline but got %v", err)
+	}
+}
+
+func TestCachedBookStoreLoadsFromPrimary(t *testing.T){
+	primary := &namedBooks{name: "Dune"}
+	replica, _ := stubReplica("stale copy", 0, nil)
+	replicated := NewReplicatedBookStore(primary, 0, replica)
+	replicated.CheckReplicas(context.Background())
+	cached := NewCachedBookStore(replicated, 10, time.Minute, nil)
+
+	if got := readFrom(t, replicated, context.Background()); got != "stale copy"{
+		t.Fatalf("Expected uncached reads to go to the replica but got %s", got)
+	}
+
+	book, _ := cached.GetBookByID(context.Background(), 1)
+	if book.Title != "Dune"{
+		t.Errorf("Expected a miss to load from the primary but got %q", book.Title)
+	}
+
+	// A change made through another instance
+	primary.name = "Dune Messiah"
+	if book, _ := cached.GetBookByID(context.Background(), 1); book.Title != "Dune"{
+		t.Errorf("Expected the cached title but got %q", book.Title)
+	}
+	if book, _ := cached.GetBookByID(ReadFromPrimary(context.Background()), 1); book.Title != "Dune Messiah"{
+		t.Errorf("Expected a read-your-writes read to bypass the cache but got %q", book.Title)
+	}
+
+	cached.Invalidate(1)
+	if book, _ := cached.GetBookByID(context.Background(), 1); book.Title != "Dune Messiah"{
+		t.Errorf("Expected the miss after Invalidate to load from the primary but got %q", book.Title)
+	}
+}
@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"bookstore-api/config"
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DB is the connection pool shared by the repositories. Every repository call
+// is bounded by the query timeout in addition to the caller's context, so a
+// slow query cannot hold a connection indefinitely.
+type DB struct {
+	*sql.DB
+	instrumentation
+}
+
+// instrumentation times, traces and bounds repository calls. It is shared by
+// DB and Pool so both report the same spans and metrics.
+type instrumentation struct {
+	queryTimeout time.Duration
+	observer     QueryObserver
+	tracer       trace.Tracer
+}
+
+// QueryObserver receives the duration of every repository call, for example to
+// export per-method latency
+type QueryObserver interface {
+	ObserveQuery(repository, method string, duration time.Duration)
+}
+
+// NewDB wraps an open pool. A zero queryTimeout only applies the caller's context.
+func NewDB(db *sql.DB, queryTimeout time.Duration) *DB{
+	return &DB{DB: db, instrumentation: instrumentation{queryTimeout: queryTimeout, tracer: newTracer()}}
+}
+
+// OpenDB connects to Postgres with the configured pool limits and checks the
+// connection within the connect timeout
+func OpenDB(cfg config.Database) (*DB, error){
+	db, err := newSQLDB(cfg)
+	if err != nil{
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ConnectTimeout.Duration)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil{
+		db.Close()
+		return nil, err
+	}
+	return NewDB(db, cfg.QueryTimeout.Duration), nil
+}
+
+// newSQLDB sets up a database/sql pool without connecting yet
+func newSQLDB(cfg config.Database) (*sql.DB, error){
+	connConfig, err := pgx.ParseConfig(cfg.URL)
+	if err != nil{
+		return nil, err
+	}
+	useStatementCache(connConfig, cfg.StatementCacheSize)
+	db := stdlib.OpenDB(*connConfig)
+
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime.Duration)
+	db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime.Duration)
+	return db, nil
+}
+
+// useStatementCache keeps up to size prepared statements per connection.
+// Cached statements are prepared once and then only executed; with a size of
+// 0 every query is sent unprepared, which also works behind PgBouncer in
+// transaction pooling mode.
+func useStatementCache(connConfig *pgx.ConnConfig, size int){
+	connConfig.StatementCacheCapacity = size
+	if size == 0{
+		connConfig.DefaultQueryExecMode = pgx.QueryExecModeExec
+	}
+}
+
+// ObserveQueries reports the duration of every repository call to observer
+func (i *instrumentation) ObserveQueries(observer QueryObserver){
+	i.observer = observer
+}
+
+// startQuery derives the context for one repository call and opens its span.
+// The returned func must be deferred so rows and transactions are released,
+// the span ends and the call's duration is reported when it returns.
+func (i *instrumentation) startQuery(ctx context.Context, repository, method string) (context.Context, func()){
+	start := time.Now()
+	ctx, span := i.startMethodSpan(ctx, repository, method)
+	var cancel context.CancelFunc
+	if i.queryTimeout > 0{
+		ctx, cancel = context.WithTimeout(ctx, i.queryTimeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	return ctx, func(){
+		cancel()
+		span.End()
+		if i.observer != nil{
+			i.observer.ObserveQuery(repository, method, time.Since(start))
+		}
+	}
+}
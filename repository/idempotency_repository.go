@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"bookstore-api/model"
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type IdempotencyRepository struct {
+	db *DB
+}
+
+func NewIdempotencyRepository(db *DB) *IdempotencyRepository{
+	return &IdempotencyRepository{db: db}
+}
+
+// ReserveIdempotencyKey claims the key for a new request. It returns true when
+// the caller owns the key and must complete or release it. Otherwise it returns
+// the record of the earlier request, which may still be in flight. The claim is
+// a single INSERT, so of several concurrent requests with the same key exactly
+// one wins. An expired record, or one whose request is still not complete
+// after its LockedUntil, is taken over as if it did not exist.
+func (r *IdempotencyRepository) ReserveIdempotencyKey(ctx context.Context, record model.IdempotencyRecord) (model.IdempotencyRecord, bool, error){
+	ctx, done := r.db.startQuery(ctx, "IdempotencyRepository", "ReserveIdempotencyKey")
+	defer done()
+
+	// Postgres keeps microseconds, and the claim is compared by value later
+	record.LockedUntil = record.LockedUntil.Truncate(time.Microsecond)
+
+	reserve := `INSERT INTO idempotency_keys (user_id, idempotency_key, fingerprint, expires_at, locked_until)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id, idempotency_key) DO UPDATE
+			SET fingerprint = EXCLUDED.fingerprint, status_code = NULL, content_type = NULL,
+				response_body = NULL, created_at = NOW(), expires_at = EXCLUDED.expires_at,
+				locked_until = EXCLUDED.locked_until
+			WHERE idempotency_keys.expires_at <= NOW()
+				OR (idempotency_keys.status_code IS NULL AND idempotency_keys.locked_until <= NOW())
+		RETURNING user_id`
+	lookup := `SELECT fingerprint, status_code, content_type, response_body, expires_at
+		FROM idempotency_keys WHERE user_id = $1 AND idempotency_key = $2`
+
+	// The earlier request may release the key between the two statements, in
+	// which case the reservation is simply tried again
+	for{
+		var userID int64
+		err := r.db.QueryRowContext(ctx, reserve, record.UserID, record.Key, record.Fingerprint, record.ExpiresAt, record.LockedUntil).Scan(&userID)
+		if err == nil{
+			return record, true, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows){
+			return model.IdempotencyRecord{}, false, err
+		}
+
+		existing := model.IdempotencyRecord{UserID: record.UserID, Key: record.Key}
+		var statusCode sql.NullInt64
+		var contentType sql.NullString
+		err = r.db.QueryRowContext(ctx, lookup, record.UserID, record.Key).Scan(&existing.Fingerprint, &statusCode, &contentType, &existing.Body, &existing.ExpiresAt)
+		if errors.Is(err, sql.ErrNoRows){
+			continue
+		}
+		if err != nil{
+			return model.IdempotencyRecord{}, false, err
+		}
+		existing.StatusCode = int(statusCode.Int64)
+		existing.ContentType = contentType.String
+		return existing, false, nil
+	}
+}
+
+// CompleteIdempotencyKey stores the response of the request that reserved the
+// key. A claim that was taken over meanwhile is left to the request that took it.
+func (r *IdempotencyRepository) CompleteIdempotencyKey(ctx context.Context, record model.IdempotencyRecord) error{
+	ctx, done := r.db.startQuery(ctx, "IdempotencyRepository", "CompleteIdempotencyKey")
+	defer done()
+
+	query := `UPDATE idempotency_keys SET status_code = $1, content_type = $2, response_body = $3
+		WHERE user_id = $4 AND idempotency_key = $5 AND fingerprint = $6 AND locked_until = $7 AND status_code IS NULL`
+	_, err := r.db.ExecContext(ctx, query, record.StatusCode, record.ContentType, record.Body, record.UserID, record.Key, record.Fingerprint, record.LockedUntil)
+	return err
+}
+
+// ReleaseIdempotencyKey forgets a reservation whose request failed, so the client can retry it
+func (r *IdempotencyRepository) ReleaseIdempotencyKey(ctx context.Context, record model.IdempotencyRecord) error{
+	ctx, done := r.db.startQuery(ctx, "IdempotencyRepository", "ReleaseIdempotencyKey")
+	defer done()
+
+	query := `DELETE FROM idempotency_keys
+		WHERE user_id = $1 AND idempotency_key = $2 AND fingerprint = $3 AND locked_until = $4 AND status_code IS NULL`
+	_, err := r.db.ExecContext(ctx, query, record.UserID, record.Key, record.Fingerprint, record.LockedUntil)
+	return err
+}
+
+// DeleteExpiredIdempotencyKeys removes the keys that expired before now and returns how many were removed
+func (r *IdempotencyRepository) DeleteExpiredIdempotencyKeys(ctx context.Context, now time.Time) (int64, error){
+	ctx, done := r.db.startQuery(ctx, "IdempotencyRepository", "DeleteExpiredIdempotencyKeys")
+	defer done()
+
+	result, err := r.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE expires_at <= $1`, now)
+	if err != nil{
+		return 0, err
+	}
+	return result.RowsAffected()
+}
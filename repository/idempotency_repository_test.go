@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"bookstore-api/model"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestAbandonedIdempotencyKeyIsTakenOver(t *testing.T){
+	users, db := setupTestUsers(t)
+	user := createTestUser(t, users, "script@example.com", "my password")
+	repo := NewIdempotencyRepository(db)
+	ctx := context.Background()
+
+	claim := func(lockedFor time.Duration) (model.IdempotencyRecord, bool){
+		record, reserved, err := repo.ReserveIdempotencyKey(ctx, model.IdempotencyRecord{
+			UserID: user.ID,
+			Key: "3f1c9e",
+			Fingerprint: "f1",
+			ExpiresAt: time.Now().Add(time.Hour),
+			LockedUntil: time.Now().Add(lockedFor),
+		})
+		if err != nil{
+			t.Fatalf("ReserveIdempotencyKey() failed: %v", err)
+		}
+		return record, reserved
+	}
+
+	abandoned, reserved := claim(-time.Second)
+	if !reserved{
+		t.Fatal("Expected the first request to reserve the key")
+	}
+	retry, reserved := claim(time.Minute)
+	if !reserved{
+		t.Fatal("Expected a retry to take over the key once its lock ran out")
+	}
+	if _, reserved := claim(time.Minute); reserved{
+		t.Error("Expected the key to stay locked while the retry is in flight")
+	}
+
+	// The abandoned request no longer owns the key
+	abandoned.StatusCode = 500
+	if err := repo.CompleteIdempotencyKey(ctx, abandoned); err != nil{
+		t.Fatalf("CompleteIdempotencyKey() failed: %v", err)
+	}
+	retry.StatusCode = 201
+	if err := repo.CompleteIdempotencyKey(ctx, retry); err != nil{
+		t.Fatalf("CompleteIdempotencyKey() failed: %v", err)
+	}
+	if stored, _ := claim(time.Minute); stored.StatusCode != 201{
+		t.Errorf("Expected the retry's response to be stored but got %d", stored.StatusCode)
+	}
+}
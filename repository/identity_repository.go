@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"bookstore-api/model"
+	"context"
+	"strings"
+)
+
+// unusablePasswordHash is stored for users provisioned from an identity
+// provider. It is not a valid bcrypt hash, so password login always fails.
+const unusablePasswordHash = "!"
+
+// GetUserByIdentity finds the user linked to an external identity
+func (r *UserRepository) GetUserByIdentity(ctx context.Context, issuer, subject string) (model.User, error){
+	ctx, done := r.db.startQuery(ctx, "UserRepository", "GetUserByIdentity")
+	defer done()
+
+	query := `SELECT ` + userColumns + ` FROM users
+		WHERE id = (SELECT user_id FROM user_identities WHERE issuer = $1 AND subject = $2)`
+	return scanUser(r.db.QueryRowContext(ctx, query, issuer, subject))
+}
+
+// LinkIdentity links an external identity to an existing user
+func (r *UserRepository) LinkIdentity(ctx context.Context, userID int64, issuer, subject string) error{
+	ctx, done := r.db.startQuery(ctx, "UserRepository", "LinkIdentity")
+	defer done()
+
+	query := `INSERT INTO user_identities (user_id, issuer, subject) VALUES ($1, $2, $3)`
+	_, err := r.db.ExecContext(ctx, query, userID, issuer, subject)
+	return err
+}
+
+// CreateUserWithIdentity provisions a user whose email was verified by the
+// identity provider and links the identity in the same transaction
+func (r *UserRepository) CreateUserWithIdentity(ctx context.Context, name, email, issuer, subject string) (model.User, error){
+	ctx, done := r.db.startQuery(ctx, "UserRepository", "CreateUserWithIdentity")
+	defer done()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil{
+		return model.User{}, err
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO users (name, email, password_hash, email_verified) VALUES ($1, $2, $3, TRUE) RETURNING ` + userColumns
+	user, err := scanUser(tx.QueryRowContext(ctx, query, name, email, unusablePasswordHash))
+	if err != nil{
+		if strings.Contains(err.Error(), "unique constraint"){
+			return model.User{}, ErrMailExists
+		}
+		return model.User{}, err
+	}
+
+	query = `INSERT INTO user_identities (user_id, issuer, subject) VALUES ($1, $2, $3)`
+	if _, err := tx.ExecContext(ctx, query, user.ID, issuer, subject); err != nil{
+		return model.User{}, err
+	}
+
+	if err := tx.Commit(); err != nil{
+		return model.User{}, err
+	}
+	return user, nil
+}
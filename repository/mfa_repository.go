@@ -0,0 +1,169 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrTOTPAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+var ErrTOTPNotEnrolled = errors.New("two-factor authentication enrollment not started")
+var ErrMFAChallengeUsed = errors.New("two-factor challenge was already used")
+
+// SetPendingTOTPSecret stores a new secret that becomes active once confirmed
+func (r *UserRepository) SetPendingTOTPSecret(ctx context.Context, userID int64, secret string) error{
+	ctx, done := r.db.startQuery(ctx, "UserRepository", "SetPendingTOTPSecret")
+	defer done()
+
+	query := `UPDATE users SET totp_secret = $1, totp_last_step = 0 WHERE id = $2 AND totp_enabled = FALSE`
+
+	result, err := r.db.ExecContext(ctx, query, secret, userID)
+	if err != nil{
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil{
+		return err
+	}
+
+	if rowsAffected == 0{
+		return ErrTOTPAlreadyEnabled
+	}
+	return nil
+}
+
+// EnableTOTP activates the pending secret and replaces the recovery codes in one transaction
+func (r *UserRepository) EnableTOTP(ctx context.Context, userID int64, step int64, recoveryCodeHashes []string) error{
+	ctx, done := r.db.startQuery(ctx, "UserRepository", "EnableTOTP")
+	defer done()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil{
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE users SET totp_enabled = TRUE, totp_last_step = $1
+		WHERE id = $2 AND totp_enabled = FALSE AND totp_secret IS NOT NULL`
+	result, err := tx.ExecContext(ctx, query, step, userID)
+	if err != nil{
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil{
+		return err
+	}
+	if rowsAffected == 0{
+		return ErrTOTPNotEnrolled
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_recovery_codes WHERE user_id = $1`, userID); err != nil{
+		return err
+	}
+
+	for _, hash := range recoveryCodeHashes{
+		_, err := tx.ExecContext(ctx, `INSERT INTO user_recovery_codes (user_id, code_hash) VALUES ($1, $2)`, userID, hash)
+		if err != nil{
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ConsumeTOTPStep records the time step of an accepted code. It returns false
+// when the same or a later step was already used, which blocks code replay.
+func (r *UserRepository) ConsumeTOTPStep(ctx context.Context, userID int64, step int64) (bool, error){
+	ctx, done := r.db.startQuery(ctx, "UserRepository", "ConsumeTOTPStep")
+	defer done()
+
+	query := `UPDATE users SET totp_last_step = $1 WHERE id = $2 AND totp_last_step < $1`
+
+	result, err := r.db.ExecContext(ctx, query, step, userID)
+	if err != nil{
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil{
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
+
+// ConsumeRecoveryCode marks an unused recovery code as used. It returns false
+// when the code does not exist or was already used.
+func (r *UserRepository) ConsumeRecoveryCode(ctx context.Context, userID int64, codeHash string) (bool, error){
+	ctx, done := r.db.startQuery(ctx, "UserRepository", "ConsumeRecoveryCode")
+	defer done()
+
+	query := `UPDATE user_recovery_codes SET used_at = NOW()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`
+
+	result, err := r.db.ExecContext(ctx, query, userID, codeHash)
+	if err != nil{
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil{
+		return false, err
+	}
+	return rowsAffected > 0, nil
+}
+
+// RecordMFAAttempt counts an attempt at a login challenge and returns how many
+// were made so far, this one included. It returns ErrMFAChallengeUsed once a
+// code was accepted for the challenge.
+func (r *UserRepository) RecordMFAAttempt(ctx context.Context, challengeID string, userID int64, expiresAt time.Time) (int, error){
+	ctx, done := r.db.startQuery(ctx, "UserRepository", "RecordMFAAttempt")
+	defer done()
+
+	query := `INSERT INTO mfa_challenges (id, user_id, attempts, expires_at) VALUES ($1, $2, 1, $3)
+		ON CONFLICT (id) DO UPDATE SET attempts = mfa_challenges.attempts + 1
+		RETURNING attempts, used_at IS NOT NULL`
+
+	var attempts int
+	var used bool
+	if err := r.db.QueryRowContext(ctx, query, challengeID, userID, expiresAt).Scan(&attempts, &used); err != nil{
+		return 0, err
+	}
+	if used{
+		return attempts, ErrMFAChallengeUsed
+	}
+	return attempts, nil
+}
+
+// ConsumeMFAChallenge marks a challenge as used. It returns false when a
+// concurrent request already used it.
+func (r *UserRepository) ConsumeMFAChallenge(ctx context.Context, challengeID string) (bool, error){
+	ctx, done := r.db.startQuery(ctx, "UserRepository", "ConsumeMFAChallenge")
+	defer done()
+
+	query := `UPDATE mfa_challenges SET used_at = NOW() WHERE id = $1 AND used_at IS NULL`
+
+	result, err := r.db.ExecContext(ctx, query, challengeID)
+	if err != nil{
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil{
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
+
+// DeleteExpiredMFAChallenges removes the challenges that expired before now and returns how many were removed
+func (r *UserRepository) DeleteExpiredMFAChallenges(ctx context.Context, now time.Time) (int64, error){
+	ctx, done := r.db.startQuery(ctx, "UserRepository", "DeleteExpiredMFAChallenges")
+	defer done()
+
+	result, err := r.db.ExecContext(ctx, `DELETE FROM mfa_challenges WHERE expires_at <= $1`, now)
+	if err != nil{
+		return 0, err
+	}
+	return result.RowsAffected()
+}
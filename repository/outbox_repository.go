@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"bookstore-api/model"
+	"bookstore-api/outbox"
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// insertOutboxEventQuery records a book change, run in the transaction of the change
+const insertOutboxEventQuery = `INSERT INTO outbox_events (book_id, event_type, payload) VALUES ($1, $2, $3)`
+
+// bookEventArgs are the arguments of insertOutboxEventQuery for a change of book
+func bookEventArgs(eventType string, book model.Book) ([]any, error){
+	payload, err := json.Marshal(book)
+	if err != nil{
+		return nil, err
+	}
+	return []any{book.ID, eventType, payload}, nil
+}
+
+// OutboxRepository is the outbox.Store of the events recorded by the book repositories
+type OutboxRepository struct {
+	db *DB
+}
+
+func NewOutboxRepository(db *DB) *OutboxRepository{
+	return &OutboxRepository{db: db}
+}
+
+// ClaimOutboxEvents moves the due events forward by lease, so no other
+// dispatcher claims them meanwhile, and counts the attempt. An event is only
+// due when every earlier event of its book was delivered. SKIP LOCKED lets
+// concurrent dispatchers claim different events instead of waiting.
+func (r *OutboxRepository) ClaimOutboxEvents(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]outbox.Event, error){
+	ctx, done := r.db.startQuery(ctx, "OutboxRepository", "ClaimOutboxEvents")
+	defer done()
+
+	query := `UPDATE outbox_events SET next_attempt_at = $2, attempts = attempts + 1
+		WHERE id IN (
+			SELECT id FROM outbox_events e
+			WHERE delivered_at IS NULL AND next_attempt_at <= $1
+				AND NOT EXISTS (
+					SELECT 1 FROM outbox_events earlier
+					WHERE earlier.book_id = e.book_id AND earlier.id < e.id AND earlier.delivered_at IS NULL
+				)
+			ORDER BY id
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, book_id, event_type, payload, created_at, attempts`
+	rows, err := r.db.QueryContext(ctx, query, now, now.Add(lease), limit)
+	if err != nil{
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []outbox.Event
+	for rows.Next(){
+		var event outbox.Event
+		var payload []byte
+		if err := rows.Scan(&event.ID, &event.BookID, &event.Type, &payload, &event.OccurredAt, &event.Attempt); err != nil{
+			return nil, err
+		}
+		event.Data = payload
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+func (r *OutboxRepository) MarkOutboxEventDelivered(ctx context.Context, id int64, now time.Time) error{
+	ctx, done := r.db.startQuery(ctx, "OutboxRepository", "MarkOutboxEventDelivered")
+	defer done()
+
+	_, err := r.db.ExecContext(ctx, `UPDATE outbox_events SET delivered_at = $2, last_error = NULL WHERE id = $1`, id, now)
+	return err
+}
+
+func (r *OutboxRepository) RescheduleOutboxEvent(ctx context.Context, id int64, next time.Time, lastError string) error{
+	ctx, done := r.db.startQuery(ctx, "OutboxRepository", "RescheduleOutboxEvent")
+	defer done()
+
+	_, err := r.db.ExecContext(ctx, `UPDATE outbox_events SET next_attempt_at = $2, last_error = $3 WHERE id = $1`, id, next, lastError)
+	return err
+}
+
+// DeleteDeliveredOutboxEvents drops events delivered before the given time
+func (r *OutboxRepository) DeleteDeliveredOutboxEvents(ctx context.Context, before time.Time) (int64, error){
+	ctx, done := r.db.startQuery(ctx, "OutboxRepository", "DeleteDeliveredOutboxEvents")
+	defer done()
+
+	result, err := r.db.ExecContext(ctx, `DELETE FROM outbox_events WHERE delivered_at < $1`, before)
+	if err != nil{
+		return 0, err
+	}
+	return result.RowsAffected()
+}
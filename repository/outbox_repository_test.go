@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"bookstore-api/model"
+	"bookstore-api/outbox"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestBookChangesAreRecordedInTheOutbox(t *testing.T){
+	db := setupTestDB(t)
+	defer db.Close()
+
+	books := NewBookRepository(NewDB(db, 0))
+	events := NewOutboxRepository(NewDB(db, 0))
+	ctx := context.Background()
+
+	created, err := books.CreateBook(ctx, model.Book{Title: "Dune", Author: "Frank Herbert"})
+	if err != nil{
+		t.Fatalf("CreateBook() failed: %v", err)
+	}
+	if _, err := books.UpdateBook(ctx, created.ID, model.Book{Title: "Dune Messiah", Author: "Frank Herbert"}); err != nil{
+		t.Fatalf("UpdateBook() failed: %v", err)
+	}
+	if err := books.DeleteBook(ctx, created.ID); err != nil{
+		t.Fatalf("DeleteBook() failed: %v", err)
+	}
+	if err := books.DeleteBook(ctx, created.ID); err != ErrBookNotFound{
+		t.Fatalf("Expected ErrBookNotFound for a second delete, got %v", err)
+	}
+
+	// Only the head of the book's events is claimable until it is delivered
+	expected := []string{outbox.BookCreated, outbox.BookUpdated, outbox.BookDeleted}
+	now := time.Now()
+	for _, eventType := range expected{
+		claimed, err := events.ClaimOutboxEvents(ctx, now, time.Minute, 10)
+		if err != nil{
+			t.Fatalf("ClaimOutboxEvents() failed: %v", err)
+		}
+		if len(claimed) != 1 || claimed[0].Type != eventType || claimed[0].BookID != created.ID{
+			t.Fatalf("Expected one %s event for book %d, got %+v", eventType, created.ID, claimed)
+		}
+		if claimed[0].Attempt != 1{
+			t.Errorf("Expected the first attempt, got %d", claimed[0].Attempt)
+		}
+		if err := events.MarkOutboxEventDelivered(ctx, claimed[0].ID, now); err != nil{
+			t.Fatalf("MarkOutboxEventDelivered() failed: %v", err)
+		}
+	}
+
+	deleted, err := events.DeleteDeliveredOutboxEvents(ctx, now.Add(time.Second))
+	if err != nil{
+		t.Fatalf("DeleteDeliveredOutboxEvents() failed: %v", err)
+	}
+	if deleted != 3{
+		t.Errorf("Expected 3 delivered events to be deleted, got %d", deleted)
+	}
+}
+
+func TestRescheduledOutboxEventsWaitForTheirTurn(t *testing.T){
+	db := setupTestDB(t)
+	defer db.Close()
+
+	books := NewBookRepository(NewDB(db, 0))
+	events := NewOutboxRepository(NewDB(db, 0))
+	ctx := context.Background()
+
+	if _, err := books.CreateBook(ctx, model.Book{Title: "Dune", Author: "Frank Herbert"}); err != nil{
+		t.Fatalf("CreateBook() failed: %v", err)
+	}
+	now := time.Now()
+	claimed, err := events.ClaimOutboxEvents(ctx, now, time.Minute, 10)
+	if err != nil || len(claimed) != 1{
+		t.Fatalf("Expected one claimed event, got %v (%v)", claimed, err)
+	}
+
+	// A claimed event is leased and not handed out again
+	if again, _ := events.ClaimOutboxEvents(ctx, now, time.Minute, 10); len(again) != 0{
+		t.Fatalf("Expected the leased event to be skipped, got %v", again)
+	}
+
+	if err := events.RescheduleOutboxEvent(ctx, claimed[0].ID, now.Add(time.Second), "connection refused"); err != nil{
+		t.Fatalf("RescheduleOutboxEvent() failed: %v", err)
+	}
+	retried, err := events.ClaimOutboxEvents(ctx, now.Add(2*time.Second), time.Minute, 10)
+	if err != nil || len(retried) != 1{
+		t.Fatalf("Expected the rescheduled event to be claimed again, got %v (%v)", retried, err)
+	}
+	if retried[0].Attempt != 2{
+		t.Errorf("Expected the second attempt, got %d", retried[0].Attempt)
+	}
+}
@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"bookstore-api/model"
+	"bookstore-api/outbox"
+	"context"
+	"time"
+)
+
+// PgxBookRepository is a BookStore on a native pgx Pool. It runs the same
+// statements as BookRepository, which pgx prepares once per connection.
+type PgxBookRepository struct {
+	pool *Pool
+}
+
+func NewPgxBookRepository(pool *Pool) *PgxBookRepository{
+	return &PgxBookRepository{pool: pool}
+}
+
+func (r *PgxBookRepository) CreateBook(ctx context.Context, book model.Book) (model.Book, error){
+	ctx, done := r.pool.startQuery(ctx, "PgxBookRepository", "CreateBook")
+	defer done()
+
+	return r.writeBook(ctx, outbox.BookCreated, insertBookQuery, book.Title, book.Author, book.Description)
+}
+
+func (r *PgxBookRepository) GetBooks(ctx context.Context) ([]model.Book, error){
+	ctx, done := r.pool.startQuery(ctx, "PgxBookRepository", "GetBooks")
+	defer done()
+
+	rows, err := r.pool.Query(ctx, selectBooksQuery)
+	if err != nil{
+		return nil, err
+	}
+	defer rows.Close()
+
+	books := make([]model.Book, 0)
+	for rows.Next(){
+		book, err := scanBook(rows)
+		if err != nil{
+			return nil, err
+		}
+		books = append(books, book)
+	}
+	return books, rows.Err()
+}
+
+func (r *PgxBookRepository) GetBookByID(ctx context.Context, id int) (model.Book, error){
+	ctx, done := r.pool.startQuery(ctx, "PgxBookRepository", "GetBookByID")
+	defer done()
+
+	return scanBook(r.pool.QueryRow(ctx, selectBookQuery, id))
+}
+
+func (r *PgxBookRepository) UpdateBook(ctx context.Context, id int, book model.Book) (model.Book, error){
+	ctx, done := r.pool.startQuery(ctx, "PgxBookRepository", "UpdateBook")
+	defer done()
+
+	return r.writeBook(ctx, outbox.BookUpdated, updateBookQuery, book.Title, book.Author, book.Description, id)
+}
+
+func (r *PgxBookRepository) DeleteBook(ctx context.Context, id int) error{
+	ctx, done := r.pool.startQuery(ctx, "PgxBookRepository", "DeleteBook")
+	defer done()
+
+	_, err := r.writeBook(ctx, outbox.BookDeleted, deleteBookQuery, id)
+	return err
+}
+
+// writeBook runs a statement returning the changed book and records the
+// change in the outbox in the same transaction, like BookRepository.writeBook
+func (r *PgxBookRepository) writeBook(ctx context.Context, eventType, query string, args ...any) (model.Book, error){
+	tx, err := r.pool.Begin(ctx)
+	if err != nil{
+		return model.Book{}, err
+	}
+	defer tx.Rollback(context.WithoutCancel(ctx))
+
+	book, err := scanBook(tx.QueryRow(ctx, query, args...))
+	if err != nil{
+		return model.Book{}, err
+	}
+	eventArgs, err := bookEventArgs(eventType, book)
+	if err != nil{
+		return model.Book{}, err
+	}
+	if _, err := tx.Exec(ctx, insertOutboxEventQuery, eventArgs...); err != nil{
+		return model.Book{}, err
+	}
+	return book, tx.Commit(ctx)
+}
+
+func (r *PgxBookRepository) BooksModifiedAt(ctx context.Context) (time.Time, error){
+	ctx, done := r.pool.startQuery(ctx, "PgxBookRepository", "BooksModifiedAt")
+	defer done()
+
+	var modifiedAt time.Time
+	err := r.pool.QueryRow(ctx, booksModifiedAtQuery).Scan(&modifiedAt)
+	return modifiedAt, err
+}
@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"bookstore-api/config"
+	"bookstore-api/model"
+	"context"
+	"testing"
+)
+
+func setupTestPool(t testing.TB) *Pool{
+	setupTestDB(t).Close()
+
+	cfg := config.Default().Database
+	cfg.URL = testDatabaseURL
+	pool, err := OpenPool(cfg)
+	if err != nil{
+		t.Fatalf("Failed to open the test pool: %v", err)
+	}
+	return pool
+}
+
+func TestPgxBookRepository(t *testing.T){
+	pool := setupTestPool(t)
+	defer pool.Close()
+	repo := NewPgxBookRepository(pool)
+	ctx := context.Background()
+
+	created, err := repo.CreateBook(ctx, model.Book{Title: "Dune", Author: "Frank Herbert"})
+	if err != nil{
+		t.Fatalf("CreateBook() failed: %v", err)
+	}
+
+	book, err := repo.GetBookByID(ctx, created.ID)
+	if err != nil || book.Title != "Dune"{
+		t.Fatalf("GetBookByID() = %+v, %v", book, err)
+	}
+
+	updated, err := repo.UpdateBook(ctx, created.ID, model.Book{Title: "Dune Messiah", Author: "Frank Herbert"})
+	if err != nil{
+		t.Fatalf("UpdateBook() failed: %v", err)
+	}
+	if !updated.UpdatedAt.After(created.UpdatedAt){
+		t.Errorf("Expected updated_at to advance from %s but got %s", created.UpdatedAt, updated.UpdatedAt)
+	}
+
+	books, err := repo.GetBooks(ctx)
+	if err != nil || len(books) != 1 || books[0].Title != "Dune Messiah"{
+		t.Fatalf("GetBooks() = %+v, %v", books, err)
+	}
+
+	if err := repo.DeleteBook(ctx, created.ID); err != nil{
+		t.Fatalf("DeleteBook() failed: %v", err)
+	}
+	if _, err := repo.GetBookByID(ctx, created.ID); err != ErrBookNotFound{
+		t.Errorf("Expected ErrBookNotFound after the delete but got %v", err)
+	}
+	if err := repo.DeleteBook(ctx, created.ID); err != ErrBookNotFound{
+		t.Errorf("Expected ErrBookNotFound for a second delete but got %v", err)
+	}
+}
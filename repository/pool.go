@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"bookstore-api/config"
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Pool is a native pgx connection pool. It skips the database/sql layer and
+// scans rows straight from the wire, and calls are timed, traced and bounded
+// by the query timeout just like on DB.
+type Pool struct {
+	*pgxpool.Pool
+	instrumentation
+}
+
+// OpenPool connects to Postgres with the configured pool limits and checks the
+// connection within the connect timeout
+func OpenPool(cfg config.Database) (*Pool, error){
+	pool, err := newPool(cfg)
+	if err != nil{
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ConnectTimeout.Duration)
+	defer cancel()
+	if err := pool.Ping(ctx); err != nil{
+		pool.Close()
+		return nil, err
+	}
+	return pool, nil
+}
+
+// newPool sets up a pool without waiting for a connection
+func newPool(cfg config.Database) (*Pool, error){
+	poolConfig, err := newPoolConfig(cfg)
+	if err != nil{
+		return nil, err
+	}
+	tracer := newTracer()
+	poolConfig.ConnConfig.Tracer = statementTracer{tracer: tracer}
+
+	pool, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
+	if err != nil{
+		return nil, err
+	}
+	return &Pool{Pool: pool, instrumentation: instrumentation{queryTimeout: cfg.QueryTimeout.Duration, tracer: tracer}}, nil
+}
+
+// newPoolConfig maps the database settings onto pgxpool. The idle connection
+// limit of database/sql has no pgxpool counterpart; MinConns is kept instead.
+func newPoolConfig(cfg config.Database) (*pgxpool.Config, error){
+	poolConfig, err := pgxpool.ParseConfig(cfg.URL)
+	if err != nil{
+		return nil, err
+	}
+	useStatementCache(poolConfig.ConnConfig, cfg.StatementCacheSize)
+	poolConfig.MaxConns = int32(cfg.MaxOpenConns)
+	poolConfig.MinConns = int32(cfg.MinConns)
+	poolConfig.MaxConnLifetime = cfg.ConnMaxLifetime.Duration
+	poolConfig.MaxConnIdleTime = cfg.ConnMaxIdleTime.Duration
+	poolConfig.HealthCheckPeriod = cfg.HealthCheckPeriod.Duration
+	return poolConfig, nil
+}
+
+// statementTracer opens a client span for every statement run on a Pool, the
+// counterpart of the traced ExecContext and QueryContext of DB
+type statementTracer struct {
+	tracer trace.Tracer
+}
+
+func (t statementTracer) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context{
+	ctx, _ = startStatementSpan(ctx, t.tracer, data.SQL)
+	return ctx
+}
+
+func (t statementTracer) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData){
+	span := trace.SpanFromContext(ctx)
+	defer span.End()
+
+	// A query that found no row did not fail
+	if data.Err != nil && !errors.Is(data.Err, pgx.ErrNoRows){
+		recordError(span, data.Err)
+		return
+	}
+	if !data.CommandTag.Select(){
+		span.SetAttributes(rowsAffectedKey.Int64(data.CommandTag.RowsAffected()))
+	}
+}
@@ -0,0 +1,39 @@
+package repository
+
+import (
+	"bookstore-api/config"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func TestNewPoolConfig(t *testing.T){
+	cfg := config.Default().Database
+	cfg.URL = testDatabaseURL
+	cfg.MaxOpenConns = 40
+	cfg.MinConns = 4
+
+	poolConfig, err := newPoolConfig(cfg)
+	if err != nil{
+		t.Fatalf("newPoolConfig() failed: %v", err)
+	}
+	if poolConfig.MaxConns != 40 || poolConfig.MinConns != 4{
+		t.Errorf("Expected 4 to 40 connections but got %d to %d", poolConfig.MinConns, poolConfig.MaxConns)
+	}
+	if poolConfig.MaxConnLifetime != 30 * time.Minute || poolConfig.HealthCheckPeriod != time.Minute{
+		t.Errorf("Unexpected lifetime %s or health check period %s", poolConfig.MaxConnLifetime, poolConfig.HealthCheckPeriod)
+	}
+	if poolConfig.ConnConfig.StatementCacheCapacity != 512 || poolConfig.ConnConfig.DefaultQueryExecMode != pgx.QueryExecModeCacheStatement{
+		t.Errorf("Expected a statement cache of 512 but got %d in mode %s", poolConfig.ConnConfig.StatementCacheCapacity, poolConfig.ConnConfig.DefaultQueryExecMode)
+	}
+
+	cfg.StatementCacheSize = 0
+	poolConfig, err = newPoolConfig(cfg)
+	if err != nil{
+		t.Fatalf("newPoolConfig() failed: %v", err)
+	}
+	if poolConfig.ConnConfig.DefaultQueryExecMode != pgx.QueryExecModeExec{
+		t.Errorf("Expected unprepared queries without a statement cache but got mode %s", poolConfig.ConnConfig.DefaultQueryExecMode)
+	}
+}
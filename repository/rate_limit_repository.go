@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"bookstore-api/ratelimit"
+	"context"
+	"time"
+)
+
+// RateLimitRepository is a ratelimit.Store shared by every instance of the API
+type RateLimitRepository struct {
+	db *DB
+}
+
+func NewRateLimitRepository(db *DB) *RateLimitRepository{
+	return &RateLimitRepository{db: db}
+}
+
+// The bucket is refilled for the time since its last update and a token is
+// taken if one is left. The upsert locks the row, so concurrent requests of a
+// client are counted one after the other. $2 is the burst and $3 the rate per second.
+const (
+	refilledTokens = `LEAST($2::float8, b.tokens + EXTRACT(EPOCH FROM NOW() - b.updated_at)::float8 * $3::float8)`
+	remainingTokens = refilledTokens + ` - CASE WHEN ` + refilledTokens + ` >= 1 THEN 1 ELSE 0 END`
+)
+
+// Take counts a request against the bucket named key
+func (r *RateLimitRepository) Take(ctx context.Context, key string, limit ratelimit.Limit) (ratelimit.Result, error){
+	ctx, done := r.db.startQuery(ctx, "RateLimitRepository", "Take")
+	defer done()
+
+	// Every SET expression sees the row as it was before the update
+	query := `INSERT INTO rate_limit_buckets AS b (bucket_key, tokens, allowed, updated_at, full_at)
+		VALUES ($1, $2::float8 - 1, TRUE, NOW(), NOW() + INTERVAL '1 second' / $3::float8)
+		ON CONFLICT (bucket_key) DO UPDATE SET
+			tokens = ` + remainingTokens + `,
+			allowed = ` + refilledTokens + ` >= 1,
+			updated_at = NOW(),
+			full_at = NOW() + INTERVAL '1 second' * (($2::float8 - (` + remainingTokens + `)) / $3::float8)
+		RETURNING tokens, allowed`
+
+	var tokens float64
+	var allowed bool
+	err := r.db.QueryRowContext(ctx, query, key, float64(limit.Burst), limit.Rate).Scan(&tokens, &allowed)
+	if err != nil{
+		return ratelimit.Result{}, err
+	}
+	return ratelimit.NewResult(limit, tokens, allowed), nil
+}
+
+// DeleteFullRateLimitBuckets removes buckets that have refilled by now, which
+// behave exactly like missing ones, and returns how many were removed
+func (r *RateLimitRepository) DeleteFullRateLimitBuckets(ctx context.Context, now time.Time) (int64, error){
+	ctx, done := r.db.startQuery(ctx, "RateLimitRepository", "DeleteFullRateLimitBuckets")
+	defer done()
+
+	result, err := r.db.ExecContext(ctx, `DELETE FROM rate_limit_buckets WHERE full_at <= $1`, now)
+	if err != nil{
+		return 0, err
+	}
+	return result.RowsAffected()
+}
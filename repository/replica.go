@@ -0,0 +1,240 @@
+package repository
+
+import (
+	"bookstore-api/config"
+	"bookstore-api/model"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrReplicationStopped is reported by a replica that is not receiving WAL
+// from its primary, however current its last replay looks
+var ErrReplicationStopped = errors.New("replica is not streaming from the primary")
+
+// replicationLagQuery measures how far a replica's replay is behind. A replica
+// that replayed everything it received counts as current, so an idle primary
+// does not make it look stale, but only while its WAL receiver is streaming:
+// with the link down nothing new is received and the LSNs stay equal. The
+// result is NULL then. Roles without pg_read_all_stats see no receiver status
+// and a running receiver counts as streaming. The primary is never behind.
+const replicationLagQuery = `SELECT CASE
+	WHEN NOT pg_is_in_recovery() THEN 0::float8
+	WHEN NOT EXISTS (SELECT 1 FROM pg_stat_wal_receiver WHERE status = 'streaming' OR status IS NULL) THEN NULL
+	WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0::float8
+	ELSE COALESCE(EXTRACT(EPOCH FROM NOW() - pg_last_xact_replay_timestamp())::float8, 0) END`
+
+// ReplicationLag reports how far this database is behind its primary
+func (db *DB) ReplicationLag(ctx context.Context) (time.Duration, error){
+	var seconds *float64
+	if err := db.QueryRowContext(ctx, replicationLagQuery).Scan(&seconds); err != nil{
+		return 0, err
+	}
+	return replicationLag(seconds)
+}
+
+// ReplicationLag reports how far this database is behind its primary
+func (p *Pool) ReplicationLag(ctx context.Context) (time.Duration, error){
+	var seconds *float64
+	if err := p.QueryRow(ctx, replicationLagQuery).Scan(&seconds); err != nil{
+		return 0, err
+	}
+	return replicationLag(seconds)
+}
+
+// replicationLag converts the result of replicationLagQuery
+func replicationLag(seconds *float64) (time.Duration, error){
+	if seconds == nil{
+		return 0, ErrReplicationStopped
+	}
+	return time.Duration(*seconds * float64(time.Second)), nil
+}
+
+type primaryKey struct{}
+
+// ReadFromPrimary makes the replicated stores serve reads made with ctx from
+// the primary, for callers that must see their own recent writes
+func ReadFromPrimary(ctx context.Context) context.Context{
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+func readsFromPrimary(ctx context.Context) bool{
+	primary, _ := ctx.Value(primaryKey{}).(bool)
+	return primary
+}
+
+type pinKey struct{}
+
+// replicaPin remembers the database the first read of a pinned context went to
+type replicaPin struct {
+	mu		sync.Mutex
+	picked	bool
+	replica	*Replica
+}
+
+// PinReplica makes the replicated stores serve every read made with ctx from
+// the same database, for reads that must agree with each other, such as a
+// list and the validators sent with it
+func PinReplica(ctx context.Context) context.Context{
+	return context.WithValue(ctx, pinKey{}, &replicaPin{})
+}
+
+// Replica is a read-only copy of the database serving book reads
+type Replica struct {
+	Name	string
+	Books	BookStore
+	// Lag reports how far the replica is behind the primary
+	Lag		func(ctx context.Context) (time.Duration, error)
+	healthy	atomic.Bool
+}
+
+// OpenReplica sets up the pool of the replica at url with the driver and pool
+// settings of the primary. It does not connect: the replica stays out of
+// rotation until CheckReplicas reaches it, so a replica that is down does not
+// keep the API from starting. The returned func releases the pool.
+func OpenReplica(cfg config.Database, url string) (*Replica, func(), error){
+	cfg.URL = url
+	connConfig, err := pgx.ParseConfig(url)
+	if err != nil{
+		return nil, nil, err
+	}
+	name := net.JoinHostPort(connConfig.Host, strconv.Itoa(int(connConfig.Port)))
+
+	if cfg.Driver == "pgxpool"{
+		pool, err := newPool(cfg)
+		if err != nil{
+			return nil, nil, err
+		}
+		return &Replica{Name: name, Books: NewPgxBookRepository(pool), Lag: pool.ReplicationLag}, pool.Close, nil
+	}
+
+	sqlDB, err := newSQLDB(cfg)
+	if err != nil{
+		return nil, nil, err
+	}
+	db := NewDB(sqlDB, cfg.QueryTimeout.Duration)
+	return &Replica{Name: name, Books: NewBookRepository(db), Lag: db.ReplicationLag}, func(){ db.Close() }, nil
+}
+
+// ReplicatedBookStore writes to the primary and spreads reads round robin over
+// the healthy replicas. A read that fails on a replica is retried on the
+// primary and takes the replica out of rotation until the next check; with
+// no healthy replica, or for a context marked with ReadFromPrimary, reads go
+// to the primary directly.
+type ReplicatedBookStore struct {
+	BookStore
+	replicas	[]*Replica
+	maxLag		time.Duration
+	next		atomic.Uint64
+}
+
+// NewReplicatedBookStore routes reads of primary to replicas. maxLag is the
+// replication lag up to which a replica stays in rotation, 0 for any.
+func NewReplicatedBookStore(primary BookStore, maxLag time.Duration, replicas ...*Replica) *ReplicatedBookStore{
+	return &ReplicatedBookStore{BookStore: primary, replicas: replicas, maxLag: maxLag}
+}
+
+// CheckReplicas measures every replica's lag and puts it in or out of
+// rotation. The error describes the replicas that are out.
+func (s *ReplicatedBookStore) CheckReplicas(ctx context.Context) error{
+	var errs []error
+	for _, replica := range s.replicas{
+		lag, err := replica.Lag(ctx)
+		if err == nil && s.maxLag > 0 && lag > s.maxLag{
+			err = fmt.Errorf("%s behind the primary", lag.Round(time.Millisecond))
+		}
+		replica.healthy.Store(err == nil)
+		if err != nil{
+			errs = append(errs, fmt.Errorf("replica %s: %w", replica.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *ReplicatedBookStore) GetBooks(ctx context.Context) ([]model.Book, error){
+	return routeRead(s, ctx, func(books BookStore) ([]model.Book, error){
+		return books.GetBooks(ctx)
+	})
+}
+
+func (s *ReplicatedBookStore) GetBookByID(ctx context.Context, id int) (model.Book, error){
+	return routeRead(s, ctx, func(books BookStore) (model.Book, error){
+		return books.GetBookByID(ctx, id)
+	})
+}
+
+func (s *ReplicatedBookStore) BooksModifiedAt(ctx context.Context) (time.Time, error){
+	return routeRead(s, ctx, func(books BookStore) (time.Time, error){
+		return books.BooksModifiedAt(ctx)
+	})
+}
+
+// pick returns the next healthy replica, or nil when the read must go to the primary
+func (s *ReplicatedBookStore) pick(ctx context.Context) *Replica{
+	if len(s.replicas) == 0 || readsFromPrimary(ctx){
+		return nil
+	}
+	healthy := 0
+	for _, replica := range s.replicas{
+		if replica.healthy.Load(){
+			healthy++
+		}
+	}
+	if healthy == 0{
+		return nil
+	}
+
+	// Count through the healthy replicas only, so a replica out of rotation
+	// does not double the share of its neighbour
+	n := int(s.next.Add(1) % uint64(healthy))
+	for _, replica := range s.replicas{
+		if replica.healthy.Load(){
+			if n == 0{
+				return replica
+			}
+			n--
+		}
+	}
+	// A replica was taken out of rotation meanwhile
+	return nil
+}
+
+func routeRead[T any](s *ReplicatedBookStore, ctx context.Context, read func(BookStore) (T, error)) (T, error){
+	pin, _ := ctx.Value(pinKey{}).(*replicaPin)
+	if pin != nil{
+		pin.mu.Lock()
+		defer pin.mu.Unlock()
+	}
+
+	var replica *Replica
+	if pin != nil && pin.picked{
+		replica = pin.replica
+	} else {
+		replica = s.pick(ctx)
+	}
+	if pin != nil{
+		pin.picked, pin.replica = true, replica
+	}
+	if replica == nil{
+		return read(s.BookStore)
+	}
+
+	result, err := read(replica.Books)
+	// A missing book is an answer, and a caller that went away is not the replica's fault
+	if err == nil || errors.Is(err, ErrBookNotFound) || ctx.Err() != nil{
+		return result, err
+	}
+	replica.healthy.Store(false)
+	// The pinned reads that follow do not wait for the failed replica again
+	if pin != nil{
+		pin.replica = nil
+	}
+	return read(s.BookStore)
+}
@@ -0,0 +1,164 @@
+package repository
+
+import (
+	"bookstore-api/model"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// namedBooks is a BookStore that answers with its own name as the title, or
+// with err when set
+type namedBooks struct {
+	BookStore
+	name	string
+	err		error
+}
+
+func (b *namedBooks) GetBookByID(ctx context.Context, id int) (model.Book, error){
+	if b.err != nil{
+		return model.Book{}, b.err
+	}
+	return model.Book{ID: id, Title: b.name}, nil
+}
+
+func stubReplica(name string, lag time.Duration, err error) (*Replica, *namedBooks){
+	books := &namedBooks{name: name}
+	return &Replica{
+		Name: name,
+		Books: books,
+		Lag: func(context.Context) (time.Duration, error){ return lag, err },
+	}, books
+}
+
+func readFrom(t *testing.T, s *ReplicatedBookStore, ctx context.Context) string{
+	t.Helper()
+	book, err := s.GetBookByID(ctx, 1)
+	if err != nil{
+		t.Fatalf("GetBookByID() failed: %v", err)
+	}
+	return book.Title
+}
+
+func TestReplicatedBookStoreBalancesHealthyReplicas(t *testing.T){
+	first, _ := stubReplica("first", 0, nil)
+	second, _ := stubReplica("second", 0, nil)
+	lagging, _ := stubReplica("lagging", time.Minute, nil)
+	down, _ := stubReplica("down", 0, errors.New("connection refused"))
+	s := NewReplicatedBookStore(&namedBooks{name: "primary"}, 10 * time.Second, first, second, lagging, down)
+
+	// Replicas stay out of rotation until they were checked
+	if got := readFrom(t, s, context.Background()); got != "primary"{
+		t.Errorf("Expected the primary before the first check but got %s", got)
+	}
+
+	err := s.CheckReplicas(context.Background())
+	if err == nil{
+		t.Fatal("Expected the lagging and the unreachable replica to be reported")
+	}
+
+	reads := map[string]int{}
+	for range 10{
+		reads[readFrom(t, s, context.Background())]++
+	}
+	if reads["first"] != 5 || reads["second"] != 5{
+		t.Errorf("Expected reads to alternate between the healthy replicas but got %v", reads)
+	}
+
+	if got := readFrom(t, s, ReadFromPrimary(context.Background())); got != "primary"{
+		t.Errorf("Expected a read-your-writes read from the primary but got %s", got)
+	}
+}
+
+func TestReplicatedBookStoreFallsBackToPrimary(t *testing.T){
+	replica, books := stubReplica("replica", 0, nil)
+	s := NewReplicatedBookStore(&namedBooks{name: "primary"}, 0, replica)
+	s.CheckReplicas(context.Background())
+
+	// A missing book is an answer and keeps the replica in rotation
+	books.err = ErrBookNotFound
+	if _, err := s.GetBookByID(context.Background(), 1); err != ErrBookNotFound{
+		t.Fatalf("Expected ErrBookNotFound but got %v", err)
+	}
+
+	books.err = errors.New("the database system is shutting down")
+	if got := readFrom(t, s, context.Background()); got != "primary"{
+		t.Errorf("Expected the failed read to be retried on the primary but got %s", got)
+	}
+	books.err = nil
+	if got := readFrom(t, s, context.Background()); got != "primary"{
+		t.Errorf("Expected the failed replica to stay out until the next check but got %s", got)
+	}
+
+	s.CheckReplicas(context.Background())
+	if got := readFrom(t, s, context.Background()); got != "replica"{
+		t.Errorf("Expected the replica back in rotation after a check but got %s", got)
+	}
+}
+
+func TestReplicatedBookStorePinsReadsToOneReplica(t *testing.T){
+	first, firstBooks := stubReplica("first", 0, nil)
+	second, _ := stubReplica("second", 0, nil)
+	s := NewReplicatedBookStore(&namedBooks{name: "primary"}, 0, first, second)
+	s.CheckReplicas(context.Background())
+
+	for range 3{
+		ctx := PinReplica(context.Background())
+		pinned := readFrom(t, s, ctx)
+		for range 3{
+			if got := readFrom(t, s, ctx); got != pinned{
+				t.Fatalf("Expected every pinned read from %s but got %s", pinned, got)
+			}
+		}
+	}
+
+	// Once the pinned replica fails, the remaining reads stay on the primary
+	ctx := PinReplica(context.Background())
+	for readFrom(t, s, ctx) != "first"{
+		ctx = PinReplica(context.Background())
+	}
+	firstBooks.err = errors.New("the database system is shutting down")
+	if got := readFrom(t, s, ctx); got != "primary"{
+		t.Errorf("Expected the failed read to be retried on the primary but got %s", got)
+	}
+	s.CheckReplicas(context.Background())
+	firstBooks.err = nil
+	if got := readFrom(t, s, ctx); got != "primary"{
+		t.Errorf("Expected the pinned reads to stay on the primary but got %s", got)
+	}
+}
+
+func TestReplicationLag(t *testing.T){
+	if _, err := replicationLag(nil); err != ErrReplicationStopped{
+		t.Errorf("Expected ErrReplicationStopped without a streaming WAL receiver but got %v", err)
+	}
+	seconds := 2.5
+	if lag, err := replicationLag(&seconds); err != nil || lag != 2500 * time.Millisecond{
+		t.Errorf("Expected 2.5s of lag but got %s, %v", lag, err)
+	}
+
+	// A replica whose link is down is taken out even with lag checks off
+	stopped, _ := stubReplica("stopped", 0, ErrReplicationStopped)
+	s := NewReplicatedBookStore(&namedBooks{name: "primary"}, 0, stopped)
+	if err := s.CheckReplicas(context.Background()); !errors.Is(err, ErrReplicationStopped){
+		t.Errorf("Expected the stopped replica to be reported but got %v", err)
+	}
+	if got := readFrom(t, s, context.Background()); got != "primary"{
+		t.Errorf("Expected reads from the primary but got %s", got)
+	}
+}
+
+func TestReplicationLagOfPrimary(t *testing.T){
+	db := NewDB(setupTestDB(t), 0)
+	defer db.Close()
+	if lag, err := db.ReplicationLag(context.Background()); err != nil || lag != 0{
+		t.Errorf("Expected the primary to report no lag but got %s, %v", lag, err)
+	}
+
+	pool := setupTestPool(t)
+	defer pool.Close()
+	if lag, err := pool.ReplicationLag(context.Background()); err != nil || lag != 0{
+		t.Errorf("Expected the primary to report no lag but got %s, %v", lag, err)
+	}
+}
@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "bookstore-api/repository"
+
+// rowsAffectedKey is not part of the semantic conventions yet
+const rowsAffectedKey = attribute.Key("db.rows_affected")
+
+// Tx is a transaction whose statements are traced like those run on DB
+type Tx struct {
+	*sql.Tx
+	tracer trace.Tracer
+}
+
+// BeginTx starts a transaction whose statements are traced
+func (db *DB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Tx, error){
+	tx, err := db.DB.BeginTx(ctx, opts)
+	if err != nil{
+		return nil, err
+	}
+	return &Tx{Tx: tx, tracer: db.tracer}, nil
+}
+
+func (db *DB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error){
+	return tracedExec(ctx, db.tracer, db.DB.ExecContext, query, args)
+}
+
+func (db *DB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error){
+	return tracedQuery(ctx, db.tracer, db.DB.QueryContext, query, args)
+}
+
+func (db *DB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row{
+	return tracedQueryRow(ctx, db.tracer, db.DB.QueryRowContext, query, args)
+}
+
+func (tx *Tx) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error){
+	return tracedExec(ctx, tx.tracer, tx.Tx.ExecContext, query, args)
+}
+
+func (tx *Tx) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error){
+	return tracedQuery(ctx, tx.tracer, tx.Tx.QueryContext, query, args)
+}
+
+func (tx *Tx) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row{
+	return tracedQueryRow(ctx, tx.tracer, tx.Tx.QueryRowContext, query, args)
+}
+
+// startMethodSpan opens the span covering one repository method; the
+// statements it runs become its children
+func (i *instrumentation) startMethodSpan(ctx context.Context, repository, method string) (context.Context, trace.Span){
+	return i.tracer.Start(ctx, repository+"."+method, trace.WithAttributes(
+		semconv.CodeFunctionName("repository."+repository+"."+method),
+	))
+}
+
+// startStatementSpan opens a client span for one SQL statement. Only the
+// statement template is recorded, never the arguments.
+func startStatementSpan(ctx context.Context, tracer trace.Tracer, query string) (context.Context, trace.Span){
+	operation := operationName(query)
+	return tracer.Start(ctx, operation, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		semconv.DBSystemNamePostgreSQL,
+		semconv.DBOperationName(operation),
+		semconv.DBQueryText(strings.Join(strings.Fields(query), " ")),
+	))
+}
+
+func tracedExec(ctx context.Context, tracer trace.Tracer, exec func(context.Context, string, ...any) (sql.Result, error), query string, args []any) (sql.Result, error){
+	ctx, span := startStatementSpan(ctx, tracer, query)
+	defer span.End()
+
+	result, err := exec(ctx, query, args...)
+	if err != nil{
+		recordError(span, err)
+		return nil, err
+	}
+	if affected, err := result.RowsAffected(); err == nil{
+		span.SetAttributes(rowsAffectedKey.Int64(affected))
+	}
+	return result, nil
+}
+
+func tracedQuery(ctx context.Context, tracer trace.Tracer, query func(context.Context, string, ...any) (*sql.Rows, error), statement string, args []any) (*sql.Rows, error){
+	ctx, span := startStatementSpan(ctx, tracer, statement)
+	defer span.End()
+
+	rows, err := query(ctx, statement, args...)
+	if err != nil{
+		recordError(span, err)
+	}
+	return rows, err
+}
+
+func tracedQueryRow(ctx context.Context, tracer trace.Tracer, queryRow func(context.Context, string, ...any) *sql.Row, query string, args []any) *sql.Row{
+	ctx, span := startStatementSpan(ctx, tracer, query)
+	defer span.End()
+
+	row := queryRow(ctx, query, args...)
+	if err := row.Err(); err != nil{
+		recordError(span, err)
+	}
+	return row
+}
+
+func recordError(span trace.Span, err error){
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// operationName is the leading SQL keyword such as SELECT or UPDATE, used as the span name
+func operationName(query string) string{
+	fields := strings.Fields(query)
+	if len(fields) == 0{
+		return "SQL"
+	}
+	return strings.ToUpper(fields[0])
+}
+
+func newTracer() trace.Tracer{
+	return otel.Tracer(tracerName)
+}
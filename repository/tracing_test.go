@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// stubDriver answers every statement with one affected row, so tracing can be
+// tested without a database
+type stubDriver struct{}
+
+func (stubDriver) Open(string) (driver.Conn, error){
+	return stubConn{}, nil
+}
+
+type stubConn struct{}
+
+func (stubConn) Prepare(string) (driver.Stmt, error){
+	return nil, errors.New("prepared statements are not supported")
+}
+
+func (stubConn) Close() error{
+	return nil
+}
+
+func (stubConn) Begin() (driver.Tx, error){
+	return nil, errors.New("transactions are not supported")
+}
+
+func (stubConn) ExecContext(context.Context, string, []driver.NamedValue) (driver.Result, error){
+	return driver.RowsAffected(1), nil
+}
+
+func init(){
+	sql.Register("tracing-stub", stubDriver{})
+}
+
+func TestRepositoryCallsAreTraced(t *testing.T){
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	otel.SetTracerProvider(provider)
+
+	sqlDB, err := sql.Open("tracing-stub", "")
+	if err != nil{
+		t.Fatalf("Failed to open the stub database: %v", err)
+	}
+	defer sqlDB.Close()
+	repo := NewUserRepository(NewDB(sqlDB, 0), nil)
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "GET /books/:id")
+	if err := repo.DeleteUser(ctx, 7); err != nil{
+		t.Fatalf("DeleteUser() failed: %v", err)
+	}
+	parent.End()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 3{
+		t.Fatalf("Expected statement, method and request spans but got %d", len(spans))
+	}
+	statement, method := spans[0], spans[1]
+
+	if method.Name != "UserRepository.DeleteUser" || method.Parent.SpanID() != parent.SpanContext().SpanID(){
+		t.Errorf("Expected the method span under the request span, got %q", method.Name)
+	}
+	if statement.Name != "DELETE" || statement.Parent.SpanID() != method.SpanContext.SpanID(){
+		t.Errorf("Expected the statement span under the method span, got %q", statement.Name)
+	}
+
+	attributes := map[string]any{}
+	for _, attribute := range statement.Attributes{
+		attributes[string(attribute.Key)] = attribute.Value.AsInterface()
+	}
+	if attributes["db.query.text"] != "DELETE FROM users WHERE id = $1"{
+		t.Errorf("Expected the statement template, got %v", attributes["db.query.text"])
+	}
+	if attributes["db.rows_affected"] != int64(1){
+		t.Errorf("Expected one affected row, got %v", attributes["db.rows_affected"])
+	}
+	if attributes["db.system.name"] != "postgresql"{
+		t.Errorf("Expected db.system.name postgresql, got %v", attributes["db.system.name"])
+	}
+}
@@ -1,38 +1,45 @@
 package repository
 
 import (
+	"bookstore-api/logging"
+	"context"
 	"database/sql"
 	"bookstore-api/model"
+	"bookstore-api/password"
 	"errors"
 	"strings"
-
-	"golang.org/x/crypto/bcrypt"
 )
 
 // define custom errors for user
 var ErrMailExists = errors.New("email already exists")
+var ErrUserNotFound = errors.New("user not found")
+var ErrInvalidPassword = errors.New("invalid password")
 
 type UserRepository struct {
-	db *sql.DB
+	db *DB
+	hasher *password.Manager
 }
 
-func NewUserRepository(db *sql.DB) *UserRepository{
-	return &UserRepository{db: db}
+func NewUserRepository(db *DB, hasher *password.Manager) *UserRepository{
+	return &UserRepository{db: db, hasher: hasher}
 }
 
 // CreateUser for hashing password and storing user in db
-func (r *UserRepository) CreateUser(user *model.User) (int, error){
+func (r *UserRepository) CreateUser(ctx context.Context, user *model.User) (int, error){
 	// hash the password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+	hashedPassword, err := r.hasher.Hash(user.Password)
 	if err != nil{
 		return 0, err
 	}
 
+	ctx, done := r.db.startQuery(ctx, "UserRepository", "CreateUser")
+	defer done()
+
 	var userID int
 
 	// Save the user to the database with hashed password
 	query := `INSERT INTO users (name, email, password_hash) values ($1, $2, $3) RETURNING id`
-	err = r.db.QueryRow(query, user.Name, user.Email, string(hashedPassword)).Scan(&userID)
+	err = r.db.QueryRowContext(ctx, query, user.Name, user.Email, hashedPassword).Scan(&userID)
 	if err != nil {
 		// Check error if any existing email (violates unique constraint)
 		if strings.Contains(err.Error(), "unique constraint"){
@@ -43,34 +50,80 @@ func (r *UserRepository) CreateUser(user *model.User) (int, error){
 	return userID, nil
 }
 
-// GetUserByEmail fetch user by email
-func (r *UserRepository) GetUserByEmail(email string) (model.User, error){
-	var user model.User
-	query := `SELECT id, name, email, password_hash FROM users WHERE email=$1`
+// userColumns is the column list matching scanUser
+const userColumns = `id, name, email, password_hash, email_verified, COALESCE(totp_secret, ''), totp_enabled, totp_last_step, role, disabled, password_reset_required, tokens_valid_after, created_at`
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface{
+	Scan(dest ...any) error
+}
 
-	err := r.db.QueryRow(query, email).Scan(&user.ID, &user.Name, &user.Email, &user.PasswordHash)
+func scanUser(row rowScanner) (model.User, error){
+	var user model.User
+	err := row.Scan(&user.ID, &user.Name, &user.Email, &user.PasswordHash, &user.EmailVerified, &user.TOTPSecret, &user.TOTPEnabled, &user.TOTPLastStep, &user.Role, &user.Disabled, &user.PasswordResetRequired, &user.TokensValidAfter, &user.CreatedAt)
 	if err != nil{
 		if err == sql.ErrNoRows{
-			return user, ErrBookNotFound
+			return user, ErrUserNotFound
 		}
 		return user, err
 	}
 	return user, nil
 }
 
+// GetUserByEmail fetch user by email
+func (r *UserRepository) GetUserByEmail(ctx context.Context, email string) (model.User, error){
+	ctx, done := r.db.startQuery(ctx, "UserRepository", "GetUserByEmail")
+	defer done()
+
+	query := `SELECT ` + userColumns + ` FROM users WHERE email=$1`
+	return scanUser(r.db.QueryRowContext(ctx, query, email))
+}
+
+// GetUserByID fetch user by id
+func (r *UserRepository) GetUserByID(ctx context.Context, id int64) (model.User, error){
+	ctx, done := r.db.startQuery(ctx, "UserRepository", "GetUserByID")
+	defer done()
+
+	query := `SELECT ` + userColumns + ` FROM users WHERE id=$1`
+	return scanUser(r.db.QueryRowContext(ctx, query, id))
+}
+
 // Login verify user credentials and return user details if valid
-func (r *UserRepository) Login(email, password string) (model.User, error){
+func (r *UserRepository) Login(ctx context.Context, email, plaintext string) (model.User, error){
 	// Find user by email
-	user, err := r.GetUserByEmail(email)
+	user, err := r.GetUserByEmail(ctx, email)
 	if err != nil{
 		return user, err
 	}
 
-	// Compare the provided password with the stored hashed password
-	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
+	// Compare the provided password with the stored hash. Unknown formats such as
+	// the unusable hash of SSO-only accounts never match.
+	needsRehash, err := r.hasher.Verify(user.PasswordHash, plaintext)
 	if err != nil{
-		return model.User{}, errors.New("invalid password")
+		return model.User{}, ErrInvalidPassword
+	}
+
+	// Upgrade hashes made with an old algorithm or weaker parameters while the
+	// plain text password is at hand. A failure here must not block the login.
+	if needsRehash{
+		if err := r.rehashPassword(ctx, user.ID, user.PasswordHash, plaintext); err != nil{
+			logging.FromContext(ctx).Warn("failed to rehash password", "user_id", user.ID, "error", err)
+		}
 	}
 
 	return user, nil
+}
+
+// rehashPassword replaces the stored hash unless it was changed concurrently
+func (r *UserRepository) rehashPassword(ctx context.Context, userID int64, oldHash, plaintext string) error{
+	hashedPassword, err := r.hasher.Hash(plaintext)
+	if err != nil{
+		return err
+	}
+
+	ctx, done := r.db.startQuery(ctx, "UserRepository", "rehashPassword")
+	defer done()
+
+	_, err = r.db.ExecContext(ctx, `UPDATE users SET password_hash = $1 WHERE id = $2 AND password_hash = $3`, hashedPassword, userID, oldHash)
+	return err
 }
\ No newline at end of file
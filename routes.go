@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bookstore-api/handler"
+	"bookstore-api/metrics"
+	"bookstore-api/model"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The unversioned API paths predate /v1. They keep working as aliases of /v1
+// until legacySunset and announce their deprecation in every response.
+var (
+	legacyDeprecatedAt = time.Date(2026, time.November, 1, 0, 0, 0, 0, time.UTC)
+	legacySunset = time.Date(2027, time.May, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// routes holds everything the router dispatches to. Every route registered
+// here must be described in openapi/openapi.yaml; routes_test.go checks both
+// stay in sync.
+type routes struct {
+	books		*handler.BookHandler
+	users		*handler.UserHandler
+	jwks		*handler.JWKSHandler
+	admin		*handler.AdminHandler
+	apiKeys		*handler.APIKeyHandler
+	// oidc is nil when single sign-on is disabled
+	oidc		*handler.OIDCHandler
+	health		*handler.HealthHandler
+	authenticate	gin.HandlerFunc
+	// idempotent lets clients retry a non-idempotent request with an Idempotency-Key
+	idempotent		gin.HandlerFunc
+	// rateLimit must run after authenticate to count requests per API key or user
+	rateLimit		gin.HandlerFunc
+}
+
+func (r routes) register(router *gin.Engine){
+	// Operational endpoints are not versioned
+	router.GET("/metrics", gin.WrapH(metrics.Handler()))
+	router.GET("/healthz", r.health.LivenessHandler)
+	router.GET("/readyz", r.health.ReadinessHandler)
+
+	// API documentation
+	router.GET("/openapi.json", handler.OpenAPIHandler)
+	router.GET("/docs", handler.DocsHandler)
+	router.GET("/docs/init.js", handler.DocsScriptHandler)
+
+	// Well-known URIs must stay at the root (RFC 8615)
+	router.GET("/.well-known/jwks.json", r.jwks.GetJWKSHandler)
+
+	// Each API version registers its routes on its own group. A breaking change
+	// to a representation, e.g. model.Book, goes into a registerV2 with handlers
+	// for the new representation built on the same repositories; routes that do
+	// not change are registered with the v1 handlers.
+	r.registerV1(router.Group("/v1"))
+	r.registerV1(router.Group("", handler.Deprecated(legacyDeprecatedAt, legacySunset, "/v1")))
+}
+
+func (r routes) registerV1(api *gin.RouterGroup){
+	// Public routes are limited per client IP
+	public := api.Group("", r.rateLimit)
+
+	// Book routes
+	public.GET("/books", r.books.GetBooksHandler)
+	public.GET("/books/:id", r.books.GetBookByIDHandler)
+
+	bookWriter := api.Group("/books", r.authenticate, r.rateLimit, handler.RequireScope(model.ScopeWriteBooks))
+	bookWriter.POST("", r.idempotent, r.books.CreateBookHandler)
+	bookWriter.PUT("/:id", r.books.UpdateBookHandler)
+	bookWriter.DELETE("/:id", r.books.DeleteBookHandler)
+
+	// User routes
+	public.POST("/register", r.users.RegisterUserHandler)
+	public.POST("/login", r.users.LoginUserHandler)
+	public.POST("/login/mfa", r.users.VerifyMFAHandler)
+	public.POST("/verify-email", r.users.VerifyEmailHandler)
+	public.POST("/reset-password", r.users.ResetPasswordHandler)
+	if r.oidc != nil{
+		public.GET("/auth/oidc/login", r.oidc.LoginHandler)
+		public.GET("/auth/oidc/callback", r.oidc.CallbackHandler)
+	}
+
+	// Account routes, reachable with an API key that has the account scope
+	account := api.Group("/me", r.authenticate, r.rateLimit, handler.RequireScope(model.ScopeAccount))
+	account.GET("", r.users.GetMeHandler)
+	account.PATCH("", r.users.UpdateMeHandler)
+
+	// Credential routes, only reachable after a login so a leaked API key cannot take over the account
+	session := api.Group("/me", r.authenticate, r.rateLimit, handler.RequireSession())
+	session.DELETE("", r.users.DeleteMeHandler)
+	session.POST("/password", r.users.ChangePasswordHandler)
+	session.POST("/mfa/totp", r.users.EnrollTOTPHandler)
+	session.POST("/mfa/totp/confirm", r.users.ConfirmTOTPHandler)
+	session.GET("/api-keys", r.apiKeys.ListAPIKeysHandler)
+	session.POST("/api-keys", r.apiKeys.CreateAPIKeyHandler)
+	session.DELETE("/api-keys/:id", r.apiKeys.RevokeAPIKeyHandler)
+
+	// Admin routes
+	admin := api.Group("/admin", r.authenticate, r.rateLimit, handler.RequireSession(), handler.RequireRole(model.RoleAdmin))
+	admin.GET("/users", r.admin.ListUsersHandler)
+	admin.GET("/users/:id", r.admin.GetUserHandler)
+	admin.POST("/users/:id/disable", r.admin.DisableUserHandler)
+	admin.POST("/users/:id/enable", r.admin.EnableUserHandler)
+	admin.POST("/users/:id/force-password-reset", r.admin.ForcePasswordResetHandler)
+	admin.POST("/users/:id/impersonate", r.admin.ImpersonateUserHandler)
+}
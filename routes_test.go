@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bookstore-api/handler"
+	"bookstore-api/openapi"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ginParam matches path parameters in gin syntax, e.g. :id
+var ginParam = regexp.MustCompile(`:([A-Za-z0-9_]+)`)
+
+// TestRoutesMatchOpenAPISpec fails when a route is added, removed or renamed
+// without updating openapi/openapi.yaml, or the other way around
+func TestRoutesMatchOpenAPISpec(t *testing.T){
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	// Handlers are never called, so they do not need dependencies. OIDC is
+	// registered so the optional routes are checked as well.
+	routes{
+		oidc: &handler.OIDCHandler{},
+		health: handler.NewHealthHandler(time.Second),
+		authenticate: func(c *gin.Context){},
+	}.register(router)
+
+	var registered []string
+	for _, route := range router.Routes(){
+		registered = append(registered, route.Method+" "+ginParam.ReplaceAllString(route.Path, "{$1}"))
+	}
+
+	documented, err := openapi.Operations()
+	if err != nil{
+		t.Fatalf("Failed to read the OpenAPI document: %v", err)
+	}
+
+	for _, operation := range registered{
+		if slices.Contains(documented, operation){
+			continue
+		}
+		// Deprecated unversioned aliases are documented through their /v1 path
+		method, path, _ := strings.Cut(operation, " ")
+		if !slices.Contains(documented, method+" /v1"+path){
+			t.Errorf("Route %s is not described in openapi/openapi.yaml", operation)
+		}
+	}
+	for _, operation := range documented{
+		if !slices.Contains(registered, operation){
+			t.Errorf("openapi/openapi.yaml describes %s, which is not registered", operation)
+		}
+	}
+}
+
+// TestLegacyRoutesAliasV1 checks that every /v1 route keeps its unversioned alias until the sunset
+func TestLegacyRoutesAliasV1(t *testing.T){
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	routes{
+		oidc: &handler.OIDCHandler{},
+		health: handler.NewHealthHandler(time.Second),
+		authenticate: func(c *gin.Context){},
+	}.register(router)
+
+	registered := map[string]bool{}
+	for _, route := range router.Routes(){
+		registered[route.Method+" "+route.Path] = true
+	}
+	for operation := range registered{
+		method, path, _ := strings.Cut(operation, " ")
+		if legacyPath, ok := strings.CutPrefix(path, "/v1/"); ok && !registered[method+" /"+legacyPath]{
+			t.Errorf("%s has no deprecated alias at /%s", operation, legacyPath)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bookstore-api/config"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Exit codes reported to the process supervisor
+const (
+	exitOK = 0
+	// exitError means the server stopped because of an error while running
+	exitError = 1
+	// exitShutdownTimeout means in-flight requests or workers were cut off at the shutdown deadline
+	exitShutdownTimeout = 2
+	// exitUnavailable means a dependency such as the database could not be reached (EX_UNAVAILABLE)
+	exitUnavailable = 69
+	// exitConfig means the configuration is invalid (EX_CONFIG)
+	exitConfig = 78
+)
+
+// workers tracks background goroutines so shutdown can wait for them to finish
+type workers struct {
+	wg sync.WaitGroup
+}
+
+// Go runs fn in the background. fn must return once its context is cancelled.
+func (w *workers) Go(name string, fn func()){
+	w.wg.Add(1)
+	go func(){
+		defer w.wg.Done()
+		fn()
+		slog.Info("background worker stopped", "worker", name)
+	}()
+}
+
+// Wait blocks until every worker returned or ctx expires
+func (w *workers) Wait(ctx context.Context) error{
+	done := make(chan struct{})
+	go func(){
+		w.wg.Wait()
+		close(done)
+	}()
+
+	select{
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// serve runs the server until it fails or ctx is cancelled by a shutdown signal.
+// On shutdown it calls startDraining so readiness fails, keeps serving for the
+// drain delay while load balancers notice, then stops accepting connections and
+// waits up to the shutdown timeout for in-flight requests. Finally it cancels
+// the background workers and waits for them within the same deadline.
+func serve(ctx context.Context, server *http.Server, bg *workers, stopWorkers context.CancelFunc, startDraining func(), cfg config.Server) int{
+	serverErrors := make(chan error, 1)
+	go func(){
+		slog.Info("starting server", "addr", server.Addr)
+		serverErrors <- server.ListenAndServe()
+	}()
+
+	select{
+	case err := <-serverErrors:
+		slog.Error("server failed", "error", err)
+		stopWorkers()
+		return exitError
+	case <-ctx.Done():
+	}
+
+	startDraining()
+	if cfg.DrainDelay.Duration > 0{
+		slog.Info("shutdown signal received, failing readiness before closing the listener", "drain_delay", cfg.DrainDelay.String())
+		time.Sleep(cfg.DrainDelay.Duration)
+	}
+
+	shutdownTimeout := cfg.ShutdownTimeout.Duration
+	slog.Info("shutdown signal received, draining in-flight requests", "timeout", shutdownTimeout.String())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	code := exitOK
+	if err := server.Shutdown(shutdownCtx); err != nil{
+		slog.Error("failed to drain in-flight requests", "error", err)
+		server.Close()
+		code = exitShutdownTimeout
+	}
+	if err := <-serverErrors; err != nil && !errors.Is(err, http.ErrServerClosed){
+		slog.Error("server failed", "error", err)
+		code = exitError
+	}
+
+	stopWorkers()
+	if err := bg.Wait(shutdownCtx); err != nil{
+		slog.Error("background workers did not stop in time", "error", err)
+		code = exitShutdownTimeout
+	}
+
+	slog.Info("server stopped")
+	return code
+}
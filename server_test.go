@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bookstore-api/config"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// freeAddr returns a loopback address with a port that is currently unused
+func freeAddr(t *testing.T) string{
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil{
+		t.Fatalf("Failed to find a free port: %v", err)
+	}
+	defer listener.Close()
+	return listener.Addr().String()
+}
+
+// startSlowServer serves /slow, which blocks until release is closed, and /fast.
+// It returns once a request to /slow is in flight.
+func startSlowServer(t *testing.T, cfg config.Server, startDraining func(), release chan struct{}) (string, context.CancelFunc, chan int, chan struct{}){
+	addr := freeAddr(t)
+	started := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request){
+		close(started)
+		<-release
+		io.WriteString(w, "done")
+	})
+	mux.HandleFunc("/fast", func(w http.ResponseWriter, r *http.Request){
+		io.WriteString(w, "done")
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	var bg workers
+	bg.Go("test worker", func(){ <-workerCtx.Done() })
+
+	exitCode := make(chan int, 1)
+	go func(){
+		exitCode <- serve(ctx, &http.Server{Addr: addr, Handler: mux}, &bg, stopWorkers, startDraining, cfg)
+	}()
+
+	// Wait until the server accepts connections
+	for i := 0; i < 100; i++{
+		if conn, err := net.Dial("tcp", addr); err == nil{
+			conn.Close()
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	response := make(chan struct{})
+	go func(){
+		defer close(response)
+		resp, err := http.Get("http://" + addr + "/slow")
+		if err != nil{
+			return
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != "done"{
+			t.Errorf("Expected the in-flight request to complete, got %q", body)
+		}
+	}()
+	<-started
+	return addr, cancel, exitCode, response
+}
+
+func TestServeDrainsInFlightRequests(t *testing.T){
+	release := make(chan struct{})
+	cfg := config.Server{ShutdownTimeout: config.Duration{Duration: 5 * time.Second}}
+	_, shutdown, exitCode, response := startSlowServer(t, cfg, func(){}, release)
+
+	shutdown()
+	time.AfterFunc(100*time.Millisecond, func(){ close(release) })
+
+	select{
+	case code := <-exitCode:
+		if code != exitOK{
+			t.Errorf("Expected exit code %d but got %d", exitOK, code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Server did not shut down")
+	}
+	<-response
+}
+
+func TestServeReportsShutdownTimeout(t *testing.T){
+	release := make(chan struct{})
+	defer close(release)
+	cfg := config.Server{ShutdownTimeout: config.Duration{Duration: 50 * time.Millisecond}}
+	_, shutdown, exitCode, _ := startSlowServer(t, cfg, func(){}, release)
+
+	shutdown()
+
+	select{
+	case code := <-exitCode:
+		if code != exitShutdownTimeout{
+			t.Errorf("Expected exit code %d but got %d", exitShutdownTimeout, code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Server did not shut down")
+	}
+}
+
+func TestServeFailsReadinessBeforeClosingListener(t *testing.T){
+	release := make(chan struct{})
+	close(release)
+	draining := make(chan struct{})
+	cfg := config.Server{
+		ShutdownTimeout: config.Duration{Duration: 5 * time.Second},
+		DrainDelay: config.Duration{Duration: 300 * time.Millisecond},
+	}
+	addr, shutdown, exitCode, _ := startSlowServer(t, cfg, func(){ close(draining) }, release)
+
+	shutdown()
+	select{
+	case <-draining:
+	case <-time.After(time.Second):
+		t.Fatal("Readiness was not failed on shutdown")
+	}
+
+	// New requests are still served during the drain delay
+	resp, err := http.Get("http://" + addr + "/fast")
+	if err != nil{
+		t.Fatalf("Expected requests to be served during the drain delay: %v", err)
+	}
+	resp.Body.Close()
+
+	select{
+	case code := <-exitCode:
+		if code != exitOK{
+			t.Errorf("Expected exit code %d but got %d", exitOK, code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Server did not shut down")
+	}
+}